@@ -0,0 +1,171 @@
+package graceful
+
+import (
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// AcceptStats are numbers of connections accepted on listeners
+type AcceptStats struct {
+	// Accepted is the number of connections accepted, and Open the number
+	// of those that have not been closed, hijacked ones included
+	Accepted int64
+	Open     int64
+
+	// PerSecond is the number of connections accepted in the last whole second
+	PerSecond int64
+}
+
+// acceptCounter counts the connections accepted on listeners
+type acceptCounter struct {
+	// clk tells the seconds apart, DefaultClock if nil
+	clk Clock
+
+	accepted atomic.Int64
+	open     atomic.Int64
+
+	// second is the second, in Unix time, that current counts the accepts
+	// of, and previous those of the second before it
+	second   atomic.Int64
+	current  atomic.Int64
+	previous atomic.Int64
+}
+
+// accept counts a connection that was accepted
+func (ac *acceptCounter) accept() {
+	ac.accepted.Add(1)
+	ac.open.Add(1)
+
+	now := ac.now()
+
+	if s := ac.second.Load(); s != now && ac.second.CompareAndSwap(s, now) {
+		n := ac.current.Swap(0)
+		if s != now-1 {
+			n = 0
+		}
+
+		ac.previous.Store(n)
+	}
+
+	ac.current.Add(1)
+}
+
+func (ac *acceptCounter) stats() AcceptStats {
+	st := AcceptStats{Accepted: ac.accepted.Load(), Open: ac.open.Load()}
+
+	switch now := ac.now(); ac.second.Load() {
+	case now:
+		st.PerSecond = ac.previous.Load()
+	case now - 1:
+		st.PerSecond = ac.current.Load()
+	}
+
+	return st
+}
+
+// now returns the current second, in Unix time
+func (ac *acceptCounter) now() int64 {
+	if ac.clk != nil {
+		return ac.clk.Now().Unix()
+	}
+
+	return DefaultClock.Now().Unix()
+}
+
+// accepts counts the connections accepted on the listeners of every Instance
+var accepts acceptCounter
+
+// AcceptCounts returns the numbers of connections accepted on the listeners
+// created by an Instance for its *http.Servers, while ConnCounts counts the
+// connections of every *http.Server by state
+func AcceptCounts() AcceptStats {
+	return accepts.stats()
+}
+
+// AcceptCountsVar returns AcceptCounts as an expvar.Var,
+// to publish it using expvar.Publish
+//
+//	expvar.Publish("graceful_accepts", graceful.AcceptCountsVar())
+func AcceptCountsVar() expvar.Var {
+	return expvar.Func(func() interface{} { return AcceptCounts() })
+}
+
+// counting wraps ln so that the connections accepted on it are counted,
+// both for the package and the Instance
+func (i *Instance) counting(ln net.Listener) net.Listener {
+	i.counted.Store(true)
+
+	return &countingListener{Listener: ln, counters: []*acceptCounter{&accepts, &i.accepts}}
+}
+
+type countingListener struct {
+	net.Listener
+
+	counters []*acceptCounter
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ac := range l.counters {
+		ac.accept()
+	}
+
+	return &countedConn{Conn: c, counters: l.counters}, nil
+}
+
+// countedConn is no longer counted as open once closed, also when hijacked
+// or force closed, as those are closed using Close too
+type countedConn struct {
+	net.Conn
+
+	counters []*acceptCounter
+	once     sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		for _, ac := range c.counters {
+			ac.open.Add(-1)
+		}
+	})
+
+	return c.Conn.Close()
+}
+
+// ReadFrom keeps the sendfile optimization of *net.TCPConn
+func (c *countedConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+
+	return io.Copy(c.Conn, r)
+}
+
+// CloseWrite keeps the half-close of *net.TCPConn and *net.UnixConn
+func (c *countedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return errors.New("graceful: connection cannot be half-closed")
+}
+
+// openConns returns the number of connections open on the listeners
+// created by the Instance, or nil if it created none
+func (i *Instance) openConns() *int {
+	if !i.counted.Load() {
+		return nil
+	}
+
+	n := int(i.accepts.open.Load())
+
+	return &n
+}
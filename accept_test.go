@@ -0,0 +1,220 @@
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptCounter(t *testing.T) {
+	clk := newFakeClock()
+
+	ac := acceptCounter{clk: clk}
+
+	for n := 0; n < 3; n++ {
+		ac.accept()
+	}
+
+	if got, want := ac.stats(), (AcceptStats{Accepted: 3, Open: 3}); got != want {
+		t.Fatalf("ac.stats() = %+v, want %+v within the first second", got, want)
+	}
+
+	clk.Advance(time.Second)
+	ac.accept()
+	ac.open.Add(-2)
+
+	if got, want := ac.stats(), (AcceptStats{Accepted: 4, Open: 2, PerSecond: 3}); got != want {
+		t.Fatalf("ac.stats() = %+v, want %+v a second later", got, want)
+	}
+
+	clk.Advance(time.Second)
+
+	if got, want := ac.stats().PerSecond, int64(1); got != want {
+		t.Fatalf("ac.stats().PerSecond = %d, want %d", got, want)
+	}
+
+	clk.Advance(time.Second)
+
+	if got, want := ac.stats().PerSecond, int64(0); got != want {
+		t.Fatalf("ac.stats().PerSecond = %d once idle, want %d", got, want)
+	}
+}
+
+func TestAcceptCounts(t *testing.T) {
+	addrs := make(chan string, 1)
+	started, hijacked := make(chan struct{}), make(chan struct{})
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/hijack", func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// Left open until it is cut at the deadline
+		io.WriteString(c, "hijacked\n")
+		close(hijacked)
+	})
+
+	mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	var logged []string
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: mux}, WithSignals(make(chan os.Signal)),
+		WithRegistry(&Registry{}), WithNetwork("tcp4"), WithShutdownTimeout(100*time.Millisecond),
+		WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ListeningEvent:
+				addrs <- e.Addr
+			case ShutdownEvent:
+				logged = append(logged, e.String())
+			}
+		}))
+
+	before := AcceptCounts()
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	io.WriteString(c, "GET /hijack HTTP/1.1\r\nHost: graceful\r\n\r\n")
+
+	if line, err := bufio.NewReader(c).ReadString('\n'); err != nil || line != "hijacked\n" {
+		t.Fatalf("ReadString() = %q, %v, want %q", line, err, "hijacked\n")
+	}
+
+	<-hijacked
+
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/block"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+
+	got := AcceptCounts()
+
+	if got.Accepted-before.Accepted != 2 || got.Open-before.Open != 2 {
+		t.Fatalf("AcceptCounts() = %+v, from %+v, want 2 more accepted and open", got, before)
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err == nil {
+		t.Fatalf("i.Run() = nil, want the drain to time out")
+	}
+
+	if len(logged) != 1 || !strings.HasSuffix(logged[0], ", 2 connections open") {
+		t.Fatalf("logged %q, want the 2 open connections", logged)
+	}
+
+	// Both the hijacked and force closed connections were closed
+	if got, want := i.accepts.open.Load(), int64(0); got != want {
+		t.Fatalf("i.accepts.open = %d once shut down, want %d", got, want)
+	}
+}
+
+func TestAcceptCountsListenAndServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// Served as by ListenAndServe, without options for its listener
+	i := New(&http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})},
+		WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		resp, err := http.Get("http://" + addr)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := i.accepts.accepted.Load(), int64(1); got != want {
+		t.Fatalf("i.accepts.accepted = %d, want %d", got, want)
+	}
+}
+
+func TestCountedConnCloseWrite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	read := make(chan string, 1)
+
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			read <- err.Error()
+			return
+		}
+		defer c.Close()
+
+		b, _ := io.ReadAll(c)
+		read <- string(b)
+	}()
+
+	c, err := (&countingListener{Listener: ln}).Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cw, ok := c.(interface{ CloseWrite() error })
+	if !ok {
+		t.Fatalf("%T has no CloseWrite method", c)
+	}
+
+	io.WriteString(c, "bye")
+
+	if err := cw.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() = %v, want nil", err)
+	}
+
+	if got, want := <-read, "bye"; got != want {
+		t.Fatalf("read %q, want %q once half-closed", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// useBaseContext sets the BaseContext of hs so that the contexts of its
+// requests carry the channel returned by ShutdownChan, see
+// ShutdownChanFromContext, and are canceled by ct, at the CancelRequests
+// stage set by WithDrainStages or once the Instance has shut down. A
+// BaseContext already set is called for the parent of the context, keeping
+// its values and cancellation.
+func (i *Instance) useBaseContext(ct *connTracker, hs *http.Server) {
+	next := hs.BaseContext
+
+	hs.BaseContext = func(ln net.Listener) context.Context {
+		parent := context.Background()
+
+		if next != nil {
+			parent = next(ln)
+		}
+
+		ctx, cancel := context.WithCancel(context.WithValue(parent, shutdownChanKey, i.ShutdownChan()))
+
+		ct.cancelMu.Lock()
+		ct.cancels = append(ct.cancels, cancel)
+		ct.cancelMu.Unlock()
+
+		return ctx
+	}
+}
+
+// cancelRequests cancels the base contexts set by useBaseContext
+func (ct *connTracker) cancelRequests() {
+	if ct == nil {
+		return
+	}
+
+	ct.cancelMu.Lock()
+	cancels := ct.cancels
+	ct.cancels = nil
+	ct.cancelMu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// releaseRequests cancels the base contexts of the requests of every server,
+// once the Instance has shut down
+func (i *Instance) releaseRequests() {
+	for _, m := range i.members {
+		m.conns.cancelRequests()
+
+		if m.supervisor != nil {
+			m.supervisor.mu.Lock()
+			ct := m.supervisor.conns
+			m.supervisor.mu.Unlock()
+
+			ct.cancelRequests()
+		}
+	}
+}
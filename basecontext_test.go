@@ -0,0 +1,81 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestUseBaseContext(t *testing.T) {
+	type key struct{}
+
+	for _, tc := range []struct {
+		name  string
+		base  func(net.Listener) context.Context
+		value interface{}
+	}{
+		{"unset", nil, nil},
+		{"composed", func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), key{}, "theirs")
+		}, "theirs"},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			addrs := make(chan string, 1)
+			contexts, bases := make(chan context.Context, 1), make(chan context.Context, 1)
+
+			hs := &http.Server{Addr: "127.0.0.1:0", BaseContext: tc.base, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contexts <- r.Context()
+			}), ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				bases <- ctx
+				return ctx
+			}}
+
+			i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+				if e.Kind == ListeningEvent {
+					addrs <- e.Addr
+				}
+			}))
+
+			errs := make(chan error, 1)
+			go func() { errs <- i.Run(context.Background()) }()
+
+			resp, err := http.Get("http://" + <-addrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			ctx, base := <-contexts, <-bases
+
+			if got := ctx.Value(key{}); got != tc.value {
+				t.Fatalf("ctx.Value() = %v, want %v", got, tc.value)
+			}
+
+			shutdown := ShutdownChanFromContext(ctx)
+
+			if shutdown == nil || shutdown != i.ShutdownChan() {
+				t.Fatalf("ShutdownChanFromContext() = %v, want %v", shutdown, i.ShutdownChan())
+			}
+
+			if base.Err() != nil {
+				t.Fatalf("base.Err() = %v while serving, want nil", base.Err())
+			}
+
+			i.Shutdown()
+
+			if err := <-errs; err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			<-shutdown
+
+			if base.Err() != context.Canceled {
+				t.Fatalf("base.Err() = %v once shut down, want %v", base.Err(), context.Canceled)
+			}
+		})
+	}
+}
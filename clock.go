@@ -0,0 +1,212 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used for shutdown deadlines
+type Clock interface {
+	Now() time.Time
+	Until(t time.Time) time.Duration
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is implemented by the timers returned from Clock.NewTimer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// DefaultClock is the Clock used by the Instances without WithClock,
+// and by what is not part of an Instance
+var DefaultClock Clock = realClock{}
+
+// WithClock makes the Instance read the time, and set its deadlines and
+// timers, using clk instead of DefaultClock, such as a fake clock that tests
+// advance by hand
+func WithClock(clk Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// clock returns the clock set by WithClock, or DefaultClock
+func (i *Instance) clock() Clock {
+	if i.cfg.clock != nil {
+		return i.cfg.clock
+	}
+
+	return DefaultClock
+}
+
+// clockContextKey is the context key of the Clock measuring the deadline
+// of a context returned by withClockTimeout
+var clockContextKey = &contextKey{"clock"}
+
+// contextClock returns the clock measuring the deadline of ctx,
+// DefaultClock unless set by an Instance using WithClock
+func contextClock(ctx context.Context) Clock {
+	if clk, ok := ctx.Value(clockContextKey).(Clock); ok {
+		return clk
+	}
+
+	return DefaultClock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (rt realTimer) C() <-chan time.Time { return rt.t.C }
+
+func (rt realTimer) Stop() bool { return rt.t.Stop() }
+
+// withTimeout returns a context that expires once d has passed on clk
+func withTimeout(parent context.Context, clk Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clk.(realClock); ok || clk == nil {
+		return context.WithTimeout(parent, d)
+	}
+
+	return withClockTimeout(parent, clk, d)
+}
+
+// withClockTimeout is like withTimeout, also for the real clock,
+// but the deadline of the returned context can be moved using shorten
+func withClockTimeout(parent context.Context, clk Clock, d time.Duration) (*clockContext, context.CancelFunc) {
+	ctx := &clockContext{
+		parent:   parent,
+		clk:      clk,
+		deadline: clk.Now().Add(d),
+		done:     make(chan struct{}),
+		timers:   make(chan Timer),
+	}
+
+	t := clk.NewTimer(d)
+
+	go func() {
+		defer func() { t.Stop() }()
+
+		for {
+			select {
+			case <-t.C():
+				ctx.cancel(context.DeadlineExceeded)
+			case <-parent.Done():
+				ctx.cancel(parent.Err())
+			case <-ctx.done:
+			case next := <-ctx.timers:
+				t.Stop()
+				t = next
+				continue
+			}
+
+			return
+		}
+	}()
+
+	return ctx, func() { ctx.cancel(context.Canceled) }
+}
+
+// clockContext is a context with a deadline measured by a Clock
+type clockContext struct {
+	parent   context.Context
+	clk      Clock
+	done     chan struct{}
+	timers   chan Timer
+	once     sync.Once
+	mu       sync.Mutex
+	deadline time.Time
+	err      error
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	if d, ok := c.parent.Deadline(); ok && d.Before(deadline) {
+		return d, true
+	}
+
+	return deadline, true
+}
+
+func (c *clockContext) Done() <-chan struct{} { return c.done }
+
+func (c *clockContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *clockContext) Value(key interface{}) interface{} {
+	if key == clockContextKey {
+		return c.clk
+	}
+
+	return c.parent.Value(key)
+}
+
+func (c *clockContext) cancel(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+
+		close(c.done)
+	})
+}
+
+// extend moves the deadline of c d later, returning false if c is done
+func (c *clockContext) extend(d time.Duration) bool {
+	c.mu.Lock()
+
+	if c.err != nil {
+		c.mu.Unlock()
+		return false
+	}
+
+	c.deadline = c.deadline.Add(d)
+	t := c.clk.NewTimer(c.clk.Until(c.deadline))
+	c.mu.Unlock()
+
+	select {
+	case c.timers <- t:
+		return true
+	case <-c.done:
+		t.Stop()
+		return false
+	}
+}
+
+// shorten moves the deadline of c to d from now, unless it is already sooner
+func (c *clockContext) shorten(d time.Duration) {
+	c.mu.Lock()
+
+	deadline := c.clk.Now().Add(d)
+	if !deadline.Before(c.deadline) {
+		c.mu.Unlock()
+		return
+	}
+
+	c.deadline = deadline
+	c.mu.Unlock()
+
+	t := c.clk.NewTimer(d)
+
+	select {
+	case c.timers <- t:
+	case <-c.done:
+		t.Stop()
+	}
+}
@@ -0,0 +1,203 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		clk := newFakeClock()
+
+		ctx, cancel := withTimeout(context.Background(), clk, 10*time.Second)
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatalf("ctx.Deadline() returned no deadline")
+		}
+
+		if got, want := clk.Until(deadline), 10*time.Second; got != want {
+			t.Fatalf("clk.Until(deadline) = %v, want %v", got, want)
+		}
+
+		clk.Advance(9 * time.Second)
+
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("ctx.Err() = %v, want nil", err)
+		}
+
+		clk.Advance(time.Second)
+
+		<-ctx.Done()
+
+		if got, want := ctx.Err(), context.DeadlineExceeded; got != want {
+			t.Fatalf("ctx.Err() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := withTimeout(context.Background(), newFakeClock(), time.Second)
+
+		cancel()
+
+		<-ctx.Done()
+
+		if got, want := ctx.Err(), context.Canceled; got != want {
+			t.Fatalf("ctx.Err() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("parent", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+
+		ctx, cancel := withTimeout(parent, newFakeClock(), time.Second)
+		defer cancel()
+
+		cancelParent()
+
+		<-ctx.Done()
+
+		if got, want := ctx.Err(), context.Canceled; got != want {
+			t.Fatalf("ctx.Err() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("shorten", func(t *testing.T) {
+		clk := newFakeClock()
+
+		ctx, cancel := withClockTimeout(context.Background(), clk, 10*time.Second)
+		defer cancel()
+
+		ctx.shorten(4 * time.Second)
+		ctx.shorten(8 * time.Second)
+
+		if deadline, _ := ctx.Deadline(); clk.Until(deadline) != 4*time.Second {
+			t.Fatalf("clk.Until(deadline) = %v, want %v", clk.Until(deadline), 4*time.Second)
+		}
+
+		clk.Advance(4 * time.Second)
+
+		<-ctx.Done()
+
+		if got, want := ctx.Err(), context.DeadlineExceeded; got != want {
+			t.Fatalf("ctx.Err() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("child", func(t *testing.T) {
+		clk := newFakeClock()
+
+		ctx, cancel := withTimeout(context.Background(), clk, time.Second)
+		defer cancel()
+
+		child, cancelChild := context.WithCancel(ctx)
+		defer cancelChild()
+
+		clk.Advance(time.Second)
+
+		<-child.Done()
+
+		if got, want := child.Err(), context.DeadlineExceeded; got != want {
+			t.Fatalf("child.Err() = %v, want %v", got, want)
+		}
+	})
+}
+
+// fakeClock is a Clock that only moves when advanced
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2017, 6, 19, 16, 35, 28, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Until(t time.Time) time.Duration {
+	return t.Sub(c.Now())
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ft := &fakeTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1)}
+
+	if d <= 0 {
+		ft.c <- c.now
+		return ft
+	}
+
+	c.timers = append(c.timers, ft)
+
+	return ft
+}
+
+// Advance moves the clock forward, firing any timers that expire
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var pending []*fakeTimer
+
+	for _, ft := range c.timers {
+		if ft.when.After(c.now) {
+			pending = append(pending, ft)
+			continue
+		}
+
+		ft.c <- c.now
+	}
+
+	c.timers = pending
+}
+
+// WaitForTimers blocks until at least n timers are waiting to fire
+func (c *fakeClock) WaitForTimers(n int) {
+	for {
+		c.mu.Lock()
+		waiting := len(c.timers)
+		c.mu.Unlock()
+
+		if waiting >= n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+}
+
+func (ft *fakeTimer) C() <-chan time.Time { return ft.c }
+
+func (ft *fakeTimer) Stop() bool {
+	ft.clock.mu.Lock()
+	defer ft.clock.mu.Unlock()
+
+	for i, t := range ft.clock.timers {
+		if t == ft {
+			ft.clock.timers = append(ft.clock.timers[:i], ft.clock.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,290 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnStates are numbers of connections in each state. Hijacked connections
+// are counted until they are closed at the deadline of the drain, as the
+// server is not told when a hijacked connection is closed.
+type ConnStates struct {
+	New      int
+	Active   int
+	Idle     int
+	Hijacked int
+}
+
+// add adds n to the count of connections in state
+func (cs *ConnStates) add(state http.ConnState, n int) {
+	switch state {
+	case http.StateNew:
+		cs.New += n
+	case http.StateActive:
+		cs.Active += n
+	case http.StateIdle:
+		cs.Idle += n
+	case http.StateHijacked:
+		cs.Hijacked += n
+	}
+}
+
+var (
+	connCountsMu sync.Mutex
+	connCounts   ConnStates
+)
+
+// ConnCounts returns the numbers of connections, in each state, of all the
+// *http.Server servers run by an Instance
+func ConnCounts() ConnStates {
+	connCountsMu.Lock()
+	defer connCountsMu.Unlock()
+
+	return connCounts
+}
+
+// addConnCount adds n to the package level count of connections in state
+func addConnCount(state http.ConnState, n int) {
+	connCountsMu.Lock()
+	connCounts.add(state, n)
+	connCountsMu.Unlock()
+}
+
+// connTracker counts the connections of an *http.Server in each state
+type connTracker struct {
+	mu       sync.Mutex
+	states   map[net.Conn]http.ConnState
+	hijacked map[net.Conn]bool
+	counts   ConnStates
+
+	// requests are the requests being served, if WithSlowRequests is used
+	requests *requestTracker
+
+	// cancels cancel the base contexts of the requests, see useBaseContext
+	cancelMu sync.Mutex
+	cancels  []context.CancelFunc
+
+	// changed is closed, and replaced, whenever a connection changes state
+	changed chan struct{}
+
+	// closed is closed once Shutdown has closed the listeners
+	closed     chan struct{}
+	closedOnce sync.Once
+}
+
+// track wraps the ConnState hook of hs to count its connections,
+// calling the hook already set, if any, once they have been counted
+func (ct *connTracker) track(hs *http.Server) {
+	ct.states = map[net.Conn]http.ConnState{}
+	ct.hijacked = map[net.Conn]bool{}
+	ct.changed = make(chan struct{})
+	ct.closed = make(chan struct{})
+
+	hs.RegisterOnShutdown(func() {
+		ct.closedOnce.Do(func() { close(ct.closed) })
+	})
+
+	next := hs.ConnState
+
+	hs.ConnState = func(c net.Conn, state http.ConnState) {
+		ct.mu.Lock()
+
+		if prev, ok := ct.states[c]; ok {
+			ct.counts.add(prev, -1)
+			addConnCount(prev, -1)
+		}
+
+		switch state {
+		case http.StateClosed:
+			delete(ct.states, c)
+		case http.StateHijacked:
+			delete(ct.states, c)
+			ct.hijacked[c] = true
+		default:
+			ct.states[c] = state
+		}
+
+		ct.counts.add(state, 1)
+		addConnCount(state, 1)
+
+		close(ct.changed)
+		ct.changed = make(chan struct{})
+
+		ct.mu.Unlock()
+
+		if next != nil {
+			next(c, state)
+		}
+	}
+}
+
+// count returns the number of connections in each state
+func (ct *connTracker) count() ConnStates {
+	if ct == nil {
+		return ConnStates{}
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return ct.counts
+}
+
+// open returns the number of connections that are open,
+// not counting hijacked ones
+func (ct *connTracker) open() int {
+	if ct == nil {
+		return 0
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return len(ct.states)
+}
+
+// cutHijacked closes the hijacked connections, returning how many of them
+// were still open
+func (ct *connTracker) cutHijacked() int {
+	if ct == nil {
+		return 0
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	cut := 0
+
+	for c := range ct.hijacked {
+		if c.Close() == nil {
+			cut++
+		}
+
+		delete(ct.hijacked, c)
+		ct.counts.Hijacked--
+		addConnCount(http.StateHijacked, -1)
+	}
+
+	return cut
+}
+
+// closeIdle closes the connections that are idle,
+// returning how many of them were closed
+func (ct *connTracker) closeIdle() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	closed := 0
+
+	for c, state := range ct.states {
+		if state == http.StateIdle && c.Close() == nil {
+			closed++
+		}
+	}
+
+	return closed
+}
+
+// idle returns a channel that is closed once the listeners have been closed
+// and every open connection is idle, or ctx is done
+func (ct *connTracker) idle(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case <-ct.closed:
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			ct.mu.Lock()
+			quiet := ct.counts.New == 0 && ct.counts.Active == 0
+			changed := ct.changed
+			ct.mu.Unlock()
+
+			if quiet {
+				return
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// earlyDrain shuts down an *http.Server, returning once all of its
+// connections are idle, instead of waiting for Shutdown to close them
+type earlyDrain struct {
+	hs *http.Server
+	ct *connTracker
+}
+
+func (ed earlyDrain) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- ed.hs.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ed.ct.idle(ctx):
+	}
+
+	// Shutdown may have returned meanwhile, with ctx done
+	select {
+	case err := <-done:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// sweepIdle closes the idle connections of the server of m every interval
+// set by WithIdleSweep, until ctx is done or the returned function is called
+func (i *Instance) sweepIdle(ctx context.Context, m *member) func() {
+	interval := i.cfg.idleSweep
+
+	if interval <= 0 || m.conns == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			t := i.clock().NewTimer(interval)
+
+			select {
+			case <-t.C():
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+
+			if n := m.conns.closeIdle(); n > 0 {
+				i.swept.Add(int64(n))
+				i.emit(Event{Kind: SweptEvent, Phase: DrainPhase, Server: m.name, Count: n})
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,336 @@
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnTracker(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	var (
+		mu     sync.Mutex
+		seen   []ConnStates
+		closed = make(chan struct{})
+	)
+
+	ct := &connTracker{}
+
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+		ConnState: func(c net.Conn, state http.ConnState) {
+			mu.Lock()
+			seen = append(seen, ct.count())
+			mu.Unlock()
+
+			if state == http.StateClosed {
+				close(closed)
+			}
+		},
+	}
+
+	ct.track(hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+		if resp, err := client.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+
+	if got, want := ct.count(), (ConnStates{Active: 1}); got != want {
+		t.Fatalf("ct.count() = %+v, want %+v", got, want)
+	}
+
+	close(release)
+	<-done
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("the connection was not closed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The hook already set is called once the counts have been updated
+	if len(seen) < 2 || seen[0] != (ConnStates{New: 1}) || seen[1] != (ConnStates{Active: 1}) {
+		t.Fatalf("the ConnState hook saw %+v, want the counts of the new, then active, connection", seen)
+	}
+
+	if got := seen[len(seen)-1]; got != (ConnStates{}) {
+		t.Fatalf("the ConnState hook saw %+v once closed, want no connections", got)
+	}
+}
+
+func TestConnTrackerHijacked(t *testing.T) {
+	hijacked := make(chan struct{})
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		io.WriteString(c, "hijacked\n")
+		close(hijacked)
+	})}
+
+	ct := &connTracker{}
+	ct.track(hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	before := ConnCounts().Hijacked
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: graceful\r\n\r\n")
+
+	r := bufio.NewReader(c)
+
+	if line, err := r.ReadString('\n'); err != nil || line != "hijacked\n" {
+		t.Fatalf("ReadString() = %q, %v, want %q", line, err, "hijacked\n")
+	}
+
+	<-hijacked
+
+	if got, want := ct.count(), (ConnStates{Hijacked: 1}); got != want {
+		t.Fatalf("ct.count() = %+v, want %+v", got, want)
+	}
+
+	if got, want := ct.open(), 0; got != want {
+		t.Fatalf("ct.open() = %d, want %d", got, want)
+	}
+
+	if got, want := ConnCounts().Hijacked, before+1; got != want {
+		t.Fatalf("ConnCounts().Hijacked = %d, want %d", got, want)
+	}
+
+	if got, want := ct.cutHijacked(), 1; got != want {
+		t.Fatalf("ct.cutHijacked() = %d, want %d", got, want)
+	}
+
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("ReadByte() = %v once cut, want %v", err, io.EOF)
+	}
+
+	if got, want := ct.count(), (ConnStates{}); got != want {
+		t.Fatalf("ct.count() = %+v once cut, want %+v", got, want)
+	}
+
+	if got, want := ConnCounts().Hijacked, before; got != want {
+		t.Fatalf("ConnCounts().Hijacked = %d once cut, want %d", got, want)
+	}
+}
+
+func TestEarlyDrain(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ct := &connTracker{}
+	ct.track(hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	// Keep-alives leave the connection idle once the request is done
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() { errs <- (earlyDrain{hs, ct}).Shutdown(ctx) }()
+
+	close(release)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("Shutdown() = %v, want nil", err)
+	}
+
+	<-done
+}
+
+func TestConnTrackerIdle(t *testing.T) {
+	hs := &http.Server{}
+
+	ct := &connTracker{}
+	ct.track(hs)
+
+	// A connection the server does not know of, so that only the tracker,
+	// and not the polling of Shutdown, sees it turn idle
+	c, peer := net.Pipe()
+	defer peer.Close()
+	defer c.Close()
+
+	hs.ConnState(c, http.StateNew)
+	hs.ConnState(c, http.StateActive)
+	defer hs.ConnState(c, http.StateClosed)
+
+	idle := ct.idle(context.Background())
+
+	if err := hs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	<-ct.closed
+
+	select {
+	case <-idle:
+		t.Fatalf("ct.idle() was closed with the connection active")
+	default:
+	}
+
+	hs.ConnState(c, http.StateIdle)
+
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatalf("ct.idle() was not closed once the connection was idle")
+	}
+}
+
+func TestEarlyDrainDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ct := &connTracker{}
+	ct.track(hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := (earlyDrain{hs, ct}).Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSweepIdle(t *testing.T) {
+	clk := newFakeClock()
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+
+	ct := &connTracker{}
+	ct.track(hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	// Keep-alives leave the connection idle once the request is done
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for ct.count().Idle == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	events := make(chan Event, 1)
+
+	i := newInstance(hs, nil, WithClock(clk), WithIdleSweep(10*time.Millisecond), WithEventHandler(func(e Event) {
+		events <- e
+	}))
+
+	stop := i.sweepIdle(context.Background(), &member{name: "api", conns: ct})
+	defer stop()
+
+	clk.WaitForTimers(1)
+	clk.Advance(10 * time.Millisecond)
+
+	select {
+	case e := <-events:
+		if got, want := e.String(), "Closed 1 idle connections"; got != want || e.Server != "api" {
+			t.Fatalf("e.String() = %q for %q, want %q for %q", got, e.Server, want, "api")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the idle connection was not swept")
+	}
+
+	if got, want := i.swept.Load(), int64(1); got != want {
+		t.Fatalf("i.swept = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package graceful
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// contextKey is the type of the context keys set by the package
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string { return "graceful context value " + k.name }
+
+var (
+	// PhaseContextKey is the context key of the Phase that a Shutdowner,
+	// or the function set by WithDeregister, was called in
+	PhaseContextKey = &contextKey{"phase"}
+
+	// BudgetContextKey is the context key of the total time.Duration
+	// given to the shutdown, which is the Timeout at the time it began
+	BudgetContextKey = &contextKey{"budget"}
+)
+
+// Remaining returns the time left until the deadline of ctx, measured by
+// the clock the deadlines of the contexts passed to Shutdowners are set by,
+// that set by WithClock or DefaultClock. It never increases between calls,
+// and is zero once the deadline has passed. The bool is false if ctx has no
+// deadline.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	if d := contextClock(ctx).Until(deadline); d > 0 {
+		return d, true
+	}
+
+	return 0, true
+}
+
+// Context returns a context that is canceled once a shutdown signal, the
+// same ones an Instance shuts down on, is received, for programs that do
+// not run a server, such as workers and command line tools. The signal is
+// logged, and stop cancels the context and stops relaying signals.
+//
+// Once the context is canceled, another signal has its default effect, such
+// as ending the process on os.Interrupt, unless WithHardDeadline is used, in
+// which case the process is exited with HardDeadlineExitCode if stop is not
+// called in time, and WithSignalEscalation makes every further signal
+// shorten what is left of it. The logging, signal, clock and event handler
+// options are also honored, the others are ignored.
+//
+//	ctx, stop := graceful.Context(context.Background(), graceful.WithHardDeadline(30*time.Second))
+//	defer stop()
+//
+//	err := worker.Run(ctx)
+func Context(parent context.Context, opts ...Option) (ctx context.Context, stop func()) {
+	i := &Instance{}
+
+	for _, opt := range opts {
+		opt(&i.cfg)
+	}
+
+	signals, stopSignals := i.notify()
+
+	ctx, cancel := context.WithCancel(parent)
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		select {
+		case sig := <-signals:
+			i.emit(Event{Kind: SignalEvent, Source: sig.String()})
+			cancel()
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		}
+
+		if i.cfg.hardDeadline <= 0 || i.cfg.escalation == nil {
+			stopSignals()
+		}
+
+		if i.cfg.hardDeadline > 0 {
+			i.exitAfter(signals, done)
+		}
+	}()
+
+	var once sync.Once
+
+	return ctx, func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+			stopSignals()
+			cancel()
+		})
+	}
+}
+
+// exitAfter exits the process once the deadline set by WithHardDeadline has
+// passed, shortened by the signals received on signals if WithSignalEscalation
+// is used, unless done is closed first
+func (i *Instance) exitAfter(signals <-chan os.Signal, done <-chan struct{}) {
+	start := i.clock().Now()
+
+	hard, cancel := withClockTimeout(context.Background(), i.clock(), i.cfg.hardDeadline)
+	defer cancel()
+
+	if i.cfg.escalation != nil {
+		defer i.escalate(hard, signals)()
+	}
+
+	select {
+	case <-hard.Done():
+	case <-done:
+		return
+	}
+
+	i.emit(Event{Kind: HardDeadlineEvent, Timeout: i.cfg.hardDeadline, Duration: i.clock().Now().Sub(start)})
+	i.flush()
+
+	exit(HardDeadlineExitCode)
+}
@@ -0,0 +1,185 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemaining(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) {
+		if _, ok := Remaining(context.Background()); ok {
+			t.Fatalf("Remaining(context.Background()) returned a deadline")
+		}
+	})
+
+	t.Run("counts down", func(t *testing.T) {
+		clk := newFakeClock()
+
+		ctx, cancel := withTimeout(context.Background(), clk, 10*time.Second)
+		defer cancel()
+
+		for _, tc := range []struct {
+			advance time.Duration
+			want    time.Duration
+		}{
+			{0, 10 * time.Second},
+			{3 * time.Second, 7 * time.Second},
+			{7 * time.Second, 0},
+			{time.Second, 0},
+		} {
+			clk.Advance(tc.advance)
+
+			if got, _ := Remaining(ctx); got != tc.want {
+				t.Fatalf("Remaining(ctx) = %v, want %v", got, tc.want)
+			}
+		}
+	})
+
+	t.Run("phases", func(t *testing.T) {
+		clk := newFakeClock()
+
+		type seen struct {
+			phase     interface{}
+			budget    interface{}
+			remaining time.Duration
+		}
+
+		var got []seen
+
+		record := func(ctx context.Context) error {
+			left, _ := Remaining(ctx)
+
+			got = append(got, seen{ctx.Value(PhaseContextKey), ctx.Value(BudgetContextKey), left})
+
+			clk.Advance(time.Second)
+
+			return nil
+		}
+
+		r := &Registry{}
+		r.Register("db", shutdownFunc(record))
+
+		i := newInstance(&http.Server{Handler: shutdownFunc(record)}, nil,
+			WithClock(clk), WithRegistry(r), WithDeregister(record, 5*time.Second))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		want := []seen{
+			{DeregisterPhase, Timeout, 5 * time.Second},
+			{HandlerPhase, Timeout, Timeout - time.Second},
+			{CleanupPhase, Timeout, Timeout - 2*time.Second},
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("got %d calls, want %d", len(got), len(want))
+		}
+
+		for n := range want {
+			if got[n] != want[n] {
+				t.Fatalf("call %d = %+v, want %+v", n, got[n], want[n])
+			}
+		}
+	})
+}
+
+func TestContext(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		signals := make(chan os.Signal, 1)
+
+		ctx, stop := Context(context.Background(), WithSignals(signals), WithLogger(log.New(&buf, "", 0)))
+		defer stop()
+
+		signals <- os.Interrupt
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("the context was not canceled by the signal")
+		}
+
+		if got, want := buf.String(), "Received signal interrupt\n"; got != want {
+			t.Fatalf("logged %q, want %q", got, want)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		ctx, stop := Context(context.Background(), WithSignals(make(chan os.Signal)), WithLogger(log.New(&buf, "", 0)))
+
+		stop()
+		stop()
+
+		if ctx.Err() != context.Canceled {
+			t.Fatalf("ctx.Err() = %v, want %v", ctx.Err(), context.Canceled)
+		}
+
+		if buf.Len() != 0 {
+			t.Fatalf("logged %q, want nothing", buf.String())
+		}
+	})
+
+	t.Run("hard deadline", func(t *testing.T) {
+		clk := newFakeClock()
+		codes := useFakeExit(t)
+
+		var buf bytes.Buffer
+
+		signals := make(chan os.Signal, 1)
+
+		ctx, stop := Context(context.Background(), WithClock(clk), WithSignals(signals), WithHardDeadline(10*time.Second), WithLogger(log.New(&buf, "", 0)))
+		defer stop()
+
+		signals <- os.Interrupt
+		<-ctx.Done()
+
+		clk.WaitForTimers(1)
+		clk.Advance(10 * time.Second)
+
+		select {
+		case code := <-codes:
+			if code != HardDeadlineExitCode {
+				t.Fatalf("exited with %d, want %d", code, HardDeadlineExitCode)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("the process was not exited at the hard deadline")
+		}
+
+		if want := "Hard deadline of 10s exceeded after 10s, exiting\n"; !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+			t.Fatalf("logged %q, want it to end with %q", buf.String(), want)
+		}
+	})
+
+	t.Run("escalation", func(t *testing.T) {
+		codes := useFakeExit(t)
+
+		signals := make(chan os.Signal, 1)
+
+		ctx, stop := Context(context.Background(), WithClock(newFakeClock()), WithSignals(signals), WithHardDeadline(5*time.Second),
+			WithSignalEscalation(SubtractRemaining(5*time.Second)), WithLogger(log.New(&bytes.Buffer{}, "", 0)))
+		defer stop()
+
+		signals <- os.Interrupt
+		<-ctx.Done()
+
+		signals <- os.Interrupt
+
+		select {
+		case code := <-codes:
+			if code != HardDeadlineExitCode {
+				t.Fatalf("exited with %d, want %d", code, HardDeadlineExitCode)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("the process was not exited on the second signal")
+		}
+	})
+}
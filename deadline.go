@@ -0,0 +1,126 @@
+package graceful
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// HardDeadlineExitCode is the exit code used when the shutdown
+// outlasts the deadline set by WithHardDeadline
+var HardDeadlineExitCode = 3
+
+// HardDeadlineGrace is the time given to closing the servers, and logging
+// that the hard deadline was exceeded, before exiting regardless, such as when
+// an event handler is stuck
+var HardDeadlineGrace = time.Second
+
+// exit is called when the hard deadline is exceeded, replaced in tests
+var exit = os.Exit
+
+// watchdog starts the timer set by WithHardDeadline, measured from when the
+// Instance was told to shut down, and returns a function that stops it. Once
+// stop has returned exit is not called, even if the timer fired just before
+func (i *Instance) watchdog(ms []*member) (stop func()) {
+	if i.cfg.hardDeadline <= 0 {
+		return func() {}
+	}
+
+	signaled := i.signaled
+	if signaled.IsZero() {
+		signaled = i.clock().Now()
+	}
+
+	timer := i.clock().NewTimer(i.cfg.hardDeadline - i.clock().Now().Sub(signaled))
+	w := &watch{done: make(chan struct{})}
+
+	go func() {
+		select {
+		case <-timer.C():
+			i.hardDeadlineExceeded(ms, signaled, w)
+		case <-w.done:
+		}
+	}()
+
+	return func() {
+		timer.Stop()
+
+		w.mu.Lock()
+		close(w.done)
+		w.mu.Unlock()
+	}
+}
+
+// watch is the state shared by a watchdog and its stop function
+type watch struct {
+	mu   sync.Mutex
+	done chan struct{} // closed by stop, under mu
+}
+
+// exit calls exit with code, unless the watchdog was stopped
+func (w *watch) exit(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	default:
+		exit(code)
+	}
+}
+
+// hardDeadlineExceeded closes the servers, abandoning whatever is still
+// shutting down, logs it, waiting at most HardDeadlineGrace, and exits unless
+// the shutdown completed meanwhile
+func (i *Instance) hardDeadlineExceeded(ms []*member, signaled time.Time, w *watch) {
+	exceeded := i.clock().Now().Sub(signaled)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for _, m := range ms {
+			if c, ok := m.server.(io.Closer); ok {
+				c.Close()
+			}
+		}
+
+		i.emit(Event{Kind: HardDeadlineEvent, Timeout: i.cfg.hardDeadline, Duration: exceeded})
+
+		i.flush()
+	}()
+
+	t := i.clock().NewTimer(HardDeadlineGrace)
+
+	select {
+	case <-done:
+	case <-t.C():
+	}
+
+	t.Stop()
+
+	w.exit(HardDeadlineExitCode)
+}
+
+// flush syncs the files written to by the loggers, or by WithJSONLogging,
+// if they have a Sync method, as *os.File does
+func (i *Instance) flush() {
+	ws := []interface{}{i.logger()}
+
+	if i.cfg.json != nil {
+		ws = []interface{}{i.cfg.json.w}
+	} else if i.cfg.errorLogger != nil {
+		ws = append(ws, i.cfg.errorLogger)
+	}
+
+	for _, w := range ws {
+		if l, ok := w.(interface{ Writer() io.Writer }); ok {
+			w = l.Writer()
+		}
+
+		if s, ok := w.(interface{ Sync() error }); ok {
+			s.Sync()
+		}
+	}
+}
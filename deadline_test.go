@@ -0,0 +1,219 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHardDeadline(t *testing.T) {
+	t.Run("exceeded", func(t *testing.T) {
+		clk := newFakeClock()
+		exited := useFakeExit(t)
+
+		var buf bytes.Buffer
+
+		release := make(chan struct{})
+
+		s := &closingServer{closed: make(chan struct{})}
+		s.shutdown = func(ctx context.Context) error {
+			clk.Advance(10 * time.Second)
+			<-release
+			return nil
+		}
+
+		i := newInstance(s, nil, WithLogger(log.New(&buf, "", 0)), WithHardDeadline(10*time.Second), WithClock(clk))
+
+		done := make(chan error)
+		go func() { done <- i.shutdown() }()
+
+		// The shutdown goes on in tests, as exit does not exit
+		defer func() {
+			close(release)
+			<-done
+		}()
+
+		if got, want := <-exited, HardDeadlineExitCode; got != want {
+			t.Fatalf("exit code = %d, want %d", got, want)
+		}
+
+		select {
+		case <-s.closed:
+		default:
+			t.Fatalf("server was not closed")
+		}
+
+		if got, want := buf.String(), fmt.Sprintf(HardDeadlineFormat, 10*time.Second, 10*time.Second); !strings.HasSuffix(got, want) {
+			t.Fatalf("buf.String() = %q, want suffix %q", got, want)
+		}
+	})
+
+	t.Run("measured from signal", func(t *testing.T) {
+		clk := newFakeClock()
+		exited := useFakeExit(t)
+
+		release := make(chan struct{})
+
+		var events []Event
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(4 * time.Second)
+			<-release
+			return nil
+		}), nil, WithHardDeadline(10*time.Second), WithEventHandler(func(e Event) {
+			events = append(events, e)
+		}), WithClock(clk))
+
+		i.signaled = clk.Now()
+		clk.Advance(6 * time.Second)
+
+		done := make(chan error)
+		go func() { done <- i.shutdown() }()
+
+		defer func() {
+			close(release)
+			<-done
+		}()
+
+		<-exited
+
+		if e := events[len(events)-1]; e.Kind != HardDeadlineEvent || e.Duration != 10*time.Second {
+			t.Fatalf("last event = %+v, want %s after 10s", e, HardDeadlineEvent)
+		}
+	})
+
+	t.Run("stuck event handler", func(t *testing.T) {
+		clk := newFakeClock()
+		exited := useFakeExit(t)
+
+		stuck, release, logged := make(chan struct{}), make(chan struct{}), make(chan struct{})
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			return nil
+		}), nil, WithShutdownTimeout(5*time.Second), WithHardDeadline(10*time.Second), WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ShutdownEvent:
+				close(stuck)
+				<-release
+			case HardDeadlineEvent:
+				close(logged)
+			}
+		}), WithClock(clk))
+
+		done := make(chan error)
+		go func() { done <- i.shutdown() }()
+
+		// The event is emitted once the handler is no longer stuck
+		defer func() {
+			close(release)
+			<-done
+			<-logged
+		}()
+
+		<-stuck
+
+		clk.Advance(10 * time.Second)
+		clk.WaitForTimers(1)
+		clk.Advance(HardDeadlineGrace)
+
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatalf("did not exit while an event handler was stuck")
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		clk := newFakeClock()
+		exited := useFakeExit(t)
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			return nil
+		}), nil, WithHardDeadline(10*time.Second), WithClock(clk))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		clk.Advance(time.Minute)
+
+		select {
+		case code := <-exited:
+			t.Fatalf("exited with %d after shutting down", code)
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("completed while exceeded", func(t *testing.T) {
+		clk := newFakeClock()
+		exited := useFakeExit(t)
+
+		release, logged := make(chan struct{}), make(chan struct{})
+
+		s := &closingServer{closed: make(chan struct{}), release: release}
+		s.shutdown = func(ctx context.Context) error {
+			clk.Advance(10 * time.Second)
+			<-s.closed
+			return nil
+		}
+
+		i := newInstance(s, nil, WithHardDeadline(10*time.Second), WithEventHandler(func(e Event) {
+			if e.Kind == HardDeadlineEvent {
+				close(logged)
+			}
+		}), WithClock(clk))
+
+		// The timer has fired, and the servers are being closed, when the
+		// shutdown completes
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		close(release)
+		<-logged
+
+		select {
+		case code := <-exited:
+			t.Fatalf("exited with %d after shutting down", code)
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+}
+
+// closingServer is a Shutdowner that can also be closed, Close waiting for
+// release when it is set
+type closingServer struct {
+	shutdown func(ctx context.Context) error
+	closed   chan struct{}
+	release  chan struct{}
+}
+
+func (s *closingServer) Shutdown(ctx context.Context) error { return s.shutdown(ctx) }
+
+func (s *closingServer) Close() error {
+	close(s.closed)
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	return nil
+}
+
+// useFakeExit replaces exit, returning a channel receiving the exit codes
+func useFakeExit(t *testing.T) <-chan int {
+	t.Helper()
+
+	codes := make(chan int, 1)
+
+	prev := exit
+	exit = func(code int) { codes <- code }
+
+	t.Cleanup(func() { exit = prev })
+
+	return codes
+}
@@ -0,0 +1,169 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Drainer is implemented by work queues, such as background job runners,
+// that are drained once the servers have drained
+type Drainer interface {
+	// StopIntake makes the queue stop accepting work
+	StopIntake()
+
+	// Drain finishes the queued work, returning how much of it
+	// remained once ctx was done
+	Drain(ctx context.Context) (remaining int, err error)
+}
+
+type drainer struct {
+	name string
+	d    Drainer
+}
+
+// RegisterDrainer adds d to the DefaultRegistry
+func RegisterDrainer(name string, d Drainer) error {
+	return DefaultRegistry.RegisterDrainer(name, d)
+}
+
+// RegisterDrainer adds d to the registry, to be drained, concurrently with
+// the other Drainers, once the servers and their handlers have shut down,
+// and before the Shutdowners in the registry, returning ErrRegistryClosed
+// once an Instance has begun shutting it down
+func (r *Registry) RegisterDrainer(name string, d Drainer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRegistryClosed
+	}
+
+	r.drainers = append(r.drainers, &drainer{name: name, d: d})
+
+	return nil
+}
+
+func (r *Registry) drainerSnapshot() []*drainer {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*drainer(nil), r.drainers...)
+}
+
+// DrainerGrace is the time a Drainer is given to return how much work
+// remained once the deadline has passed, before it is abandoned
+var DrainerGrace = 100 * time.Millisecond
+
+// DrainerReport is the time given to, and taken by, one of the Drainers
+// in a Registry, and the work that remained
+type DrainerReport struct {
+	ComponentReport
+	Remaining int
+}
+
+// drainQueues stops the intake of the Drainers in reg, and then drains
+// them concurrently, returning their reports and errors joined
+func (i *Instance) drainQueues(ctx context.Context, reg *Registry) ([]DrainerReport, error) {
+	ds := reg.drainerSnapshot()
+
+	if len(ds) == 0 {
+		return nil, nil
+	}
+
+	stopped := make([]error, len(ds))
+
+	for n, d := range ds {
+		stopped[n] = safely(func() error { d.d.StopIntake(); return nil })
+	}
+
+	timeout, ok := Remaining(ctx)
+	if !ok {
+		timeout = i.shutdownTimeout()
+	}
+
+	var (
+		wg      sync.WaitGroup
+		reports = make([]DrainerReport, len(ds))
+		errs    = make([]error, len(ds))
+	)
+
+	for n, d := range ds {
+		wg.Add(1)
+
+		go func(n int, d *drainer) {
+			defer wg.Done()
+
+			start := i.clock().Now()
+
+			left, err := i.drainQueue(ctx, d)
+			if err == nil {
+				err = stopped[n]
+			}
+
+			finished := i.clock().Now()
+
+			err = phaseError(DrainersPhase, d.name, err)
+			if err != nil {
+				i.emit(Event{Kind: ErrorEvent, Phase: DrainersPhase, Name: d.name, Err: err})
+			}
+
+			i.emit(Event{Kind: DrainerEvent, Phase: DrainersPhase, Name: d.name,
+				Timeout: timeout, Duration: finished.Sub(start), Count: left, Err: err})
+
+			reports[n] = DrainerReport{ComponentReport{Name: d.name, Timeout: timeout,
+				Started: start, Finished: finished, Duration: finished.Sub(start), Err: err}, left}
+			errs[n] = err
+		}(n, d)
+	}
+
+	wg.Wait()
+
+	return reports, joinErrors(errs...)
+}
+
+// drainQueue drains d, waiting at most DrainerGrace for it once ctx is done
+func (i *Instance) drainQueue(ctx context.Context, d *drainer) (int, error) {
+	type result struct {
+		remaining int
+		err       error
+	}
+
+	// Buffered so that an abandoned Drainer can still finish
+	done := make(chan result, 1)
+
+	go func() {
+		var remaining int
+
+		err := safely(func() (err error) {
+			remaining, err = d.d.Drain(context.WithValue(ctx, PhaseContextKey, DrainersPhase))
+			return err
+		})
+
+		done <- result{remaining, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.remaining, r.err
+	case <-ctx.Done():
+	}
+
+	t := i.clock().NewTimer(DrainerGrace)
+	defer t.Stop()
+
+	select {
+	case r := <-done:
+		return r.remaining, r.err
+	case <-t.C():
+	}
+
+	i.emit(Event{Kind: AbandonedEvent, Phase: DrainersPhase, Shutdowner: fmt.Sprintf("%T", d.d)})
+
+	return 0, ctx.Err()
+}
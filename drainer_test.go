@@ -0,0 +1,85 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testDrainer struct {
+	name  string
+	mu    *sync.Mutex
+	calls *[]string
+	drain func(ctx context.Context) (int, error)
+}
+
+func (d testDrainer) StopIntake() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	*d.calls = append(*d.calls, "stop "+d.name)
+}
+
+func (d testDrainer) Drain(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	*d.calls = append(*d.calls, "drain "+d.name)
+	d.mu.Unlock()
+
+	return d.drain(ctx)
+}
+
+func TestRegistryRegisterDrainer(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		mu    sync.Mutex
+		calls []string
+	)
+
+	r := &Registry{}
+
+	r.RegisterDrainer("mail", testDrainer{"mail", &mu, &calls, func(ctx context.Context) (int, error) {
+		return 0, nil
+	}})
+
+	r.RegisterDrainer("jobs", testDrainer{"jobs", &mu, &calls, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 3, ctx.Err()
+	}})
+
+	i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r),
+		WithShutdownTimeout(50*time.Millisecond))
+
+	if err := i.shutdown(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("i.shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Every intake is stopped before the queues are drained
+	if len(calls) != 4 || calls[0] != "stop mail" || calls[1] != "stop jobs" {
+		t.Fatalf("calls = %q, want both intakes stopped before draining", calls)
+	}
+
+	rep := i.Report()
+
+	if got, want := rep.Remaining, 3; got != want {
+		t.Fatalf("rep.Remaining = %d, want %d", got, want)
+	}
+
+	if len(rep.Drainers) != 2 || rep.Drainers[0].Name != "mail" || rep.Drainers[1].Remaining != 3 || rep.Drainers[1].Err == nil {
+		t.Fatalf("rep.Drainers = %+v, want mail drained and jobs left with 3", rep.Drainers)
+	}
+
+	var pe *PhaseError
+	if !errors.As(rep.Drainers[1].Err, &pe) || pe.Phase != DrainersPhase {
+		t.Fatalf("rep.Drainers[1].Err = %v, want a %q PhaseError", rep.Drainers[1].Err, DrainersPhase)
+	}
+
+	if !strings.Contains(buf.String(), ", 3 remaining\n") {
+		t.Fatalf("log = %q, want the remaining jobs logged", buf.String())
+	}
+}
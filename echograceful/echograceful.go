@@ -0,0 +1,43 @@
+// Package echograceful adapts an *echo.Echo to the graceful.Server interface.
+//
+//	e := echo.New()
+//	e.GET("/", hello)
+//
+//	graceful.New(echograceful.Wrap(e, ":8080")).Run(ctx)
+//
+// It is a module of its own, so that using graceful does not
+// add a dependency on echo.
+package echograceful
+
+import (
+	"context"
+
+	graceful "github.com/TV4/graceful"
+	"github.com/labstack/echo/v4"
+)
+
+// Wrap returns a graceful.Server that starts e on addr,
+// and drains it using e.Shutdown
+func Wrap(e *echo.Echo, addr string) graceful.Server {
+	return &server{e: e, addr: addr}
+}
+
+type server struct {
+	e    *echo.Echo
+	addr string
+}
+
+// ListenAndServe starts the server, returning http.ErrServerClosed once it
+// has been shut down, as e.Start does
+func (s *server) ListenAndServe() error {
+	return s.e.Start(s.addr)
+}
+
+func (s *server) Shutdown(ctx context.Context) error {
+	return s.e.Shutdown(ctx)
+}
+
+// ListenAddr returns the address the server listens on, for logging
+func (s *server) ListenAddr() (network, address string) {
+	return "tcp", s.addr
+}
@@ -0,0 +1,84 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// DefaultAddr is the address used by ListenAndServeDefault
+// when neither HOST nor PORT are set
+var DefaultAddr = ":8080"
+
+// ListenAndServeDefault serves h on the address returned by AddrFromEnv
+func ListenAndServeDefault(h http.Handler, opts ...Option) {
+	hs := &http.Server{Handler: h}
+
+	i := New(hs, append([]Option{WithLogger(logger), withFatal()}, opts...)...)
+	i.useEnvAddr(hs)
+
+	i.Run(context.Background())
+}
+
+// useEnvAddr makes Run set the address of hs to the one returned by
+// AddrFromEnv, before anything else
+func (i *Instance) useEnvAddr(hs *http.Server) {
+	i.starters = append([]func(context.Context) error{func(context.Context) error {
+		addr, source, err := addrFromEnv()
+		if err != nil {
+			return err
+		}
+
+		hs.Addr = addr
+
+		i.emit(Event{Kind: AddrEvent, Phase: ServePhase, Addr: addr, Source: source})
+
+		return nil
+	}}, i.starters...)
+}
+
+// AddrFromEnv returns the address to listen on, built from the HOST and PORT
+// environment variables, as set by most hosting platforms. DefaultAddr is
+// returned if neither of them are set, and its port is used if only HOST is.
+func AddrFromEnv() (string, error) {
+	addr, _, err := addrFromEnv()
+
+	return addr, err
+}
+
+// addrFromEnv returns the address, and a description of where it came from
+func addrFromEnv() (string, string, error) {
+	host, hasHost := os.LookupEnv("HOST")
+	port, hasPort := os.LookupEnv("PORT")
+
+	if _, _, err := net.SplitHostPort(host); hasHost && err == nil {
+		return "", "", fmt.Errorf("graceful: invalid HOST %q: must not include a port", host)
+	}
+
+	if hasPort {
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return "", "", fmt.Errorf("graceful: invalid PORT %q: must be a number between 0 and 65535", port)
+		}
+	}
+
+	switch {
+	case hasHost && hasPort:
+		return net.JoinHostPort(host, port), "HOST and PORT", nil
+	case hasPort:
+		return net.JoinHostPort("", port), "PORT", nil
+	}
+
+	_, defaultPort, err := net.SplitHostPort(DefaultAddr)
+	if err != nil {
+		return "", "", fmt.Errorf("graceful: invalid DefaultAddr %q: %v", DefaultAddr, err)
+	}
+
+	if hasHost {
+		return net.JoinHostPort(host, defaultPort), "HOST", nil
+	}
+
+	return DefaultAddr, "default", nil
+}
@@ -0,0 +1,71 @@
+package graceful
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAddrFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		env    map[string]string
+		addr   string
+		source string
+		err    bool
+	}{
+		{"default", nil, ":8080", "default", false},
+		{"port", map[string]string{"PORT": "2017"}, ":2017", "PORT", false},
+		{"host", map[string]string{"HOST": "127.0.0.1"}, "127.0.0.1:8080", "HOST", false},
+		{"host and port", map[string]string{"HOST": "::1", "PORT": "2017"}, "[::1]:2017", "HOST and PORT", false},
+		{"invalid port", map[string]string{"PORT": "http"}, "", "", true},
+		{"port out of range", map[string]string{"PORT": "65536"}, "", "", true},
+		{"host with port", map[string]string{"HOST": "localhost:2017"}, "", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setenv(t, []string{"HOST", "PORT"}, tc.env)
+
+			addr, source, err := addrFromEnv()
+			if tc.err {
+				if err == nil {
+					t.Fatalf("addrFromEnv() returned no error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if addr != tc.addr || source != tc.source {
+				t.Fatalf("addrFromEnv() = %q, %q, want %q, %q", addr, source, tc.addr, tc.source)
+			}
+		})
+	}
+}
+
+// setenv sets the environment to env for the duration of the test,
+// unsetting those of the keys not in env
+func setenv(t *testing.T, keys []string, env map[string]string) {
+	t.Helper()
+
+	for _, key := range keys {
+		key := key
+
+		prev, ok := os.LookupEnv(key)
+
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, prev)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+
+		if v, ok := env[key]; ok {
+			os.Setenv(key, v)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package graceful
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// useErrorLog makes hs, the server named name, log through the Instance,
+// as ServerErrorLogEvents, unless its ErrorLog is already set
+func (i *Instance) useErrorLog(hs *http.Server, name string) {
+	if hs.ErrorLog != nil {
+		return
+	}
+
+	hs.ErrorLog = log.New(errorLogWriter{i, name}, "", 0)
+}
+
+// errorLogWriter emits every line written to it as a ServerErrorLogEvent
+type errorLogWriter struct {
+	i    *Instance
+	name string
+}
+
+func (w errorLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+
+	w.i.emit(Event{Kind: ServerErrorLogEvent, Server: w.name, Err: errors.New(msg)})
+
+	return len(p), nil
+}
@@ -0,0 +1,32 @@
+package graceful
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestUseErrorLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)))
+
+	hs := &http.Server{}
+	i.useErrorLog(hs, "api")
+
+	hs.ErrorLog.Printf("http: TLS handshake error from 127.0.0.1:54321: EOF")
+
+	if got, want := buf.String(), "http.Server: http: TLS handshake error from 127.0.0.1:54321: EOF\n"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	// An ErrorLog already set is kept
+	own := log.New(&bytes.Buffer{}, "", 0)
+	hs = &http.Server{ErrorLog: own}
+	i.useErrorLog(hs, "api")
+
+	if hs.ErrorLog != own {
+		t.Fatalf("hs.ErrorLog was replaced")
+	}
+}
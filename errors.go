@@ -0,0 +1,214 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrAlreadyShutdown is returned by Run for a server that was shut down by
+// an earlier run, and cannot be served again
+var ErrAlreadyShutdown = errors.New("graceful: server already shut down")
+
+// ErrAlreadyRunning is returned by Run if the Instance is already running
+var ErrAlreadyRunning = errors.New("graceful: already running")
+
+// ErrRegistryClosed is returned when registering with a Registry
+// once an Instance has begun shutting it down
+var ErrRegistryClosed = errors.New("graceful: registry closed, shutdown has begun")
+
+// ErrForceClosed is the error of the drain of a server whose connections
+// were closed by the ForceClose stage set by WithDrainStages
+var ErrForceClosed = errors.New("graceful: connections force closed by the drain schedule")
+
+// ErrProcessNotStarted is returned by RegisterProcess
+// for a command that has not been started
+var ErrProcessNotStarted = errors.New("graceful: process not started")
+
+// OnErrorTimeout limits the time waited for the function set by WithOnError
+var OnErrorTimeout = 100 * time.Millisecond
+
+// WithOnError makes the Instance call fn with every error it logs, along
+// with the phase it occurred in, in addition to logging it. The Instance
+// waits at most OnErrorTimeout for fn, which is left running if it takes
+// longer, so that fn can never hold up the shutdown.
+func WithOnError(fn func(phase Phase, err error)) Option {
+	return func(c *config) {
+		c.onError = append(c.onError, fn)
+	}
+}
+
+// callOnError calls fn with the error of e, waiting at most OnErrorTimeout,
+// and logs the PanicError if fn panics, also once no longer waited for
+func (i *Instance) callOnError(fn func(phase Phase, err error), e Event) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := safely(func() error { fn(e.Phase, e.Err); return nil }); err != nil {
+			// Logged, instead of emitted, not to call fn again
+			i.errorLogger().Printf(ErrorFormat, fmt.Errorf("on error: %w", err))
+		}
+	}()
+
+	t := i.clock().NewTimer(OnErrorTimeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+	case <-t.C():
+	}
+}
+
+// PhaseError is an error returned, or logged, by the package,
+// along with the phase it occurred in
+type PhaseError struct {
+	Phase Phase
+
+	// Name is the name of the server, or Registry component,
+	// that the error came from (empty for an unnamed server)
+	Name string
+
+	Err error
+}
+
+// Error returns the phase, the name in parentheses if any, and the error,
+// such as "drain (https): context deadline exceeded"
+func (e *PhaseError) Error() string {
+	if e.Name != "" {
+		return string(e.Phase) + " (" + e.Name + "): " + e.Err.Error()
+	}
+
+	return string(e.Phase) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// phaseError wraps err in a PhaseError, unless it is nil or already one
+func phaseError(phase Phase, name string, err error) error {
+	var pe *PhaseError
+	if err == nil || errors.As(err, &pe) {
+		return err
+	}
+
+	return &PhaseError{Phase: phase, Name: name, Err: err}
+}
+
+// ShutdownError is the error returned by Run, and set as the Err of the
+// Report, when shutting down failed. Its message is that of each error,
+// separated by semicolons, and it works with errors.Is and errors.As, which
+// look through every error it holds.
+type ShutdownError struct {
+	// Drain is the error of draining the servers, such as
+	// context.DeadlineExceeded or ErrForceClosed
+	Drain error
+
+	// Handler is the error of shutting down the handlers
+	Handler error
+
+	// Hooks are the errors of the other phases, by the name of the phase:
+	// deregister, prepare, drainers and cleanup
+	Hooks map[string]error
+
+	// TimedOut is true if the shutdown timeout was exceeded
+	TimedOut bool
+
+	errs []error
+}
+
+func (e *ShutdownError) Error() string {
+	return (&joinedError{e.errs}).Error()
+}
+
+// Unwrap returns the errors of each phase that failed, in the order the
+// phases ran
+func (e *ShutdownError) Unwrap() []error {
+	return e.errs
+}
+
+// shutdownError returns the errors of the phases of a shutdown as a
+// ShutdownError, or nil if none of them failed
+func shutdownError(deregister, prepare, drain, handler, drainers, cleanup error) error {
+	err := joinErrors(deregister, prepare, drain, handler, drainers, cleanup)
+	if err == nil {
+		return nil
+	}
+
+	se := &ShutdownError{Drain: drain, Handler: handler, TimedOut: errors.Is(err, context.DeadlineExceeded), errs: []error{err}}
+
+	if je, ok := err.(*joinedError); ok {
+		se.errs = je.errs
+	}
+
+	for _, hook := range []struct {
+		phase Phase
+		err   error
+	}{
+		{DeregisterPhase, deregister},
+		{PreparePhase, prepare},
+		{DrainersPhase, drainers},
+		{CleanupPhase, cleanup},
+	} {
+		if hook.err == nil {
+			continue
+		}
+
+		if se.Hooks == nil {
+			se.Hooks = map[string]error{}
+		}
+
+		se.Hooks[string(hook.phase)] = hook.err
+	}
+
+	return se
+}
+
+// joinedError holds several errors, and works with errors.Is and errors.As
+// like the errors returned by errors.Join, but its message separates them
+// with semicolons instead of newlines
+type joinedError struct {
+	errs []error
+}
+
+func (e *joinedError) Error() string {
+	msgs := make([]string, len(e.errs))
+
+	for n, err := range e.errs {
+		msgs[n] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e *joinedError) Unwrap() []error {
+	return e.errs
+}
+
+// joinErrors returns the non-nil errs joined, or the error itself
+// if there is only one
+func joinErrors(errs ...error) error {
+	var nonNil []error
+
+	for _, err := range errs {
+		if je, ok := err.(*joinedError); ok {
+			nonNil = append(nonNil, je.errs...)
+		} else if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+
+	return &joinedError{nonNil}
+}
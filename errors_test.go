@@ -0,0 +1,177 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{phaseError(DrainPhase, "", context.DeadlineExceeded), "drain: context deadline exceeded"},
+		{phaseError(CleanupPhase, "db", context.Canceled), "cleanup (db): context canceled"},
+		{phaseError(DrainPhase, "", phaseError(ServePhase, "https", errors.New("closed"))), "serve (https): closed"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Fatalf("err.Error() = %q, want %q", got, tc.want)
+		}
+	}
+
+	if err := phaseError(DrainPhase, "", nil); err != nil {
+		t.Fatalf("phaseError(nil) = %v, want nil", err)
+	}
+}
+
+func TestShutdownErrors(t *testing.T) {
+	clk := newFakeClock()
+
+	flushErr := errors.New("flush failed")
+
+	s := shutdownFunc(func(ctx context.Context) error {
+		return context.DeadlineExceeded
+	})
+
+	i := newInstance(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+		return flushErr
+	})}, nil, WithClock(clk))
+
+	i.members = append(i.members, &member{server: s})
+
+	err := i.shutdown()
+
+	if got, want := err.Error(), "drain: context deadline exceeded; handler shutdown: flush failed"; got != want {
+		t.Fatalf("err.Error() = %q, want %q", got, want)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, flushErr) {
+		t.Fatalf("errors.Is(%v) did not match both errors", err)
+	}
+
+	var pe *PhaseError
+	if !errors.As(err, &pe) || pe.Phase != DrainPhase {
+		t.Fatalf("errors.As(%v) = %+v, want the drain phase", err, pe)
+	}
+}
+
+func TestShutdownError(t *testing.T) {
+	clk := newFakeClock()
+
+	flushErr, closeErr := errors.New("flush failed"), errors.New("close failed")
+
+	r := &Registry{}
+	r.Register("db", shutdownFunc(func(ctx context.Context) error { return closeErr }))
+
+	i := newInstance(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+		return flushErr
+	})}, nil, WithRegistry(r), WithClock(clk))
+
+	i.members = append(i.members, &member{server: shutdownFunc(func(ctx context.Context) error {
+		return context.DeadlineExceeded
+	})})
+
+	err := i.shutdown()
+
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		t.Fatalf("i.shutdown() = %v, want a *ShutdownError", err)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) || !se.TimedOut {
+		t.Fatalf("i.shutdown() = %v, TimedOut %t, want it to match %v", err, se.TimedOut, context.DeadlineExceeded)
+	}
+
+	if !errors.Is(se.Drain, context.DeadlineExceeded) || errors.Is(se.Drain, flushErr) {
+		t.Fatalf("se.Drain = %v, want only the drain error", se.Drain)
+	}
+
+	if !errors.Is(se.Handler, flushErr) || errors.Is(se.Handler, context.DeadlineExceeded) {
+		t.Fatalf("se.Handler = %v, want only the handler error", se.Handler)
+	}
+
+	if len(se.Hooks) != 1 || !errors.Is(se.Hooks["cleanup"], closeErr) {
+		t.Fatalf("se.Hooks = %v, want the cleanup error", se.Hooks)
+	}
+
+	if got := i.Report().Err; got != err {
+		t.Fatalf("i.Report().Err = %v, want %v", got, err)
+	}
+
+	if err := shutdownError(nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("shutdownError() = %v, want nil", err)
+	}
+}
+
+func TestWithOnError(t *testing.T) {
+	defer func(d time.Duration) { OnErrorTimeout = d }(OnErrorTimeout)
+	OnErrorTimeout = 10 * time.Millisecond
+
+	type call struct {
+		phase Phase
+		err   error
+	}
+
+	calls := make(chan call, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	errs := 0
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: shutdownFunc(func(ctx context.Context) error {
+		return errors.New("flush failed")
+	})}, shutdownOnListening(), WithRegistry(&Registry{}), WithEventHandler(func(e Event) {
+		if e.Kind == ErrorEvent {
+			errs++
+		}
+	}), WithOnError(func(phase Phase, err error) {
+		calls <- call{phase, err}
+
+		// Must not hold up the shutdown
+		<-release
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- i.Run(context.Background()) }()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("i.Run() was held up by the function set by WithOnError")
+	}
+
+	c := <-calls
+
+	var pe *PhaseError
+	if c.phase != HandlerPhase || !errors.As(c.err, &pe) || pe.Err.Error() != "flush failed" {
+		t.Fatalf("fn(%q, %v), want the handler error", c.phase, c.err)
+	}
+
+	if errs != 1 {
+		t.Fatalf("logged %d errors, want the error logged as well", errs)
+	}
+}
+
+func TestWithOnErrorPanic(t *testing.T) {
+	var buf bytes.Buffer
+
+	i := newInstance(shutdownFunc(func(ctx context.Context) error {
+		return errors.New("flush failed")
+	}), nil, WithLogger(log.New(&buf, "", 0)), WithOnError(func(phase Phase, err error) {
+		panic("broken tracker")
+	}))
+
+	if err := i.shutdown(); err == nil {
+		t.Fatalf("i.shutdown() = nil, want the handler error")
+	}
+
+	if !strings.Contains(buf.String(), "Error: on error: panic: broken tracker") {
+		t.Fatalf("logged %q, want the panic logged", buf.String())
+	}
+}
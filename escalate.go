@@ -0,0 +1,65 @@
+package graceful
+
+import (
+	"os"
+	"time"
+)
+
+// EscalationPolicy returns what is left of the shutdown timeout when
+// another signal is received while shutting down, given what remains
+type EscalationPolicy func(remaining time.Duration) time.Duration
+
+// HalveRemaining returns an EscalationPolicy that halves
+// the remaining timeout on every signal
+func HalveRemaining() EscalationPolicy {
+	return func(remaining time.Duration) time.Duration {
+		return remaining / 2
+	}
+}
+
+// SubtractRemaining returns an EscalationPolicy that takes d
+// off the remaining timeout on every signal
+func SubtractRemaining(d time.Duration) EscalationPolicy {
+	return func(remaining time.Duration) time.Duration {
+		if remaining < d {
+			return 0
+		}
+
+		return remaining - d
+	}
+}
+
+// escalate shortens the deadline of ctx, using the policy set by
+// WithSignalEscalation, on every signal received on signals until
+// the returned function is called
+func (i *Instance) escalate(ctx *clockContext, signals <-chan os.Signal) (stop func()) {
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		for {
+			select {
+			case <-signals:
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+
+			remaining, _ := Remaining(ctx)
+
+			if next := i.cfg.escalation(remaining); next < remaining {
+				ctx.shorten(next)
+				remaining = next
+			}
+
+			i.emit(Event{Kind: EscalatedEvent, Phase: DrainPhase, Remaining: remaining})
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
@@ -0,0 +1,60 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithSignalEscalation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy EscalationPolicy
+		want   []time.Duration
+	}{
+		{"halve", HalveRemaining(), []time.Duration{7500 * time.Millisecond, 3750 * time.Millisecond, 1875 * time.Millisecond}},
+		{"subtract", SubtractRemaining(4 * time.Second), []time.Duration{11 * time.Second, 7 * time.Second, 3 * time.Second}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := newFakeClock()
+
+			signals := make(chan os.Signal)
+			escalated := make(chan Event)
+
+			var deadlines []time.Duration
+
+			i := newInstance(shutdownFunc(func(ctx context.Context) error {
+				for range tc.want {
+					signals <- os.Interrupt
+					<-escalated
+
+					left, _ := Remaining(ctx)
+					deadlines = append(deadlines, left)
+				}
+
+				clk.Advance(tc.want[len(tc.want)-1])
+
+				<-ctx.Done()
+				return ctx.Err()
+			}), nil, WithSignalEscalation(tc.policy), WithEventHandler(func(e Event) {
+				if e.Kind == EscalatedEvent {
+					escalated <- e
+				}
+			}), WithClock(clk))
+
+			i.signals = signals
+
+			if err := i.shutdown(); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("i.shutdown() = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			for n, want := range tc.want {
+				if deadlines[n] != want {
+					t.Fatalf("deadlines[%d] = %v, want %v", n, deadlines[n], want)
+				}
+			}
+		})
+	}
+}
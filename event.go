@@ -0,0 +1,495 @@
+package graceful
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is a stage in the lifecycle of a server
+type Phase string
+
+// Phases of the lifecycle
+const (
+	SetupPhase      Phase = "setup"
+	WarmupPhase     Phase = "warmup"
+	ServePhase      Phase = "serve"
+	DeregisterPhase Phase = "deregister"
+	DelayPhase      Phase = "drain delay"
+	PreparePhase    Phase = "prepare"
+	DrainPhase      Phase = "drain"
+	HandlerPhase    Phase = "handler shutdown"
+	DrainersPhase   Phase = "drainers"
+	LoopsPhase      Phase = "loops"
+	CleanupPhase    Phase = "cleanup"
+)
+
+// EventKind identifies what an Event describes
+type EventKind string
+
+// Kinds of events, one per built-in log message
+const (
+	ListeningEvent       EventKind = "listening"
+	ListeningPacketEvent EventKind = "listening_packet"
+	ShutdownEvent        EventKind = "shutdown"
+	FinishedHTTPEvent    EventKind = "finished_http"
+	HandlerShutdownEvent EventKind = "handler_shutdown"
+	AbandonedEvent       EventKind = "abandoned"
+	ErrorEvent           EventKind = "error"
+	FinishedEvent        EventKind = "finished"
+	DeregisteredEvent    EventKind = "deregistered"
+	ReloadedEvent        EventKind = "reloaded"
+	AddrEvent            EventKind = "addr"
+	ComponentEvent       EventKind = "component"
+	RestartEvent         EventKind = "restart"
+	ClampedEvent         EventKind = "clamped"
+	WarmedUpEvent        EventKind = "warmed_up"
+	SkippedDrainEvent    EventKind = "skipped_drain"
+	HardDeadlineEvent    EventKind = "hard_deadline"
+	EscalatedEvent       EventKind = "escalated"
+	DroppedEvent         EventKind = "dropped"
+	DrainedEvent         EventKind = "drained"
+	StackDumpEvent       EventKind = "stack_dump"
+	OnShutdownEvent      EventKind = "on_shutdown"
+	HijacksEvent         EventKind = "hijacks"
+	SweptEvent           EventKind = "swept"
+	DrainerEvent         EventKind = "drainer"
+	AbortedEvent         EventKind = "aborted"
+	CleanupFailedEvent   EventKind = "cleanup_failed"
+	VetoedEvent          EventKind = "vetoed"
+	ProcessEvent         EventKind = "process"
+	LoopsEvent           EventKind = "loops"
+	SignalEvent          EventKind = "signal"
+	IgnoredSignalEvent   EventKind = "ignored_signal"
+	SlowRequestsEvent    EventKind = "slow_requests"
+	AbortedRequestsEvent EventKind = "aborted_requests"
+	DrainStageEvent      EventKind = "drain_stage"
+	ServerErrorLogEvent  EventKind = "server_error_log"
+	ConfigReloadedEvent  EventKind = "config_reloaded"
+	GroupStageEvent      EventKind = "group_stage"
+	PausedEvent          EventKind = "paused"
+	ResumedEvent         EventKind = "resumed"
+	ForceClosedEvent     EventKind = "force_closed"
+	ExtendedEvent        EventKind = "extended"
+	ExtensionDeniedEvent EventKind = "extension_denied"
+
+	// ReportEvent carries the Report of a finished shutdown,
+	// it is passed to event handlers but never logged
+	ReportEvent EventKind = "report"
+
+	// PhaseEvent carries the Timing of a finished, or skipped, phase of a
+	// shutdown, it is passed to event handlers but never logged
+	PhaseEvent EventKind = "phase"
+)
+
+// Event is emitted for every message logged by the package
+type Event struct {
+	// Time is when the event was emitted, read from the clock of the Instance
+	Time time.Time
+
+	Kind       EventKind
+	Phase      Phase
+	Server     string
+	Name       string
+	Addr       string
+	URL        string
+	Network    string
+	TLS        bool
+	Timeout    time.Duration
+	Remaining  time.Duration
+	Duration   time.Duration
+	Path       string
+	Source     string
+	Shutdowner string
+	Restart    int
+	Count      int
+
+	// Tier is the tier of a component set by HookTier, or the stage,
+	// counting from 1, of the drain of a Group drained in stages, if any
+	Tier *int
+
+	// Skipped are the components skipped by the AbortOnError policy
+	Skipped []string
+
+	// Stats are those of the shutdown in progress, if any
+	Stats *Stats
+
+	// Timing is the timing of the phase of a PhaseEvent
+	Timing *PhaseTiming
+
+	// Requests are requests in flight, the longest running first
+	Requests []InFlightRequest
+
+	// Reason is what triggered the shutdown, on ShutdownEvent
+	Reason *Reason
+
+	// Open is the number of connections open on the listeners created by
+	// the Instance, when the drain starts and the shutdown finishes, if it
+	// created any
+	Open *int
+
+	Stacks string
+	Report *Report
+	Err    error
+}
+
+// String returns the log message of the event
+func (e Event) String() string {
+	format, args := e.format()
+
+	return strings.TrimSpace(fmt.Sprintf(format, args...))
+}
+
+// format returns the format string and arguments used to log the event
+func (e Event) format() (string, []interface{}) {
+	remaining := func(format, secondsFormat, defaultSecondsFormat string) (string, []interface{}) {
+		if secondsFormat != defaultSecondsFormat {
+			return secondsFormat, []interface{}{(e.Remaining + time.Second/2) / time.Second}
+		}
+
+		return format, []interface{}{e.Remaining.Round(time.Millisecond)}
+	}
+
+	switch e.Kind {
+	case ListeningEvent:
+		if e.URL != "" {
+			return ListeningURLFormat, []interface{}{e.URL}
+		}
+
+		if strings.HasPrefix(e.Addr, unixPrefix) {
+			return ListeningUnixFormat, []interface{}{e.Addr}
+		}
+
+		if e.Network != "" {
+			if e.TLS {
+				return ListeningTLSNetworkFormat, []interface{}{e.Addr, e.Network}
+			}
+
+			return ListeningNetworkFormat, []interface{}{e.Addr, e.Network}
+		}
+
+		if e.TLS {
+			return ListeningTLSFormat, []interface{}{e.Addr}
+		}
+
+		return ListeningFormat, []interface{}{e.Addr}
+	case ListeningPacketEvent:
+		return ListeningPacketFormat, []interface{}{e.Network, e.Addr}
+	case ShutdownEvent:
+		switch {
+		case e.Reason == nil || ShutdownFormat != defaultShutdownFormat:
+		case e.Open != nil:
+			return ShutdownConnsFormat, []interface{}{e.Timeout, e.Reason, *e.Open}
+		default:
+			return ShutdownReasonFormat, []interface{}{e.Timeout, e.Reason}
+		}
+
+		return ShutdownFormat, []interface{}{e.Timeout}
+	case FinishedHTTPEvent:
+		return FinishedHTTP, nil
+	case HandlerShutdownEvent:
+		return remaining(HandlerShutdownDurationFormat, HandlerShutdownFormat, defaultHandlerShutdownFormat)
+	case AbandonedEvent:
+		return AbandonedFormat, []interface{}{e.Shutdowner}
+	case ErrorEvent:
+		return ErrorFormat, []interface{}{e.Err}
+	case FinishedEvent:
+		if e.Open != nil && FinishedFormat == defaultFinishedFormat && FinishedDurationFormat == defaultFinishedDurationFormat {
+			return FinishedConnsFormat, []interface{}{e.Remaining.Round(time.Millisecond), *e.Open}
+		}
+
+		return remaining(FinishedDurationFormat, FinishedFormat, defaultFinishedFormat)
+	case DeregisteredEvent:
+		return DeregisteredFormat, []interface{}{e.Duration.Round(time.Millisecond)}
+	case ReloadedEvent:
+		return ReloadedFormat, []interface{}{e.Path}
+	case AddrEvent:
+		return AddrFormat, []interface{}{e.Addr, e.Source}
+	case ComponentEvent:
+		if e.Tier != nil {
+			return TieredComponentFormat, []interface{}{e.Name, *e.Tier, e.Duration.Round(time.Millisecond), e.Timeout.Round(time.Millisecond)}
+		}
+
+		return ComponentFormat, []interface{}{e.Name, e.Duration.Round(time.Millisecond), e.Timeout.Round(time.Millisecond)}
+	case VetoedEvent:
+		return VetoedFormat, []interface{}{e.Source}
+	case ProcessEvent:
+		if e.Source == "" {
+			return ProcessExitedFormat, []interface{}{e.Name}
+		}
+
+		return ProcessFormat, []interface{}{e.Name, e.Source, e.Duration.Round(time.Millisecond)}
+	case CleanupFailedEvent:
+		if e.Report == nil {
+			return CleanupFailedFormat, []interface{}{0, 0, ""}
+		}
+
+		var failed []string
+
+		for _, c := range e.Report.Cleanup {
+			if c.Err != nil {
+				failed = append(failed, c.Name)
+			}
+		}
+
+		return CleanupFailedFormat, []interface{}{len(failed), len(e.Report.Cleanup), strings.Join(failed, ", ")}
+	case AbortedEvent:
+		skipped := "nothing"
+		if len(e.Skipped) > 0 {
+			skipped = strings.Join(e.Skipped, ", ")
+		}
+
+		return AbortedFormat, []interface{}{e.Name, skipped}
+	case DrainerEvent:
+		return DrainerFormat, []interface{}{e.Name, e.Duration.Round(time.Millisecond), e.Timeout.Round(time.Millisecond), e.Count}
+	case DrainedEvent:
+		return DrainedFormat, []interface{}{e.Server, e.Duration.Round(time.Millisecond), e.Timeout.Round(time.Millisecond)}
+	case StackDumpEvent:
+		return StackDumpFormat, []interface{}{e.Stacks}
+	case HijacksEvent:
+		if e.Report == nil {
+			return HijacksFormat, []interface{}{0, 0}
+		}
+
+		return HijacksFormat, []interface{}{e.Report.HijacksClosed, e.Report.HijacksForceClosed}
+	case SweptEvent:
+		return SweptFormat, []interface{}{e.Count}
+	case OnShutdownEvent:
+		return OnShutdownFormat, []interface{}{e.Count}
+	case LoopsEvent:
+		return LoopsFormat, []interface{}{e.Count}
+	case SignalEvent:
+		return SignalFormat, []interface{}{e.Source}
+	case IgnoredSignalEvent:
+		return IgnoredSignalFormat, []interface{}{e.Source}
+	case SlowRequestsEvent:
+		return SlowRequestsFormat, []interface{}{e.Count, e.Duration.Round(time.Millisecond), e.Timeout.Round(time.Millisecond),
+			formatRequests(e.Requests)}
+	case AbortedRequestsEvent:
+		return AbortedRequestsFormat, []interface{}{e.Count, formatRequestIDs(e.Requests)}
+	case DrainStageEvent:
+		return DrainStageFormat, []interface{}{e.Name, e.Duration.Round(time.Millisecond)}
+	case PausedEvent:
+		return PausedFormat, nil
+	case ResumedEvent:
+		return ResumedFormat, []interface{}{e.Duration.Round(time.Millisecond), e.Count}
+	case ExtendedEvent:
+		return ExtendedFormat, []interface{}{e.Duration.Round(time.Millisecond), e.Remaining.Round(time.Millisecond)}
+	case ExtensionDeniedEvent:
+		return ExtensionDeniedFormat, []interface{}{e.Duration.Round(time.Millisecond), e.Remaining.Round(time.Millisecond)}
+	case GroupStageEvent:
+		return GroupStageFormat, []interface{}{tierOf(e), e.Count, e.Name, e.Timeout.Round(time.Millisecond)}
+	case ServerErrorLogEvent:
+		return ServerErrorLogFormat, []interface{}{e.Err}
+	case ConfigReloadedEvent:
+		if e.Source != "" {
+			return ConfigReloadedSignalFormat, []interface{}{e.Path, e.Source}
+		}
+
+		return ConfigReloadedFormat, []interface{}{e.Path}
+	case SkippedDrainEvent:
+		return SkippedDrainFormat, nil
+	case WarmedUpEvent:
+		return WarmedUpFormat, []interface{}{e.Duration.Round(time.Millisecond)}
+	case ClampedEvent:
+		return ClampedFormat, []interface{}{e.Duration, e.Timeout}
+	case ForceClosedEvent:
+		if e.Report == nil {
+			return ForceClosedFormat, []interface{}{0, 0}
+		}
+
+		return ForceClosedFormat, []interface{}{e.Report.ForceClosed + e.Report.HijackedCut, e.Report.HijackedCut}
+	case DroppedEvent:
+		if e.Report == nil {
+			return DroppedFormat, []interface{}{0, 0, 0}
+		}
+
+		return DroppedFormat, []interface{}{e.Report.Rejected, e.Report.ForceClosed, e.Report.HijackedCut}
+	case EscalatedEvent:
+		return EscalatedFormat, []interface{}{e.Remaining.Round(time.Millisecond)}
+	case HardDeadlineEvent:
+		return HardDeadlineFormat, []interface{}{e.Timeout, e.Duration.Round(time.Millisecond)}
+	case RestartEvent:
+		return RestartFormat, []interface{}{e.Duration.Round(time.Millisecond), e.Restart, e.Err}
+	}
+
+	return "%s\n", []interface{}{e.Kind}
+}
+
+// isError reports whether the event is logged using the logger
+// for errors, see WithLoggers
+func (e Event) isError() bool {
+	switch e.Kind {
+	case ErrorEvent, CleanupFailedEvent, HardDeadlineEvent, ServerErrorLogEvent:
+		return true
+	}
+
+	return false
+}
+
+// keysAndValues returns the fields of the event passed to a KeyValueLogger
+func (e Event) keysAndValues() []interface{} {
+	kvs := []interface{}{"event", string(e.Kind)}
+
+	tier := tierOf(e)
+
+	var open int
+	if e.Open != nil {
+		open = *e.Open
+	}
+
+	var reason Reason
+	if e.Reason != nil {
+		reason = *e.Reason
+	}
+
+	for _, kv := range []struct {
+		key   string
+		value interface{}
+		set   bool
+	}{
+		{"phase", string(e.Phase), e.Phase != ""},
+		{"server", e.Server, e.Server != ""},
+		{"addr", e.Addr, e.Addr != ""},
+		{"url", e.URL, e.URL != ""},
+		{"timeout", e.Timeout, e.Timeout != 0},
+		{"remaining", e.Remaining, e.Remaining != 0},
+		{"duration", e.Duration, e.Duration != 0},
+		{"count", e.Count, e.Count != 0},
+		{"tier", tier, e.Tier != nil},
+		{"open", open, e.Open != nil},
+		{"reason", string(reason.Kind), e.Reason != nil},
+		{"reason_detail", reason.Detail(), e.Reason != nil && reason.Detail() != ""},
+		{"err", e.Err, e.Err != nil},
+	} {
+		if kv.set {
+			kvs = append(kvs, kv.key, kv.value)
+		}
+	}
+
+	return kvs
+}
+
+// MarshalJSON encodes the event as a flat object with the keys
+// time (in RFC 3339 format, with nanoseconds), msg, event, phase, server, name, addr, url, network, tls, timeout_ms,
+// remaining_ms, duration_ms, path, source, shutdowner, restart, count, tier, skipped, requests, stacks and error
+func (e Event) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Time        *time.Time `json:"time,omitempty"`
+		Msg         string     `json:"msg"`
+		Event       EventKind  `json:"event"`
+		Phase       Phase      `json:"phase,omitempty"`
+		Server      string     `json:"server,omitempty"`
+		Name        string     `json:"name,omitempty"`
+		Addr        string     `json:"addr,omitempty"`
+		URL         string     `json:"url,omitempty"`
+		Network     string     `json:"network,omitempty"`
+		TLS         bool       `json:"tls,omitempty"`
+		TimeoutMS   *int64     `json:"timeout_ms,omitempty"`
+		RemainingMS *int64     `json:"remaining_ms,omitempty"`
+		DurationMS  *int64     `json:"duration_ms,omitempty"`
+		Path        string     `json:"path,omitempty"`
+		Source      string     `json:"source,omitempty"`
+		Shutdowner  string     `json:"shutdowner,omitempty"`
+		Restart     int        `json:"restart,omitempty"`
+		Count       int        `json:"count,omitempty"`
+		Tier        *int       `json:"tier,omitempty"`
+		Open        *int       `json:"open_conns,omitempty"`
+		Reason      ReasonKind `json:"reason,omitempty"`
+		Detail      string     `json:"reason_detail,omitempty"`
+		Skipped     []string   `json:"skipped,omitempty"`
+		Requests    []jsonReq  `json:"requests,omitempty"`
+		Stacks      string     `json:"stacks,omitempty"`
+		Error       string     `json:"error,omitempty"`
+	}{
+		Msg:        e.String(),
+		Event:      e.Kind,
+		Phase:      e.Phase,
+		Server:     e.Server,
+		Name:       e.Name,
+		Addr:       e.Addr,
+		URL:        e.URL,
+		Network:    e.Network,
+		TLS:        e.TLS,
+		Path:       e.Path,
+		Source:     e.Source,
+		Shutdowner: e.Shutdowner,
+		Restart:    e.Restart,
+		Count:      e.Count,
+		Tier:       e.Tier,
+		Open:       e.Open,
+		Skipped:    e.Skipped,
+		Stacks:     e.Stacks,
+	}
+
+	if !e.Time.IsZero() {
+		v.Time = &e.Time
+	}
+
+	for _, r := range e.Requests {
+		v.Requests = append(v.Requests, jsonReq{r.Method, r.Path, r.ID, r.Elapsed.Milliseconds()})
+	}
+
+	if e.Reason != nil {
+		v.Reason, v.Detail = e.Reason.Kind, e.Reason.Detail()
+	}
+
+	switch e.Kind {
+	case ShutdownEvent, GroupStageEvent:
+		ms := e.Timeout.Milliseconds()
+		v.TimeoutMS = &ms
+	case HandlerShutdownEvent, FinishedEvent, EscalatedEvent:
+		ms := e.Remaining.Milliseconds()
+		v.RemainingMS = &ms
+	case DeregisteredEvent, RestartEvent, WarmedUpEvent, ProcessEvent, DrainStageEvent, ResumedEvent:
+		ms := e.Duration.Milliseconds()
+		v.DurationMS = &ms
+	case ComponentEvent, DrainedEvent, DrainerEvent, ClampedEvent, HardDeadlineEvent, SlowRequestsEvent:
+		timeout, duration := e.Timeout.Milliseconds(), e.Duration.Milliseconds()
+		v.TimeoutMS, v.DurationMS = &timeout, &duration
+	}
+
+	if e.Err != nil {
+		v.Error = e.Err.Error()
+	}
+
+	return json.Marshal(v)
+}
+
+// jsonReq is an InFlightRequest, as encoded by Event.MarshalJSON
+type jsonReq struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	ID        string `json:"id,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+// jsonWriter writes events to w as JSON lines
+type jsonWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (jw *jsonWriter) write(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	jw.w.Write(append(b, '\n'))
+}
+
+// tierOf returns the tier of e, 0 if it has none
+func tierOf(e Event) int {
+	if e.Tier == nil {
+		return 0
+	}
+
+	return *e.Tier
+}
@@ -0,0 +1,210 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventString(t *testing.T) {
+	for _, tc := range []struct {
+		event Event
+		want  string
+	}{
+		{Event{Kind: ListeningEvent, Addr: "0.0.0.0:2017"}, "Listening on http://0.0.0.0:2017"},
+		{Event{Kind: ShutdownEvent, Timeout: 15 * time.Second}, "Server shutdown with timeout: 15s"},
+		{Event{Kind: FinishedEvent, Remaining: 1500 * time.Millisecond}, "Shutdown finished 1.5s before deadline"},
+		{Event{Kind: ErrorEvent, Err: errors.New("failed")}, "Error: failed"},
+		{Event{Kind: AbandonedEvent, Shutdowner: "*main.server"}, "Abandoned *main.server that did not return before deadline"},
+	} {
+		if got := tc.event.String(); got != tc.want {
+			t.Fatalf("%s: String() = %q, want %q", tc.event.Kind, got, tc.want)
+		}
+	}
+}
+
+func TestFinishedDurationFormat(t *testing.T) {
+	defer func(format string) { FinishedDurationFormat = format }(FinishedDurationFormat)
+
+	open := 2
+	e := Event{Kind: FinishedEvent, Remaining: 15 * time.Second, Open: &open}
+
+	if got, want := e.String(), "Shutdown finished 15s before deadline, 2 connections open"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+
+	// A custom format is used, even when the connections are counted
+	FinishedDurationFormat = "CUSTOM finished %s\n"
+
+	if got, want := e.String(), "CUSTOM finished 15s"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestEventMarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		event Event
+		want  string
+	}{
+		{
+			Event{Kind: ListeningEvent, Phase: ServePhase, Addr: "0.0.0.0:2017"},
+			`{"msg":"Listening on http://0.0.0.0:2017","event":"listening","phase":"serve","addr":"0.0.0.0:2017"}`,
+		},
+		{
+			Event{Kind: ShutdownEvent, Phase: DrainPhase, Timeout: 15 * time.Second},
+			`{"msg":"Server shutdown with timeout: 15s","event":"shutdown","phase":"drain","timeout_ms":15000}`,
+		},
+		{
+			Event{Kind: FinishedEvent},
+			`{"msg":"Shutdown finished 0s before deadline","event":"finished","remaining_ms":0}`,
+		},
+		{
+			Event{Time: time.Date(2017, 6, 19, 16, 35, 28, 123456789, time.UTC), Kind: FinishedHTTPEvent},
+			`{"time":"2017-06-19T16:35:28.123456789Z","msg":"Finished all in-flight HTTP requests","event":"finished_http"}`,
+		},
+		{
+			Event{Kind: ErrorEvent, Phase: HandlerPhase, Err: errors.New("failed")},
+			`{"msg":"Error: failed","event":"error","phase":"handler shutdown","error":"failed"}`,
+		},
+	} {
+		b, err := json.Marshal(tc.event)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := string(b); got != tc.want {
+			t.Fatalf("json.Marshal(%s) = %s, want %s", tc.event.Kind, got, tc.want)
+		}
+	}
+}
+
+func TestWithJSONLogging(t *testing.T) {
+	clk := newFakeClock()
+
+	var buf bytes.Buffer
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: shutdownFunc(func(ctx context.Context) error {
+		clk.Advance(5 * time.Second)
+		return nil
+	})}, WithJSONLogging(&buf), shutdownOnListening(), WithClock(clk))
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	var events []string
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var v map[string]interface{}
+
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+
+		events = append(events, v["event"].(string))
+
+		if v["event"] == "finished" {
+			if got, want := v["time"], "2017-06-19T16:35:33Z"; got != want {
+				t.Fatalf("time = %v, want %v", got, want)
+			}
+
+			if got, want := v["remaining_ms"], float64(10000); got != want {
+				t.Fatalf("remaining_ms = %v, want %v", got, want)
+			}
+		}
+	}
+
+	if got, want := strings.Join(events, ","), "listening,shutdown,finished_http,handler_shutdown,finished"; got != want {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+func TestWithEventHandler(t *testing.T) {
+	var (
+		kinds  []EventKind
+		phases int
+	)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithEventHandler(func(e Event) {
+		if e.Kind == PhaseEvent {
+			phases++
+			return
+		}
+
+		kinds = append(kinds, e.Kind)
+	}), shutdownOnListening())
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := len(kinds), 5; got != want {
+		t.Fatalf("len(kinds) = %d, want %d", got, want)
+	}
+
+	if got, want := phases, 8; got != want {
+		t.Fatalf("phases = %d, want %d", got, want)
+	}
+
+	if got, want := kinds[0], ListeningEvent; got != want {
+		t.Fatalf("kinds[0] = %q, want %q", got, want)
+	}
+
+	if got, want := kinds[4], ReportEvent; got != want {
+		t.Fatalf("kinds[4] = %q, want %q", got, want)
+	}
+}
+
+func TestKeyValueLogger(t *testing.T) {
+	clk := newFakeClock()
+
+	l := &kvLogger{}
+
+	var addr string
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: shutdownFunc(func(ctx context.Context) error {
+		clk.Advance(5 * time.Second)
+		return errors.New("flush failed")
+	})}, WithLogger(l), shutdownOnListening(), WithEventHandler(func(e Event) {
+		if e.Kind == ListeningEvent {
+			addr = e.Addr
+		}
+	}), WithClock(clk))
+
+	i.Run(context.Background())
+
+	if l.printf != 0 {
+		t.Fatalf("Printf called %d times, want Printw to be preferred", l.printf)
+	}
+
+	want := []string{
+		fmt.Sprintf(`Listening on http://%s [event listening phase serve addr %s]`, addr, addr),
+		`Server shutdown with timeout: 15s, on signal terminated, 0 connections open [event shutdown phase drain timeout 15s open 0 reason signal reason_detail terminated]`,
+		`Finished all in-flight HTTP requests [event finished_http phase drain]`,
+		`Shutting down handler with timeout: 15s [event handler_shutdown phase handler shutdown remaining 15s]`,
+		`Error: handler shutdown: flush failed [event error phase handler shutdown err handler shutdown: flush failed]`,
+	}
+
+	if got := strings.Join(l.lines, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("Printw lines =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+type kvLogger struct {
+	lines  []string
+	printf int
+}
+
+func (l *kvLogger) Printf(format string, v ...interface{}) { l.printf++ }
+
+func (l *kvLogger) Fatal(v ...interface{}) {}
+
+func (l *kvLogger) Printw(msg string, keysAndValues ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf("%s %v", msg, keysAndValues))
+}
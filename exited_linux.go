@@ -0,0 +1,22 @@
+package graceful
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// pPID is the idtype of waitid waiting for the process with the given pid
+const pPID = 1
+
+// exitedUnwaited reports whether p has exited without having been waited
+// for, leaving it waitable, as waitid is told not to wait for it
+func exitedUnwaited(p *os.Process) bool {
+	// siginfo_t, of which only si_signo, set once p has exited, is read
+	var info [128]byte
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(p.Pid), uintptr(unsafe.Pointer(&info[0])),
+		syscall.WEXITED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+
+	return errno == 0 && *(*int32)(unsafe.Pointer(&info[0])) != 0
+}
@@ -0,0 +1,29 @@
+package graceful
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestExitedUnwaited(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	// Not waited for, so that it is left a zombie
+	for !exited(cmd.Process) {
+		if time.Now().After(deadline) {
+			t.Fatalf("exited() = false once the process has exited, want true without waiting for it")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("cmd.Wait() = %v, want the process left to be waited for", err)
+	}
+}
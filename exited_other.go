@@ -0,0 +1,11 @@
+//go:build !linux
+
+package graceful
+
+import "os"
+
+// exitedUnwaited reports whether p has exited without having been waited
+// for, which is not known here, so the caller has to wait for it
+func exitedUnwaited(p *os.Process) bool {
+	return false
+}
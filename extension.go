@@ -0,0 +1,126 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithMaxExtension lets the Shutdowners called while shutting down move
+// its deadline later, by up to max in total, see RequestExtension
+func WithMaxExtension(max time.Duration) Option {
+	return func(c *config) {
+		c.maxExtension = max
+	}
+}
+
+// RequestExtension asks for the deadline of the shutdown that ctx, passed
+// to a Shutdowner, is from to be moved d later, such as by a handler that
+// finds a backlog it needs more time for, and reports whether it was. It is
+// granted as long as the extensions granted stay within the total set by
+// WithMaxExtension, and the deadline before the hard deadline set by
+// WithHardDeadline, if any. Deadlines of their own, within the shutdown, such
+// as those of WithDeregister or Timeout, are not moved. Each grant and denial
+// is logged, and the time requested and granted reported, see Report.
+func RequestExtension(ctx context.Context, d time.Duration) bool {
+	i, ok := ctx.Value(statsContextKey).(*Instance)
+	if !ok || d <= 0 {
+		return false
+	}
+
+	phase, _ := ctx.Value(PhaseContextKey).(Phase)
+
+	return i.extensions.request(i, phase, d)
+}
+
+// extensions are the extensions of the deadline of the shutdown in progress
+type extensions struct {
+	mu        sync.Mutex
+	active    bool
+	ctx       *clockContext
+	max       time.Duration
+	hard      time.Time
+	requested time.Duration
+	granted   time.Duration
+}
+
+// begin lets the deadline of ctx, unless nil, be extended by up to max,
+// but not past hard, unless zero
+func (x *extensions) begin(ctx *clockContext, max time.Duration, hard time.Time) {
+	x.mu.Lock()
+	x.active, x.ctx, x.max, x.hard = true, ctx, max, hard
+	x.requested, x.granted = 0, 0
+	x.mu.Unlock()
+}
+
+// end stops extending the deadline, returning the time requested
+// and granted
+func (x *extensions) end() (requested, granted time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.active, x.ctx = false, nil
+
+	return x.requested, x.granted
+}
+
+// request extends the deadline by d if it is within the limits,
+// emitting whether it was
+func (x *extensions) request(i *Instance, phase Phase, d time.Duration) bool {
+	granted, left, ok := x.extend(d)
+	if !ok {
+		return false
+	}
+
+	if !granted {
+		i.emit(Event{Kind: ExtensionDeniedEvent, Phase: phase, Duration: d, Remaining: left})
+
+		return false
+	}
+
+	i.emit(Event{Kind: ExtendedEvent, Phase: phase, Duration: d, Remaining: left})
+
+	return true
+}
+
+// extend extends the deadline by d if it is within the limits, returning
+// whether it was, with the time then left until the deadline, or else how
+// much it could have been extended by, and ok unset unless shutting down
+func (x *extensions) extend(d time.Duration) (granted bool, left time.Duration, ok bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.active {
+		return false, 0, false
+	}
+
+	x.requested += d
+
+	if x.ctx == nil {
+		return false, 0, true
+	}
+
+	left = x.max - x.granted
+
+	if !x.hard.IsZero() {
+		deadline, _ := x.ctx.Deadline()
+
+		if untilHard := x.hard.Sub(deadline); untilHard < left {
+			left = untilHard
+		}
+	}
+
+	if left < 0 {
+		left = 0
+	}
+
+	if d > left || !x.ctx.extend(d) {
+		return false, left, true
+	}
+
+	x.granted += d
+
+	remaining, _ := Remaining(x.ctx)
+
+	return true, remaining, true
+}
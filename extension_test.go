@@ -0,0 +1,89 @@
+package graceful
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestExtension(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		opts      []Option
+		granted   []bool
+		remaining time.Duration
+		messages  []string
+	}{
+		{"within the maximum", []Option{WithMaxExtension(15 * time.Second)}, []bool{true, false}, 15 * time.Second, []string{
+			"Extended the shutdown deadline by 10s, 15s left",
+			"Denied extending the shutdown deadline by 10s, it can be extended by 5s",
+		}},
+		{"before the hard deadline", []Option{WithMaxExtension(time.Minute), WithHardDeadline(18 * time.Second)}, []bool{true, false}, 15 * time.Second, []string{
+			"Extended the shutdown deadline by 10s, 15s left",
+			"Denied extending the shutdown deadline by 10s, it can be extended by 3s",
+		}},
+		{"not enabled", nil, []bool{false, false}, 5 * time.Second, []string{
+			"Denied extending the shutdown deadline by 10s, it can be extended by 0s",
+			"Denied extending the shutdown deadline by 10s, it can be extended by 0s",
+		}},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			clk := newFakeClock()
+			useFakeExit(t)
+
+			var (
+				granted   []bool
+				remaining time.Duration
+				messages  []string
+			)
+
+			i := newInstance(shutdownFunc(func(ctx context.Context) error {
+				for range tc.granted {
+					granted = append(granted, RequestExtension(ctx, 10*time.Second))
+				}
+
+				remaining, _ = Remaining(ctx)
+
+				return nil
+			}), nil, append(tc.opts, WithClock(clk), WithShutdownTimeout(5*time.Second), WithEventHandler(func(e Event) {
+				if e.Kind == ExtendedEvent || e.Kind == ExtensionDeniedEvent {
+					messages = append(messages, e.String())
+				}
+			}))...)
+
+			if err := i.shutdown(); err != nil {
+				t.Fatalf("i.shutdown() = %v, want nil", err)
+			}
+
+			for n, want := range tc.granted {
+				if granted[n] != want {
+					t.Fatalf("granted[%d] = %t, want %t", n, granted[n], want)
+				}
+			}
+
+			if remaining != tc.remaining {
+				t.Fatalf("remaining = %v, want %v", remaining, tc.remaining)
+			}
+
+			for n, want := range tc.messages {
+				if messages[n] != want {
+					t.Fatalf("messages[%d] = %q, want %q", n, messages[n], want)
+				}
+			}
+
+			r := i.Report()
+
+			if r.ExtensionRequested != 20*time.Second || r.ExtensionGranted != tc.remaining-5*time.Second {
+				t.Fatalf("requested %v, granted %v, want 20s, %v", r.ExtensionRequested, r.ExtensionGranted, tc.remaining-5*time.Second)
+			}
+		})
+	}
+
+	t.Run("not shutting down", func(t *testing.T) {
+		if RequestExtension(context.Background(), time.Second) {
+			t.Fatalf("RequestExtension() = true outside of a shutdown")
+		}
+	})
+}
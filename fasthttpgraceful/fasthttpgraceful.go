@@ -0,0 +1,44 @@
+// Package fasthttpgraceful adapts a *fasthttp.Server to the graceful.Server
+// interface.
+//
+//	s := &fasthttp.Server{Handler: hello, ReadTimeout: 5 * time.Second, IdleTimeout: 5 * time.Second}
+//
+//	graceful.New(fasthttpgraceful.Wrap(s, ":8080"),
+//		graceful.WithRegistry(registry),
+//	).Run(ctx)
+//
+// Set ReadTimeout and IdleTimeout, as the drain otherwise waits for the
+// clients to close their keep-alive connections, including the ones they
+// opened but did not send a request on. As fasthttp handlers are not
+// http.Handlers, they are not shut down as Shutdowners, but the Registry
+// and the other options work as for an *http.Server.
+//
+// It is a module of its own, so that using graceful does not
+// add a dependency on fasthttp.
+package fasthttpgraceful
+
+import (
+	graceful "github.com/TV4/graceful"
+	"github.com/valyala/fasthttp"
+)
+
+// Wrap returns a graceful.Server that serves s on addr using
+// s.ListenAndServe, and drains it using s.ShutdownWithContext
+func Wrap(s *fasthttp.Server, addr string) graceful.Server {
+	return &server{
+		Server: graceful.ServerFunc(func() error {
+			return s.ListenAndServe(addr)
+		}, s.ShutdownWithContext),
+		addr: addr,
+	}
+}
+
+type server struct {
+	graceful.Server
+	addr string
+}
+
+// ListenAddr returns the address the server listens on, for logging
+func (s *server) ListenAddr() (network, address string) {
+	return "tcp", s.addr
+}
@@ -0,0 +1,122 @@
+package fasthttpgraceful
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	graceful "github.com/TV4/graceful"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWrap(t *testing.T) {
+	addr := freeAddr(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	// The drain waits for keep-alive connections to time out
+	s := &fasthttp.Server{ReadTimeout: 100 * time.Millisecond, IdleTimeout: 100 * time.Millisecond, Handler: func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/slow" {
+			close(started)
+			<-release
+			ctx.WriteString("drained")
+			return
+		}
+
+		ctx.WriteString("up")
+	}}
+
+	closed := false
+
+	r := &graceful.Registry{}
+	r.Register("db", shutdownFunc(func(ctx context.Context) error {
+		closed = true
+		return nil
+	}))
+
+	i := graceful.New(Wrap(s, addr), graceful.WithSignals(make(chan os.Signal)), graceful.WithRegistry(r))
+
+	done := make(chan error, 1)
+	go func() { done <- i.Run(context.Background()) }()
+
+	waitForServer(t, "http://"+addr+"/")
+
+	body := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+
+	i.Shutdown()
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if got, want := <-body, "drained"; got != want {
+		t.Fatalf("in-flight response = %q, want %q", got, want)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if !closed {
+		t.Fatalf("the Registry was not shut down")
+	}
+}
+
+type shutdownFunc func(ctx context.Context) error
+
+func (f shutdownFunc) Shutdown(ctx context.Context) error { return f(ctx) }
+
+func TestListenAddr(t *testing.T) {
+	la, ok := Wrap(&fasthttp.Server{}, ":8080").(graceful.ListenAddrer)
+	if !ok {
+		t.Fatalf("Wrap() is not a graceful.ListenAddrer")
+	}
+
+	if network, address := la.ListenAddr(); network != "tcp" || address != ":8080" {
+		t.Fatalf("ListenAddr() = %q, %q, want %q, %q", network, address, "tcp", ":8080")
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func waitForServer(t *testing.T, url string) {
+	t.Helper()
+
+	for n := 0; n < 100; n++ {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("server at %s did not start", url)
+}
@@ -0,0 +1,14 @@
+module github.com/TV4/graceful/fasthttpgraceful
+
+go 1.20
+
+require (
+	github.com/TV4/graceful v0.1.0
+	github.com/valyala/fasthttp v1.51.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/klauspost/compress v1.17.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+)
@@ -0,0 +1,52 @@
+// Package fibergraceful adapts a *fiber.App to the graceful.Server interface.
+//
+//	app := fiber.New(fiber.Config{ReadTimeout: 5 * time.Second, IdleTimeout: 5 * time.Second})
+//	app.Get("/", hello)
+//
+//	graceful.New(fibergraceful.Wrap(app, ":8080")).Run(ctx)
+//
+// Set fiber.Config.ReadTimeout and IdleTimeout, as the drain otherwise waits
+// for the clients to close their keep-alive connections, including the ones
+// they opened but did not send a request on.
+//
+// It is a module of its own, so that using graceful does not
+// add a dependency on fiber.
+package fibergraceful
+
+import (
+	"context"
+	"net/http"
+
+	graceful "github.com/TV4/graceful"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Wrap returns a graceful.Server that listens on addr using app.Listen,
+// and drains it using app.ShutdownWithContext
+func Wrap(app *fiber.App, addr string) graceful.Server {
+	return &server{app: app, addr: addr}
+}
+
+type server struct {
+	app  *fiber.App
+	addr string
+}
+
+// ListenAndServe starts the server, returning http.ErrServerClosed
+// instead of the nil returned by app.Listen once it has been shut down
+func (s *server) ListenAndServe() error {
+	if err := s.app.Listen(s.addr); err != nil {
+		return err
+	}
+
+	return http.ErrServerClosed
+}
+
+func (s *server) Shutdown(ctx context.Context) error {
+	return s.app.ShutdownWithContext(ctx)
+}
+
+// ListenAddr returns the address the server listens on, for logging
+func (s *server) ListenAddr() (network, address string) {
+	return "tcp", s.addr
+}
@@ -0,0 +1,104 @@
+package fibergraceful
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	graceful "github.com/TV4/graceful"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWrap(t *testing.T) {
+	addr := freeAddr(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	// The drain waits for keep-alive connections to time out
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ReadTimeout: 100 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("up") })
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		<-release
+		return c.SendString("drained")
+	})
+
+	i := graceful.New(Wrap(app, addr), graceful.WithSignals(make(chan os.Signal)), graceful.WithRegistry(&graceful.Registry{}))
+
+	done := make(chan error, 1)
+	go func() { done <- i.Run(context.Background()) }()
+
+	waitForServer(t, "http://"+addr+"/")
+
+	body := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+
+	i.Shutdown()
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if got, want := <-body, "drained"; got != want {
+		t.Fatalf("in-flight response = %q, want %q", got, want)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	la, ok := Wrap(fiber.New(), ":8080").(graceful.ListenAddrer)
+	if !ok {
+		t.Fatalf("Wrap() is not a graceful.ListenAddrer")
+	}
+
+	if network, address := la.ListenAddr(); network != "tcp" || address != ":8080" {
+		t.Fatalf("ListenAddr() = %q, %q, want %q, %q", network, address, "tcp", ":8080")
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func waitForServer(t *testing.T, url string) {
+	t.Helper()
+
+	for n := 0; n < 100; n++ {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("server at %s did not start", url)
+}
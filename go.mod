@@ -1,3 +1,3 @@
 module github.com/TV4/graceful
 
-go 1.16
+go 1.20
@@ -1,7 +1,7 @@
 /*
 Deprecated: This package is no longer maintained.
 
-Package graceful simplifies graceful shutdown of HTTP servers (Go 1.8+).
+Package graceful simplifies graceful shutdown of HTTP servers (Go 1.20+).
 
 Installation
 
@@ -54,13 +54,17 @@ package graceful
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"reflect"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -76,7 +80,17 @@ type TLSServer interface {
 	Shutdowner
 }
 
+// ListenAddrer is optionally implemented by a Server that is not an
+// *http.Server, to report the network, such as "tcp", "tcp4", "tcp6" or
+// "unix", and the address it listens on, for logging
+type ListenAddrer interface {
+	ListenAddr() (network, address string)
+}
+
 // Shutdowner is implemented by *http.Server, and optionally by *http.Server.Handler
+//
+// Shutdown should return once ctx is done. A Shutdowner that keeps running
+// past the deadline is abandoned, and left running in its own goroutine.
 type Shutdowner interface {
 	Shutdown(ctx context.Context) error
 }
@@ -87,144 +101,869 @@ type Logger interface {
 	Fatal(...interface{})
 }
 
+// KeyValueLogger is optionally implemented by a Logger, which is then passed
+// the message of each event along with its fields, instead of the formatted
+// message. The keys are event, phase, server, addr, url, timeout, remaining,
+// duration and err, and each is only passed if the event has it set.
+// Durations are passed as time.Duration and err as an error.
+type KeyValueLogger interface {
+	Printw(msg string, keysAndValues ...interface{})
+}
+
 // logger is the logger used by the shutdown function
 // (defaults to logging to ioutil.Discard)
 var logger Logger = log.New(ioutil.Discard, "", 0)
 
-// signals is the channel used to signal shutdown
-var signals chan os.Signal
-
 // Timeout for context used in call to *http.Server.Shutdown
 var Timeout = 15 * time.Second
 
-// Format strings used by the logger
+// DisplayURL, if set, returns the URL logged for an address listened on,
+// also by LogListenAndServe, see WithDisplayURL
+var DisplayURL func(addr net.Addr) string
+
+// Format strings used by the logger. A message whose format string is set
+// to "" is not logged, see WithoutLogging.
 var (
-	ListeningFormat       = "Listening on http://%s\n"
-	ShutdownFormat        = "\nServer shutdown with timeout: %s\n"
-	ErrorFormat           = "Error: %v\n"
-	FinishedFormat        = "Shutdown finished %ds before deadline\n"
-	FinishedHTTP          = "Finished all in-flight HTTP requests\n"
-	HandlerShutdownFormat = "Shutting down handler with timeout: %ds\n"
+	ListeningFormat               = "Listening on http://%s\n"
+	ListeningTLSFormat            = "Listening on https://%s\n"
+	ListeningUnixFormat           = "Listening on %s\n"
+	ListeningURLFormat            = "Listening on %s\n"
+	ListeningNetworkFormat        = "Listening on http://%s (%s)\n"
+	ListeningTLSNetworkFormat     = "Listening on https://%s (%s)\n"
+	ListeningPacketFormat         = "Listening on %s://%s\n"
+	ShutdownFormat                = defaultShutdownFormat
+	ShutdownReasonFormat          = "\nServer shutdown with timeout: %s, on %s\n"
+	ShutdownConnsFormat           = "\nServer shutdown with timeout: %s, on %s, %d connections open\n"
+	ErrorFormat                   = "Error: %v\n"
+	FinishedDurationFormat        = defaultFinishedDurationFormat
+	FinishedConnsFormat           = "Shutdown finished %s before deadline, %d connections open\n"
+	FinishedHTTP                  = "Finished all in-flight HTTP requests\n"
+	HandlerShutdownDurationFormat = "Shutting down handler with timeout: %s\n"
+	AbandonedFormat               = "Abandoned %s that did not return before deadline\n"
+	DeregisteredFormat            = "Deregistered in %s\n"
+	ReloadedFormat                = "Reloaded TLS certificate %s\n"
+	AddrFormat                    = "Using address %s from %s\n"
+	ComponentFormat               = "Shut down %s in %s of %s\n"
+	TieredComponentFormat         = "Shut down %s (tier %d) in %s of %s\n"
+	VetoedFormat                  = "Shutdown on %s vetoed, continuing to serve\n"
+	CleanupFailedFormat           = "%d of %d cleanup steps failed: %s\n"
+	AbortedFormat                 = "Aborting the cleanup after %s failed, skipping %s\n"
+	RestartFormat                 = "Restarting server in %s (restart %d) after error: %v\n"
+	ClampedFormat                 = "Warning: Clamped shutdown timeout %s to %s\n"
+	WarmedUpFormat                = "Warmed up in %s\n"
+	SkippedDrainFormat            = "Shutdown before listening, skipping the drain\n"
+	HardDeadlineFormat            = "Hard deadline of %s exceeded after %s, exiting\n"
+	EscalatedFormat               = "Received another signal, shutdown deadline in %s\n"
+	ForceClosedFormat             = "Force-closed %d connections (%d hijacked) at the deadline\n"
+	DroppedFormat                 = "Rejected %d requests, force-closed %d connections and cut %d hijacked connections\n"
+	DrainedFormat                 = "Drained %s in %s of %s\n"
+	StackDumpFormat               = "Goroutine stacks:\n%s"
+	HijacksFormat                 = "Closed %d hijacked connections, force-closed %d at the deadline\n"
+	DrainerFormat                 = "Drained %s in %s of %s, %d remaining\n"
+	SweptFormat                   = "Closed %d idle connections\n"
+	OnShutdownFormat              = "Abandoned %d RegisterOnShutdown callbacks that did not return before deadline\n"
+	ProcessFormat                 = "Stopped %s with %s in %s\n"
+	ProcessExitedFormat           = "Skipped %s, it had already exited\n"
+	LoopsFormat                   = "Abandoned %d loops that did not stop before deadline\n"
+	SignalFormat                  = "Received signal %s\n"
+	IgnoredSignalFormat           = "Ignored signal %s, it is not a shutdown signal\n"
+	SlowRequestsFormat            = "Waiting on %d in-flight requests after %s of %s, the slowest: %s\n"
+	AbortedRequestsFormat         = "Force closing %d in-flight requests with IDs %s\n"
+	DrainStageFormat              = "Reached drain stage %s after %s\n"
+	ServerErrorLogFormat          = "http.Server: %v\n"
+	ConfigReloadedFormat          = "Rebuilt the handler from %s\n"
+	ConfigReloadedSignalFormat    = "Rebuilt the handler from %s on %s\n"
+	GroupStageFormat              = "Draining stage %d of %d (%s) within %s\n"
+	PausedFormat                  = "Paused accepting connections\n"
+	ResumedFormat                 = "Resumed accepting connections after %s, refused %d meanwhile\n"
+	ExtendedFormat                = "Extended the shutdown deadline by %s, %s left\n"
+	ExtensionDeniedFormat         = "Denied extending the shutdown deadline by %s, it can be extended by %s\n"
 )
 
-// LogListenAndServe logs using the logger and then calls ListenAndServe
-func LogListenAndServe(s Server, loggers ...Logger) {
-	if hs, ok := s.(*http.Server); ok {
-		logger = getLogger(loggers...)
+// Format strings taking whole seconds, used instead of their Duration
+// counterparts if they are changed from their default values
+//
+// Deprecated: Use FinishedDurationFormat and HandlerShutdownDurationFormat
+var (
+	FinishedFormat        = defaultFinishedFormat
+	HandlerShutdownFormat = defaultHandlerShutdownFormat
+)
 
-		if host, port, err := net.SplitHostPort(hs.Addr); err == nil {
-			if host == "" {
-				host = net.IPv4zero.String()
-			}
+const (
+	defaultShutdownFormat         = "\nServer shutdown with timeout: %s\n"
+	defaultFinishedFormat         = "Shutdown finished %ds before deadline\n"
+	defaultFinishedDurationFormat = "Shutdown finished %s before deadline\n"
+	defaultHandlerShutdownFormat  = "Shutting down handler with timeout: %ds\n"
+)
 
-			logger.Printf(ListeningFormat, net.JoinHostPort(host, port))
-		}
-	}
+// LogListenAndServe logs using the logger, or every logger if given several,
+// see MultiLogger, and then calls ListenAndServe. The address listened on is
+// logged for an *http.Server, and for a server wrapping one that has an
+// Unwrap() *http.Server method, or has an Addr() string method.
+func LogListenAndServe(s Server, loggers ...Logger) {
+	logListenAndServe(s, loggers)
+}
 
-	ListenAndServe(s)
+// logListenAndServe is LogListenAndServe, also using opts
+func logListenAndServe(s Server, loggers []Logger, opts ...Option) {
+	logger = getLogger(loggers...)
+
+	New(s, append([]Option{WithLogger(logger), withFatal()}, opts...)...).Run(context.Background())
 }
 
 // ListenAndServe starts the server in a goroutine and then calls Shutdown
 func ListenAndServe(s Server) {
-	go func() {
-		if err := s.ListenAndServe(); err != http.ErrServerClosed {
-			logger.Fatal(err)
-		}
-	}()
-
-	Shutdown(s)
+	New(s, WithLogger(logger), withFatal(), withoutListening()).Run(context.Background())
 }
 
 // ListenAndServeTLS starts the server in a goroutine and then calls Shutdown
 func ListenAndServeTLS(s TLSServer, certFile, keyFile string) {
-	go func() {
-		if err := s.ListenAndServeTLS(certFile, keyFile); err != http.ErrServerClosed {
-			logger.Fatal(err)
-		}
-	}()
+	listenAndServeTLS(s, certFile, keyFile)
+}
 
-	Shutdown(s)
+// listenAndServeTLS is ListenAndServeTLS, also using opts
+func listenAndServeTLS(s TLSServer, certFile, keyFile string, opts ...Option) {
+	opts = append([]Option{WithLogger(logger), withFatal(), withoutListening()}, opts...)
+
+	NewTLS(s, certFile, keyFile, opts...).Run(context.Background())
 }
 
 // Shutdown blocks until os.Interrupt or syscall.SIGTERM received, then
 // running *http.Server.Shutdown with a context having a timeout
 func Shutdown(s Shutdowner) {
-	signals = make(chan os.Signal, 1)
+	newInstance(s, nil, WithLogger(logger)).Run(context.Background())
+}
+
+func (i *Instance) shutdown() error {
+	return i.shutdownMembers(i.members)
+}
+
+// shutdownMembers shuts down the servers of members concurrently,
+// sharing one timeout
+func (i *Instance) shutdownMembers(members []*member) (err error) {
+	i.refuseWork()
+
+	var ms []*member
+
+	for _, m := range members {
+		if m.supervisor != nil {
+			m = m.supervisor.freeze(m)
+		}
+
+		if m.server != nil {
+			ms = append(ms, m)
+		}
+	}
+
+	if len(ms) == 0 {
+		return nil
+	}
+
+	defer i.watchdog(ms)()
+	defer i.unprotect()
 
-	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	i.rejected.Store(0)
+	i.forceClosed.Store(0)
+	i.forceClosedRequests.Store(0)
+	i.resetAborted()
+	i.resetSchedule()
+	i.hijackedCut.Store(0)
+	i.onShutdownRunning.Store(0)
+	i.swept.Store(0)
 
-	<-signals
+	// The timeout is read once, so that the deadline, the log line and the
+	// report agree even if Timeout is changed while shutting down
+	unclamped := i.shutdownTimeout()
+	timeout := i.clampTimeout(unclamped)
+
+	budget := context.WithValue(context.Background(), BudgetContextKey, timeout)
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	escalate := i.cfg.escalation != nil && i.signals != nil
+
+	// Escalation, and extensions, need a deadline that can be moved
+	// while the servers are shutting down
+	var movable *clockContext
+
+	if escalate || i.cfg.maxExtension > 0 {
+		movable, cancel = withClockTimeout(budget, i.clock(), timeout)
+
+		if escalate {
+			defer i.escalate(movable, i.signals)()
+		}
+
+		ctx = movable
+	} else {
+		ctx, cancel = withTimeout(budget, i.clock(), timeout)
+	}
+
+	defer cancel()
+
+	r := &Report{Signaled: i.signaled, Timeout: timeout}
+	if r.Signaled.IsZero() {
+		r.Signaled = i.clock().Now()
+	}
+
+	if i.signal != nil {
+		r.Signal = i.signal.String()
+	}
+
+	i.stats.begin(ctx, r.Signal)
+
+	var hard time.Time
+
+	if i.cfg.hardDeadline > 0 {
+		hard = r.Signaled.Add(i.cfg.hardDeadline)
+	}
+
+	i.extensions.begin(movable, i.cfg.maxExtension, hard)
+
+	defer func() {
+		r.ExtensionRequested, r.ExtensionGranted = i.extensions.end()
+		r.Reason, r.AdditionalTriggers = i.shutdownReason()
+		r.Rejected = int(i.rejected.Load())
+		r.ForceClosed = int(i.forceClosed.Load())
+		r.ForceClosedRequests = int(i.forceClosedRequests.Load())
+		r.AbortedRequests = i.abortedRequests()
+		r.Schedule = i.executedSchedule()
+		r.HijackedCut = int(i.hijackedCut.Load())
+		r.OnShutdownRunning = int(i.onShutdownRunning.Load())
+		r.Swept = int(i.swept.Load())
+
+		if r.ForceClosed > 0 || r.HijackedCut > 0 {
+			i.emit(Event{Kind: ForceClosedEvent, Phase: DrainPhase, Report: r})
+		}
+
+		if r.Rejected > 0 || r.ForceClosed > 0 || r.HijackedCut > 0 {
+			i.emit(Event{Kind: DroppedEvent, Report: r})
+		}
+
+		r.Finished = i.clock().Now()
+		r.Total = r.Finished.Sub(r.Signaled)
+		r.Err = err
+		i.setReport(r)
+		i.stats.end()
+		i.emit(Event{Kind: ReportEvent, Report: r, Err: err})
+	}()
+
+	if timeout < unclamped {
+		i.emit(Event{Kind: ClampedEvent, Phase: DrainPhase, Timeout: timeout, Duration: unclamped})
+	}
+
+	// What is registered is shut down by this shutdown alone
+	reg := i.registry().take(i)
+
+	i.enterPhase(DeregisterPhase)
+
+	e := Event{Kind: ShutdownEvent, Phase: DrainPhase, Timeout: timeout, Open: i.openConns()}
+
+	if reason, _ := i.shutdownReason(); reason.Kind != "" {
+		e.Reason = &reason
+	}
+
+	i.emit(e)
+
+	i.beginDrain()
+
+	if i.unstarted {
+		i.emit(Event{Kind: SkippedDrainEvent, Phase: DrainPhase})
+	}
+
+	start := i.clock().Now()
+
+	deregisterErr := i.deregister(ctx)
+
+	r.Deregister = i.newPhaseReport(start, deregisterErr)
+
+	i.timePhase(r, PhaseTiming{Phase: DeregisterPhase, PhaseReport: r.Deregister,
+		Skipped: i.cfg.deregister == nil || i.unstarted})
+
+	if deregisterErr != nil && i.cfg.deregisterAbort {
+		r.Started = i.clock().Now()
+
+		for _, phase := range []Phase{DelayPhase, PreparePhase, DrainPhase, HandlerPhase, DrainersPhase, LoopsPhase, CleanupPhase} {
+			i.timePhase(r, PhaseTiming{Phase: phase, Skipped: true})
+		}
+
+		return shutdownError(deregisterErr, nil, nil, nil, nil, nil)
+	}
+
+	delay := PhaseTiming{Phase: DelayPhase, Skipped: true}
+
+	if !i.unstarted && i.cfg.drainDelay > 0 {
+		start = i.clock().Now()
+
+		i.delayDrain(ctx)
+
+		delay = PhaseTiming{Phase: DelayPhase, PhaseReport: i.newPhaseReport(start, nil)}
+	}
+
+	i.timePhase(r, delay)
+
+	i.enterPhase(PreparePhase)
+
+	start = i.clock().Now()
+
+	prepared, prepareErr := i.prepare(ctx, ms, reg)
+
+	r.Prepare = i.newPhaseReport(start, prepareErr)
+
+	i.timePhase(r, PhaseTiming{Phase: PreparePhase, PhaseReport: r.Prepare, Skipped: prepared == 0})
+
+	// The drain leaves the reserved budget for the handlers
+	drainCtx := ctx
+
+	if reserved := i.cfg.handlerReserve; reserved > 0 && reserved < timeout {
+		var cancelDrain context.CancelFunc
+
+		drainCtx, cancelDrain = withTimeout(ctx, i.clock(), timeout-reserved)
+		defer cancelDrain()
+	}
+
+	r.Started = i.clock().Now()
+
+	for _, m := range ms {
+		cs := m.conns.count()
+
+		r.InFlight += cs.Active
+		r.Conns.New += cs.New
+		r.Conns.Active += cs.Active
+		r.Conns.Idle += cs.Idle
+		r.Conns.Hijacked += cs.Hijacked
+	}
+
+	i.stats.update(func(st *Stats) {
+		st.Phase = DrainPhase
+		st.InFlight = r.InFlight
+		st.Conns = r.Conns
+	})
+
+	var drainErr error
+
+	if !i.unstarted {
+		hijacks := markHijacks()
+
+		servers, packets := splitPackets(ms)
+
+		r.Listeners, drainErr = i.drainStages(drainCtx, servers)
+
+		i.waitHijacks(ctx, hijacks, r)
+
+		// The packet conns are closed once the servers have drained
+		if len(packets) > 0 {
+			drainErr = joinErrors(append([]error{drainErr}, concurrently(packets, func(m *member) error {
+				return i.drain(drainCtx, m)
+			})...)...)
+		}
+	}
+
+	r.Drain = i.newPhaseReport(r.Started, drainErr)
+
+	i.timePhase(r, PhaseTiming{Phase: DrainPhase, PhaseReport: r.Drain, Skipped: i.unstarted})
+
+	i.stats.update(func(st *Stats) {
+		st.Phase = HandlerPhase
+		st.Drained = true
+		st.DrainErr = drainErr
+	})
+
+	// Handlers are shut down once every server using them has drained,
+	// whether or not the drain succeeded
+	handlers := i.handlers(ms, true)
+
+	start = i.clock().Now()
+
+	handlerErr := joinErrors(concurrently(handlers, func(m *member) error {
+		return i.shutdownHandler(ctx, m)
+	})...)
+
+	r.Handler = i.newPhaseReport(start, handlerErr)
+
+	i.timePhase(r, PhaseTiming{Phase: HandlerPhase, PhaseReport: r.Handler, Skipped: len(handlers) == 0})
+
+	var drainersErr, cleanupErr error
+
+	i.enterPhase(DrainersPhase)
+
+	start = i.clock().Now()
+
+	r.Drainers, drainersErr = i.drainQueues(ctx, reg)
+
+	i.timePhase(r, PhaseTiming{Phase: DrainersPhase, PhaseReport: i.newPhaseReport(start, drainersErr),
+		Skipped: len(r.Drainers) == 0})
+
+	for _, d := range r.Drainers {
+		r.Remaining += d.Remaining
+	}
+
+	i.enterPhase(LoopsPhase)
+
+	start = i.clock().Now()
+
+	stopped, running := i.stopLoops(ctx, reg)
+
+	r.LoopsRunning = running
+
+	i.timePhase(r, PhaseTiming{Phase: LoopsPhase, PhaseReport: i.newPhaseReport(start, nil),
+		Skipped: stopped+running == 0})
+
+	i.enterPhase(CleanupPhase)
+
+	r.Cleanup, cleanupErr = i.cleanup(ctx, reg, func(t PhaseTiming) { i.timePhase(r, t) })
+
+	if cleanupErr != nil {
+		i.emit(Event{Kind: CleanupFailedEvent, Phase: CleanupPhase, Report: r})
+	}
+
+	failed := joinErrors(prepareErr, drainErr, handlerErr, drainersErr)
+
+	if remaining, ok := Remaining(ctx); ok && failed == nil {
+		i.emit(Event{Kind: FinishedEvent, Remaining: remaining, Open: i.openConns()})
+	}
+
+	return shutdownError(deregisterErr, prepareErr, drainErr, handlerErr, drainersErr, cleanupErr)
+}
+
+// clampTimeout returns timeout clamped by WithMaxShutdownBudget
+func (i *Instance) clampTimeout(timeout time.Duration) time.Duration {
+	if max := i.cfg.maxBudget - i.cfg.budgetTail; i.cfg.maxBudget > 0 && max < timeout {
+		if max < 0 {
+			return 0
+		}
+
+		return max
+	}
+
+	return timeout
+}
+
+// shutdownTimeout returns the timeout set by WithShutdownTimeout, or Timeout
+func (i *Instance) shutdownTimeout() time.Duration {
+	if i.cfg.timeout > 0 {
+		return i.cfg.timeout
+	}
 
-	shutdown(s, logger)
+	return Timeout
 }
 
-func shutdown(s Shutdowner, logger Logger) {
-	if s == nil {
+// delayDrain waits for the delay set by WithDrainDelay, or until ctx is done
+func (i *Instance) delayDrain(ctx context.Context) {
+	if i.cfg.drainDelay <= 0 {
 		return
 	}
 
-	if logger == nil {
-		logger = log.New(ioutil.Discard, "", 0)
+	t := i.clock().NewTimer(i.cfg.drainDelay)
+	defer t.Stop()
+
+	select {
+	case <-t.C():
+	case <-ctx.Done():
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	defer cancel()
+// concurrently calls fn for each of the members, returning their errors
+func concurrently(ms []*member, fn func(m *member) error) []error {
+	errs := make([]error, len(ms))
+
+	if len(ms) == 1 {
+		errs[0] = fn(ms[0])
+		return errs
+	}
+
+	var wg sync.WaitGroup
+
+	for n, m := range ms {
+		wg.Add(1)
+
+		go func(n int, m *member) {
+			defer wg.Done()
+
+			errs[n] = fn(m)
+		}(n, m)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+// drainStages drains the members one stage at a time, concurrently
+// within a stage, returning the reports of the named members
+func (i *Instance) drainStages(ctx context.Context, ms []*member) ([]ComponentReport, error) {
+	var (
+		reports []ComponentReport
+		errs    []error
+		mu      sync.Mutex
+	)
+
+	ss := stages(ms)
+	rs := reserves(ss)
+
+	for n, stage := range ss {
+		sctx := ctx
+
+		// Leave the time reserved for the stages that follow
+		if left, ok := Remaining(ctx); ok && rs[n] > 0 {
+			reserved := rs[n]
+			if reserved > left/2 {
+				reserved = left / 2
+			}
+
+			var cancel context.CancelFunc
+
+			sctx, cancel = withTimeout(ctx, i.clock(), left-reserved)
+			defer cancel()
+		}
+
+		if d, ok := i.stageTimeouts[stage[0].order()]; ok {
+			if left, ok := Remaining(sctx); !ok || d < left {
+				var cancel context.CancelFunc
+
+				sctx, cancel = withTimeout(sctx, i.clock(), d)
+				defer cancel()
+			}
+		}
+
+		// The stages are logged, and reported, if there are several
+		var tier *int
+
+		if len(ss) > 1 {
+			n := n + 1
+			tier = &n
+
+			left, _ := Remaining(sctx)
+
+			i.emit(Event{Kind: GroupStageEvent, Phase: DrainPhase, Tier: tier, Count: len(ss),
+				Name: memberNames(stage), Timeout: left})
+		}
+
+		errs = append(errs, concurrently(stage, func(m *member) error {
+			if m.name == "" {
+				return i.drain(sctx, m)
+			}
+
+			mctx := sctx
+			timeout, _ := Remaining(sctx)
+
+			if m.timeout > 0 && m.timeout < timeout {
+				var cancel context.CancelFunc
+
+				mctx, cancel = withTimeout(sctx, i.clock(), m.timeout)
+				defer cancel()
+
+				timeout = m.timeout
+			}
+
+			start := i.clock().Now()
+
+			err := i.drain(mctx, m)
+
+			finished := i.clock().Now()
 
-	logger.Printf(ShutdownFormat, Timeout)
+			i.emit(Event{Kind: DrainedEvent, Phase: DrainPhase, Server: m.name,
+				Timeout: timeout, Duration: finished.Sub(start), Err: err})
+
+			mu.Lock()
+			reports = append(reports, ComponentReport{Name: m.name, Tier: tier, Timeout: timeout,
+				Started: start, Finished: finished, Duration: finished.Sub(start), Err: err})
+			mu.Unlock()
+
+			return err
+		})...)
+	}
+
+	return reports, joinErrors(errs...)
+}
+
+// memberNames returns the names of ms, separated by commas
+func memberNames(ms []*member) string {
+	names := make([]string, len(ms))
+
+	for n, m := range ms {
+		names[n] = m.name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// drain shuts down the server of m
+func (i *Instance) drain(ctx context.Context, m *member) error {
+	s := m.server
+	hs, isHTTP := s.(*http.Server)
+	scheduled := isHTTP && len(i.cfg.drainStages) > 0
 
 	// Stop keeping alive HTTP connections
-	if hs, ok := s.(interface {
+	if ka, ok := s.(interface {
 		SetKeepAlivesEnabled(bool)
-	}); ok {
-		hs.SetKeepAlivesEnabled(false)
+	}); ok && !(scheduled && i.scheduled(DisableKeepAlives)) {
+		ka.SetKeepAlivesEnabled(false)
 	}
 
-	if err := s.Shutdown(ctx); err != nil {
-		logger.Printf(ErrorFormat, err)
-	} else {
-		if hs, ok := s.(*http.Server); ok {
-			logger.Printf(FinishedHTTP)
-
-			if hss, ok := hs.Handler.(Shutdowner); ok {
-				select {
-				case <-ctx.Done():
-					if err := ctx.Err(); err != nil {
-						logger.Printf(ErrorFormat, err)
-						return
-					}
-				default:
-					if deadline, ok := ctx.Deadline(); ok {
-						secs := (time.Until(deadline) + time.Second/2) / time.Second
-						logger.Printf(HandlerShutdownFormat, secs)
-					}
-
-					done := make(chan error)
-
-					go func() {
-						<-ctx.Done()
-						done <- ctx.Err()
-					}()
-
-					go func() {
-						done <- hss.Shutdown(ctx)
-					}()
-
-					if err := <-done; err != nil {
-						logger.Printf(ErrorFormat, err)
-						return
-					}
-				}
+	start := i.clock().Now()
+	timeout, _ := Remaining(ctx)
+
+	var cutOnce sync.Once
+
+	cut := func() {
+		cutOnce.Do(func() {
+			i.logSlowRequests(m, i.clock().Now().Sub(start), timeout)
+			i.abortRequests(m)
+			i.forceClose(m, hs)
+		})
+	}
+
+	if isHTTP {
+		i.protect(hs)
+
+		defer i.sweepIdle(ctx, m)()
+		defer i.warnSlowRequests(ctx, m)()
+	}
+
+	drain := s
+
+	// The drain is over once every connection left is idle
+	if isHTTP && m.conns != nil {
+		drain = earlyDrain{hs, m.conns}
+	}
+
+	// forced is set once the ForceClose stage has been reached
+	var forced atomic.Bool
+
+	if scheduled {
+		accepting, stopSchedule := i.runSchedule(ctx, m, hs, func() {
+			forced.Store(true)
+			cut()
+		})
+		defer stopSchedule()
+
+		select {
+		case <-accepting:
+		case <-ctx.Done():
+		}
+	}
+
+	err := i.call(ctx, DrainPhase, drain)
+
+	// Shutdown does not wait for its RegisterOnShutdown callbacks
+	if isHTTP {
+		i.waitOnShutdown(ctx, m, hs)
+	}
+
+	if err == nil && forced.Load() {
+		err = ErrForceClosed
+	}
+
+	if err != nil {
+		if isHTTP {
+			cut()
+		}
+
+		err = phaseError(DrainPhase, m.name, err)
+		i.emit(Event{Kind: ErrorEvent, Phase: DrainPhase, Server: m.name, Err: err})
+		return err
+	}
+
+	if isHTTP {
+		i.emit(Event{Kind: FinishedHTTPEvent, Phase: DrainPhase, Server: m.name})
+	}
+
+	return nil
+}
+
+// forceClose closes the connections of hs, the server of m, that are still
+// open after its drain failed, counting them, and the requests in progress
+// on them
+func (i *Instance) forceClose(m *member, hs *http.Server) {
+	open, requests := m.conns.open(), m.conns.count().Active
+
+	if m.conns != nil && m.conns.requests != nil {
+		_, requests = m.conns.requests.slowest(0)
+	}
+
+	hs.Close()
+
+	i.forceClosed.Add(int64(open))
+	i.forceClosedRequests.Add(int64(requests))
+	i.hijackedCut.Add(int64(m.conns.cutHijacked()))
+}
+
+// handlers returns the Shutdowners to shut down once the servers of ms
+// have drained, as members named after the server of the handler, if any,
+// including those returned by the resolvers set by WithShutdownerResolver
+// if resolve is set
+func (i *Instance) handlers(ms []*member, resolve bool) []*member {
+	var handlers []*member
+
+	add := func(name string, s Shutdowner) {
+		if s != nil && !containsHandler(handlers, s) {
+			handlers = append(handlers, &member{name: name, server: s})
+		}
+	}
+
+	if !i.cfg.noHandlerShutdown {
+		for _, m := range ms {
+			if hss, ok := handlerShutdowner(m); ok {
+				add(m.name, hss)
 			}
 		}
+	}
+
+	for _, s := range i.cfg.shutdowners {
+		add("", s)
+	}
+
+	if resolve {
+		for _, resolver := range i.cfg.resolvers {
+			var ss []Shutdowner
+
+			if err := safely(func() error { ss = resolver(); return nil }); err != nil {
+				i.emit(Event{Kind: ErrorEvent, Phase: HandlerPhase, Err: phaseError(HandlerPhase, "", err)})
+			}
+
+			for _, s := range ss {
+				add("", s)
+			}
+		}
+	}
+
+	return handlers
+}
+
+// shutdownHandler shuts down the Shutdowner of m, returned by handlers
+func (i *Instance) shutdownHandler(ctx context.Context, m *member) error {
+	hss := m.server
+
+	select {
+	case <-ctx.Done():
+		err := phaseError(HandlerPhase, m.name, ctx.Err())
+		i.emit(Event{Kind: ErrorEvent, Phase: HandlerPhase, Server: m.name, Err: err})
+		return err
+	default:
+	}
+
+	if remaining, ok := Remaining(ctx); ok {
+		i.emit(Event{Kind: HandlerShutdownEvent, Phase: HandlerPhase, Server: m.name, Remaining: remaining})
+	}
+
+	if err := i.call(ctx, HandlerPhase, hss); err != nil {
+		err = phaseError(HandlerPhase, m.name, err)
+		i.emit(Event{Kind: ErrorEvent, Phase: HandlerPhase, Server: m.name, Err: err})
+		return err
+	}
+
+	return nil
+}
+
+// handlerShutdowner returns the handler of the server of m, the one being
+// served if built by WithConfigReload, if it is a Shutdowner
+func handlerShutdowner(m *member) (Shutdowner, bool) {
+	hs, ok := m.server.(*http.Server)
+	if !ok {
+		return nil, false
+	}
+
+	h := hs.Handler
 
-		if deadline, ok := ctx.Deadline(); ok {
-			secs := (time.Until(deadline) + time.Second/2) / time.Second
-			logger.Printf(FinishedFormat, secs)
+	// The handler built by WithConfigReload that is being served
+	if cr, ok := h.(*configReloader); ok {
+		h = cr.handler()
+	}
+
+	hss, ok := h.(Shutdowner)
+
+	return hss, ok
+}
+
+// containsHandler reports whether hss is the Shutdowner of one of the members
+// returned by handlers
+func containsHandler(ms []*member, hss Shutdowner) bool {
+	if !reflect.TypeOf(hss).Comparable() {
+		return false
+	}
+
+	for _, m := range ms {
+		if h := m.server; reflect.TypeOf(h) == reflect.TypeOf(hss) && h == hss {
+			return true
 		}
 	}
+
+	return false
+}
+
+// deregister calls the function set by WithDeregister, with its own slice
+// of the shutdown timeout
+func (i *Instance) deregister(ctx context.Context) error {
+	if i.cfg.deregister == nil || i.unstarted {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, i.clock(), i.cfg.deregisterTimeout)
+	defer cancel()
+
+	start := i.clock().Now()
+
+	err := phaseError(DeregisterPhase, "", i.call(ctx, DeregisterPhase, shutdownerFunc(i.cfg.deregister)))
+	if err != nil {
+		i.emit(Event{Kind: ErrorEvent, Phase: DeregisterPhase, Err: err})
+	}
+
+	i.emit(Event{Kind: DeregisteredEvent, Phase: DeregisterPhase, Duration: i.clock().Now().Sub(start), Err: err})
+
+	return err
+}
+
+// shutdownerFunc adapts a function to the Shutdowner interface
+type shutdownerFunc func(ctx context.Context) error
+
+func (f shutdownerFunc) Shutdown(ctx context.Context) error {
+	return f(ctx)
+}
+
+// call runs s.Shutdown in a goroutine, and stops waiting for it once ctx is
+// done. A Shutdowner that ignores ctx is abandoned, still running, and a
+// goroutine dump is written if WithTimeoutDump was used.
+func (i *Instance) call(ctx context.Context, phase Phase, s Shutdowner) error {
+	// Buffered so that an abandoned Shutdowner can still
+	// finish after we have stopped waiting for it
+	done := make(chan error, 1)
+
+	ctx = context.WithValue(ctx, PhaseContextKey, phase)
+	ctx = context.WithValue(ctx, statsContextKey, i)
+
+	go func() {
+		done <- safely(func() error { return s.Shutdown(ctx) })
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	select {
+	case err := <-done:
+		return err
+	default:
+	}
+
+	i.emit(Event{Kind: AbandonedEvent, Phase: phase, Shutdowner: fmt.Sprintf("%T", s)})
+
+	if i.cfg.timeoutDump != nil {
+		pprof.Lookup("goroutine").WriteTo(i.cfg.timeoutDump, 2)
+	}
+
+	return ctx.Err()
 }
 
 func getLogger(loggers ...Logger) Logger {
+	if len(loggers) > 1 {
+		return MultiLogger(loggers...)
+	}
+
 	if len(loggers) > 0 {
 		if loggers[0] != nil {
 			return loggers[0]
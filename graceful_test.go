@@ -3,11 +3,14 @@ package graceful
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -17,14 +20,9 @@ func TestListenAndServeTLS(t *testing.T) {
 
 	logger := log.New(&buf, "", 0)
 
-	go func() {
-		time.Sleep(10 * time.Millisecond)
-		signals <- os.Interrupt
-	}()
-
-	ListenAndServeTLS(&http.Server{
+	listenAndServeTLS(&http.Server{
 		Addr: ":0", Handler: &testHandler{logger},
-	}, "testdata/server.crt", "testdata/server.key")
+	}, "testdata/server.crt", "testdata/server.key", shutdownOnListening())
 
 	s := buf.String()
 
@@ -43,14 +41,9 @@ func TestLogListenAndServe(t *testing.T) {
 
 		logger := log.New(&buf, "", 0)
 
-		go func() {
-			time.Sleep(10 * time.Millisecond)
-			signals <- os.Interrupt
-		}()
-
-		LogListenAndServe(&http.Server{
+		logListenAndServe(&http.Server{
 			Addr: ":0", Handler: &testHandler{logger},
-		}, logger)
+		}, []Logger{logger}, shutdownOnListening())
 
 		s := buf.String()
 
@@ -65,48 +58,418 @@ func TestLogListenAndServe(t *testing.T) {
 	})
 
 	t.Run("with no logger", func(t *testing.T) {
-		go func() {
-			time.Sleep(10 * time.Millisecond)
-			signals <- os.Interrupt
-		}()
-
-		LogListenAndServe(&http.Server{
+		logListenAndServe(&http.Server{
 			Addr: ":0", Handler: &testHandler{},
-		})
+		}, nil, shutdownOnListening())
 	})
 
 	t.Run("with nil logger", func(t *testing.T) {
-		go func() {
-			time.Sleep(10 * time.Millisecond)
-			signals <- os.Interrupt
-		}()
-
-		LogListenAndServe(&http.Server{
+		logListenAndServe(&http.Server{
 			Addr: ":0", Handler: &testHandler{},
-		}, nil)
+		}, []Logger{nil}, shutdownOnListening())
 	})
+
+	for _, tc := range []struct {
+		name string
+		s    Server
+	}{
+		{"wrapping an *http.Server", wrappedServer{&http.Server{Addr: "127.0.0.1:0"}}},
+		{"with an Addr method", &addrServer{addr: "127.0.0.1:8080", done: make(chan struct{})}},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			logListenAndServe(tc.s, []Logger{log.New(&buf, "", 0)}, shutdownOnListening())
+
+			if s := buf.String(); !strings.Contains(s, "Listening on http://127.0.0.1:") {
+				t.Fatalf("log output %q does not include the listening line", s)
+			}
+		})
+	}
+}
+
+// wrappedServer embeds an *http.Server, returning it from Unwrap
+type wrappedServer struct {
+	*http.Server
+}
+
+func (s wrappedServer) Unwrap() *http.Server { return s.Server }
+
+// addrServer is a Server that is not an *http.Server, with an Addr method
+type addrServer struct {
+	addr string
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *addrServer) Addr() string { return s.addr }
+
+func (s *addrServer) ListenAndServe() error {
+	<-s.done
+	return http.ErrServerClosed
+}
+
+func (s *addrServer) Shutdown(ctx context.Context) error {
+	s.once.Do(func() { close(s.done) })
+	return nil
 }
 
 func TestShutdown(t *testing.T) {
 	t.Run("nil-hs", func(t *testing.T) {
-		shutdown(nil, nil)
+		testShutdown(nil, nil)
 	})
 
 	t.Run("nil-logger", func(t *testing.T) {
-		shutdown(&http.Server{}, nil)
+		testShutdown(&http.Server{}, nil)
 	})
 
 	t.Run("logger", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		testShutdown(&http.Server{}, log.New(&buf, "", 0), WithClock(clk))
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+FinishedDurationFormat, Timeout, 15*time.Second)
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		testShutdown(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(5 * time.Second)
+			return nil
+		})}, log.New(&buf, "", 0), WithClock(clk))
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+HandlerShutdownDurationFormat+FinishedDurationFormat,
+			Timeout, 15*time.Second, 10*time.Second)
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("short timeout", func(t *testing.T) {
+		clk := newFakeClock()
+
+		defer func(d time.Duration) { Timeout = d }(Timeout)
+		Timeout = 100 * time.Millisecond
+
 		var buf bytes.Buffer
 
-		shutdown(&http.Server{}, log.New(&buf, "", 0))
+		testShutdown(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(60 * time.Millisecond)
+			return nil
+		})}, log.New(&buf, "", 0), WithClock(clk))
 
-		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+FinishedFormat, Timeout, 15)
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+HandlerShutdownDurationFormat+FinishedDurationFormat,
+			Timeout, 100*time.Millisecond, 40*time.Millisecond)
 
 		if got := buf.String(); got != want {
 			t.Fatalf("buf.String() = %q, want %q", got, want)
 		}
 	})
+
+	t.Run("customized seconds formats", func(t *testing.T) {
+		clk := newFakeClock()
+
+		defer func(f, h string) { FinishedFormat, HandlerShutdownFormat = f, h }(FinishedFormat, HandlerShutdownFormat)
+		FinishedFormat = "finished %d\n"
+		HandlerShutdownFormat = "handler %d\n"
+
+		var buf bytes.Buffer
+
+		testShutdown(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(5 * time.Second)
+			return nil
+		})}, log.New(&buf, "", 0), WithClock(clk))
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+"handler 15\nfinished 10\n", Timeout)
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("handler timeout", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		h := shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(Timeout)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		testShutdown(&http.Server{Handler: h}, log.New(&buf, "", 0), WithClock(clk))
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+HandlerShutdownDurationFormat, Timeout, 15*time.Second)
+
+		if got := buf.String(); !strings.HasPrefix(got, want) || !strings.HasSuffix(got, fmt.Sprintf(ErrorFormat, "handler shutdown: context deadline exceeded")) {
+			t.Fatalf("buf.String() = %q, want %q followed by an error", got, want)
+		}
+	})
+
+	t.Run("handler ignoring deadline", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf, dump bytes.Buffer
+
+		release := make(chan struct{})
+		defer close(release)
+
+		h := shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(Timeout)
+			<-release
+			return nil
+		})
+
+		i := newInstance(&http.Server{Handler: h}, nil, WithLogger(log.New(&buf, "", 0)), WithTimeoutDump(&dump), WithClock(clk))
+
+		if got, want := i.shutdown(), context.DeadlineExceeded; !errors.Is(got, want) {
+			t.Fatalf("i.shutdown() = %v, want %v", got, want)
+		}
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+HandlerShutdownDurationFormat+AbandonedFormat+ErrorFormat,
+			Timeout, 15*time.Second, fmt.Sprintf("%T", h), "handler shutdown: context deadline exceeded")
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+
+		if !strings.Contains(dump.String(), "goroutine") {
+			t.Fatalf("dump does not include goroutine stacks")
+		}
+	})
+
+	t.Run("server ignoring deadline", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		release := make(chan struct{})
+		defer close(release)
+
+		s := shutdownFunc(func(ctx context.Context) error {
+			clk.Advance(Timeout)
+			<-release
+			return nil
+		})
+
+		if got, want := testShutdown(s, log.New(&buf, "", 0), WithClock(clk)), context.DeadlineExceeded; !errors.Is(got, want) {
+			t.Fatalf("testShutdown() = %v, want %v", got, want)
+		}
+
+		want := fmt.Sprintf(ShutdownFormat+AbandonedFormat+ErrorFormat, Timeout, fmt.Sprintf("%T", s), "drain: context deadline exceeded")
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestShutdownAfterDrainFailure(t *testing.T) {
+	clk := newFakeClock()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	flushErr := errors.New("flush failed")
+
+	var handlerRemaining time.Duration
+
+	h := &blockingHandler{
+		serve: func() {
+			close(started)
+			<-release
+		},
+		shutdown: func(ctx context.Context) error {
+			handlerRemaining, _ = Remaining(ctx)
+			return flushErr
+		},
+	}
+
+	hs := &http.Server{Handler: h}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+
+	i := newInstance(hs, nil, WithReservedHandlerBudget(2*time.Second), WithClock(clk))
+
+	errs := make(chan error)
+
+	go func() { errs <- i.shutdown() }()
+
+	clk.WaitForTimers(2)
+	clk.Advance(Timeout - 2*time.Second)
+
+	err = <-errs
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("i.shutdown() = %v, want the drain error", err)
+	}
+
+	if !errors.Is(err, flushErr) {
+		t.Fatalf("i.shutdown() = %v, want the handler error", err)
+	}
+
+	if want := 2 * time.Second; handlerRemaining != want {
+		t.Fatalf("handler remaining = %v, want %v", handlerRemaining, want)
+	}
+}
+
+func TestShutdownGoroutineLeak(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler shutdownFunc
+	}{
+		{"handler", func(ctx context.Context) error { return nil }},
+		{"handler error", func(ctx context.Context) error { return errors.New("failed") }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testShutdown(&http.Server{Handler: tc.handler}, nil)
+
+			checkGoroutineLeaks(t)
+		})
+	}
+}
+
+// checkGoroutineLeaks fails the test if goroutines started by the package
+// are still running shortly after the call
+func checkGoroutineLeaks(t *testing.T) {
+	t.Helper()
+
+	var leaked []string
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if leaked = leakedGoroutines(); len(leaked) == 0 {
+			return
+		}
+	}
+
+	t.Fatalf("leaked %d goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+}
+
+func leakedGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+
+	var leaked []string
+
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "created by github.com/TV4/graceful.") &&
+			!strings.Contains(g, "created by github.com/TV4/graceful.Test") {
+			leaked = append(leaked, g)
+		}
+	}
+
+	return leaked
+}
+
+func testShutdown(s Shutdowner, logger Logger, opts ...Option) error {
+	return newInstance(s, nil, append(opts, WithLogger(logger))...).shutdown()
+}
+
+func TestWithHandlerShutdown(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     func(explicit Shutdowner) []Option
+		handler  bool
+		explicit bool
+	}{
+		{"default", func(Shutdowner) []Option { return nil }, true, false},
+		{"disabled", func(Shutdowner) []Option { return []Option{WithHandlerShutdown(false)} }, false, false},
+		{"explicit", func(s Shutdowner) []Option { return []Option{WithHandlerShutdown(false), WithShutdowners(s)} }, false, true},
+		{"both", func(s Shutdowner) []Option { return []Option{WithShutdowners(s)} }, true, true},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var handler, explicit bool
+
+			h := shutdownFunc(func(ctx context.Context) error {
+				handler = true
+				return nil
+			})
+
+			s := shutdownFunc(func(ctx context.Context) error {
+				explicit = true
+				return nil
+			})
+
+			i := New(&http.Server{Addr: "127.0.0.1:0", Handler: h}, append(tc.opts(s), WithRegistry(&Registry{}), shutdownOnListening())...)
+
+			if err := i.Run(context.Background()); err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			if handler != tc.handler || explicit != tc.explicit {
+				t.Fatalf("handler shut down = %t, explicit = %t, want %t, %t", handler, explicit, tc.handler, tc.explicit)
+			}
+		})
+	}
+}
+
+func TestWithShutdownerResolver(t *testing.T) {
+	var (
+		created  []string
+		shutDown = make(chan string, 3)
+	)
+
+	component := func(name string) Shutdowner {
+		created = append(created, name)
+
+		return shutdownFunc(func(ctx context.Context) error {
+			shutDown <- name
+			return nil
+		})
+	}
+
+	var resolved int
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithRegistry(&Registry{}),
+		WithShutdowners(component("static")),
+		WithShutdownerResolver(func() []Shutdowner {
+			resolved++
+
+			// Created lazily, after the Instance
+			return []Shutdowner{component("lazy"), nil}
+		}), shutdownOnListening())
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	close(shutDown)
+
+	got := map[string]bool{}
+	for name := range shutDown {
+		got[name] = true
+	}
+
+	if resolved != 1 || !got["static"] || !got["lazy"] || len(got) != 2 {
+		t.Fatalf("resolved %d times, shut down %v, want the static and lazy components shut down", resolved, got)
+	}
+
+	if i.Report().Handler.Err != nil {
+		t.Fatalf("i.Report().Handler.Err = %v, want nil", i.Report().Handler.Err)
+	}
 }
 
 type testHandler struct {
@@ -122,3 +485,24 @@ func (h *testHandler) Shutdown(ctx context.Context) error {
 
 	return nil
 }
+
+type blockingHandler struct {
+	serve    func()
+	shutdown func(ctx context.Context) error
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve()
+}
+
+func (h *blockingHandler) Shutdown(ctx context.Context) error {
+	return h.shutdown(ctx)
+}
+
+type shutdownFunc func(ctx context.Context) error
+
+func (f shutdownFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (f shutdownFunc) Shutdown(ctx context.Context) error {
+	return f(ctx)
+}
@@ -0,0 +1,138 @@
+// Package gracefultest provides a server for end-to-end tests of graceful
+// shutdown, like httptest.Server but run by a graceful.Instance.
+//
+//	s := gracefultest.NewServer(h)
+//
+//	go s.Client().Get(s.URL + "/slow")
+//
+//	s.BeginShutdown()
+//
+//	report := s.Wait()
+package gracefultest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	graceful "github.com/TV4/graceful"
+	"github.com/TV4/graceful/internal/signaltest"
+)
+
+// Server is an HTTP server listening on a loopback address,
+// shut down by a graceful.Instance when BeginShutdown is called
+type Server struct {
+	// URL is the base URL of the server, such as http://127.0.0.1:4711
+	URL string
+
+	// Config is the server being served
+	Config *http.Server
+
+	instance *graceful.Instance
+	client   *http.Client
+	errs     chan error
+}
+
+// NewServer starts a server serving h, shut down with the given options.
+// It neither waits for signals nor uses the graceful.DefaultRegistry,
+// unless options say otherwise, and panics if it fails to start.
+func NewServer(h http.Handler, opts ...graceful.Option) *Server {
+	s := &Server{
+		Config: &http.Server{Addr: "127.0.0.1:0", Handler: h},
+		client: &http.Client{Transport: &http.Transport{}},
+		errs:   make(chan error, 1),
+	}
+
+	addrs := make(chan string, 1)
+
+	opts = append([]graceful.Option{
+		graceful.WithSignals(make(chan os.Signal)),
+		graceful.WithRegistry(&graceful.Registry{}),
+		graceful.WithNetwork("tcp4"),
+		graceful.WithEventHandler(func(e graceful.Event) {
+			if e.Kind == graceful.ListeningEvent {
+				addrs <- e.Addr
+			}
+		}),
+	}, opts...)
+
+	s.instance = graceful.New(s.Config, opts...)
+
+	go func() {
+		s.errs <- s.instance.Run(context.Background())
+	}()
+
+	select {
+	case addr := <-addrs:
+		s.URL = "http://" + addr
+	case err := <-s.errs:
+		panic(fmt.Sprintf("gracefultest: failed to start server: %v", err))
+	}
+
+	return s
+}
+
+// Client returns an HTTP client for making requests to the server
+func (s *Server) Client() *http.Client {
+	return s.client
+}
+
+// BeginShutdown starts shutting down the server, as if it had received
+// a shutdown signal, without waiting for the shutdown to finish
+func (s *Server) BeginShutdown() {
+	s.instance.Shutdown()
+}
+
+// Wait waits for the shutdown to finish, and returns its report, with
+// the error the server failed with as its Err if it never shut down
+func (s *Server) Wait() graceful.Report {
+	report, err := s.instance.Wait(context.Background())
+
+	s.client.CloseIdleConnections()
+
+	if report.Err == nil {
+		report.Err = err
+	}
+
+	return report
+}
+
+// Close shuts down the server, and waits for it to finish
+func (s *Server) Close() graceful.Report {
+	s.BeginShutdown()
+
+	return s.Wait()
+}
+
+// Signals is a source of signals for graceful.WithSignalSource that tests
+// send signals with, instead of signaling the process, so that they are
+// received in order, and only by the Instances using it
+//
+//	sigs := gracefultest.NewSignals()
+//
+//	s := gracefultest.NewServer(h, graceful.WithSignalSource(sigs))
+//
+//	sigs.Send(syscall.SIGTERM)
+type Signals struct {
+	s *signaltest.Signals
+}
+
+// NewSignals returns a source of signals that none have been sent by
+func NewSignals() *Signals {
+	return &Signals{s: signaltest.New()}
+}
+
+// Notify returns a channel that the signals among sigs sent by Send are
+// relayed to, until stop is called
+func (s *Signals) Notify(sigs ...os.Signal) (ch <-chan os.Signal, stop func()) {
+	return s.s.Notify(sigs...)
+}
+
+// Send waits until an Instance waits for sig, then sends it to every
+// Instance waiting for it, returning once each has received it, or stopped
+// waiting for it. Sending the signals of a sequence one after the other has
+// them received in that order.
+func (s *Signals) Send(sig os.Signal) {
+	s.s.Send(sig)
+}
@@ -0,0 +1,136 @@
+package gracefultest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	graceful "github.com/TV4/graceful"
+)
+
+func TestServer(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	h := &handler{
+		serve: func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			io.WriteString(w, "done")
+		},
+	}
+
+	s := NewServer(h)
+
+	results := make(chan string, 1)
+
+	go func() {
+		resp, err := s.Client().Get(s.URL)
+		if err != nil {
+			results <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		b, _ := io.ReadAll(resp.Body)
+		results <- string(b)
+	}()
+
+	<-started
+
+	s.BeginShutdown()
+	close(release)
+
+	report := s.Wait()
+
+	if got, want := <-results, "done"; got != want {
+		t.Fatalf("in-flight request = %q, want %q", got, want)
+	}
+
+	if report.Err != nil {
+		t.Fatalf("report.Err = %v, want nil", report.Err)
+	}
+
+	if !h.shutdown {
+		t.Fatalf("handler was not shut down")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer(http.NotFoundHandler())
+
+	if report := s.Close(); report.Err != nil {
+		t.Fatalf("report.Err = %v, want nil", report.Err)
+	}
+}
+
+func TestServerFailed(t *testing.T) {
+	s := NewServer(http.NotFoundHandler())
+
+	// Closed behind the back of the Instance, which never shuts down
+	s.Config.Close()
+
+	if report := s.Wait(); !errors.Is(report.Err, graceful.ErrAlreadyShutdown) {
+		t.Fatalf("report.Err = %v, want %v", report.Err, graceful.ErrAlreadyShutdown)
+	}
+}
+
+func TestServerSequential(t *testing.T) {
+	for n := 0; n < 2; n++ {
+		s := NewServer(http.NotFoundHandler())
+
+		if !graceful.AcceptingWork() {
+			t.Fatalf("server %d: graceful.AcceptingWork() = false while serving", n)
+		}
+
+		s.Close()
+
+		if !graceful.AcceptingWork() {
+			t.Fatalf("server %d: graceful.AcceptingWork() = false once shut down", n)
+		}
+	}
+}
+
+func TestSignals(t *testing.T) {
+	sigs := NewSignals()
+
+	var ignored []string
+
+	s := NewServer(http.NotFoundHandler(), graceful.WithSignalSource(sigs), graceful.WithShutdownSignals(graceful.ContainerSignals()...),
+		graceful.WithEventHandler(func(e graceful.Event) {
+			if e.Kind == graceful.IgnoredSignalEvent {
+				ignored = append(ignored, e.Source)
+			}
+		}))
+
+	// Received before the shutdown signal, as it is sent first
+	sigs.Send(os.Interrupt)
+	sigs.Send(syscall.SIGTERM)
+
+	report := s.Wait()
+
+	if got, want := report.Signal, syscall.SIGTERM.String(); got != want {
+		t.Fatalf("report.Signal = %q, want %q", got, want)
+	}
+
+	if len(ignored) != 1 || ignored[0] != os.Interrupt.String() {
+		t.Fatalf("ignored %q, want %q", ignored, os.Interrupt.String())
+	}
+}
+
+type handler struct {
+	serve    func(w http.ResponseWriter, r *http.Request)
+	shutdown bool
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r)
+}
+
+func (h *handler) Shutdown(ctx context.Context) error {
+	h.shutdown = true
+	return nil
+}
@@ -0,0 +1,223 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Group runs several servers under one Instance, so that a single
+// shutdown signal drains all of them concurrently, sharing one timeout
+type Group struct {
+	*Instance
+}
+
+// NewGroup returns an empty Group, add servers to it using Add and AddTLS
+func NewGroup(opts ...Option) *Group {
+	i := newInstance(nil, nil, opts...)
+	i.members = i.members[1:]
+
+	return &Group{i}
+}
+
+// Add adds a server that is served using s.ListenAndServe
+func (g *Group) Add(name string, s Server) {
+	g.members = append(g.members, &member{
+		name:   name,
+		server: s,
+		serve: func(ctx context.Context) error {
+			return g.serveHTTP(ctx, name, s)
+		},
+	})
+}
+
+// AddTLS adds a server that is served using s.ListenAndServeTLS
+func (g *Group) AddTLS(name string, s TLSServer, certFile, keyFile string) {
+	g.members = append(g.members, &member{
+		name:   name,
+		server: s,
+		serve: func(ctx context.Context) error {
+			return g.serveHTTPS(ctx, name, s, certFile, keyFile)
+		},
+		tls: true,
+	})
+}
+
+// Listener controls how one of the servers in a Group is shut down
+type Listener struct {
+	g *Group
+	m *member
+}
+
+// Listener returns the server added to the Group as name,
+// it panics if there is none
+func (g *Group) Listener(name string) *Listener {
+	for _, m := range g.members {
+		if m.name == name {
+			return &Listener{g, m}
+		}
+	}
+
+	panic(fmt.Sprintf("graceful: no listener named %q", name))
+}
+
+// ShutdownFirst drains the server before the others,
+// which begin draining once it has drained
+func (l *Listener) ShutdownFirst() *Listener {
+	l.m.stage = -1
+
+	return l
+}
+
+// ShutdownLastReserve is the part of the shared timeout kept for a server
+// marked using ShutdownLast, unless Reserve is used
+var ShutdownLastReserve = time.Second
+
+// ShutdownLast keeps the server running until the others have drained,
+// reserving ShutdownLastReserve of the shared timeout for its own drain
+func (l *Listener) ShutdownLast() *Listener {
+	l.m.stage = 1
+
+	if l.m.reserve == 0 {
+		l.m.reserve = ShutdownLastReserve
+	}
+
+	return l
+}
+
+// Order sets the order the server is drained in, servers of a lower order
+// are drained before those of a higher one, which keep running until then.
+// Servers are of order 0 by default, ShutdownFirst sets -1, ShutdownLast 1.
+func (l *Listener) Order(n int) *Listener {
+	l.m.stage = n
+
+	return l
+}
+
+// After drains the server once the servers added as names have drained,
+// in a later stage than theirs, such as a callback server after the ingress
+// whose requests call it. It panics if there is no server of one of the
+// names, or if it would make the order circular.
+func (l *Listener) After(names ...string) *Listener {
+	for _, name := range names {
+		dep := l.g.Listener(name).m
+
+		if dep == l.m || dependsOn(dep, l.m) {
+			panic(fmt.Sprintf("graceful: %q cannot drain after %q, which drains after it", l.m.name, name))
+		}
+
+		l.m.after = append(l.m.after, dep)
+	}
+
+	return l
+}
+
+// dependsOn reports whether m is drained after dep, see After
+func dependsOn(m, dep *member) bool {
+	for _, d := range m.after {
+		if d == dep || dependsOn(d, dep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// order returns the order m is drained in, the order set by Order, or one
+// more than the highest order of the servers it is drained after
+func (m *member) order() int {
+	o := m.stage
+
+	for _, d := range m.after {
+		if do := d.order() + 1; do > o {
+			o = do
+		}
+	}
+
+	return o
+}
+
+// StageTimeout limits the drain of the servers of order n, see Order, to d,
+// within the timeout shared by the Group, so that a slow stage leaves time
+// for the stages after it
+func (g *Group) StageTimeout(n int, d time.Duration) *Group {
+	if g.stageTimeouts == nil {
+		g.stageTimeouts = map[int]time.Duration{}
+	}
+
+	g.stageTimeouts[n] = d
+
+	return g
+}
+
+// Reserve keeps d of the shared timeout for the drain of the server, so
+// that the servers drained before it have to have drained d before the
+// deadline, at most half of what is left of the timeout is kept
+func (l *Listener) Reserve(d time.Duration) *Listener {
+	l.m.reserve = d
+
+	return l
+}
+
+// Timeout limits the drain of the server to d,
+// within the timeout shared by the Group
+func (l *Listener) Timeout(d time.Duration) *Listener {
+	l.m.timeout = d
+
+	return l
+}
+
+// stages returns the members grouped by the order they are drained in
+func stages(ms []*member) [][]*member {
+	sorted := append([]*member(nil), ms...)
+
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].order() < sorted[b].order()
+	})
+
+	var ss [][]*member
+
+	for n, m := range sorted {
+		if n == 0 || m.order() != sorted[n-1].order() {
+			ss = append(ss, nil)
+		}
+
+		ss[len(ss)-1] = append(ss[len(ss)-1], m)
+	}
+
+	return ss
+}
+
+// reserves returns, for each of ss, the time reserved by the stages after it
+func reserves(ss [][]*member) []time.Duration {
+	rs := make([]time.Duration, len(ss))
+
+	for n := len(ss) - 2; n >= 0; n-- {
+		var max time.Duration
+
+		for _, m := range ss[n+1] {
+			if m.reserve > max {
+				max = m.reserve
+			}
+		}
+
+		rs[n] = rs[n+1] + max
+	}
+
+	return rs
+}
+
+// ListenAndServeBoth serves h over HTTP on httpAddr and over HTTPS on
+// httpsAddr, until both are shut down by a single signal
+func ListenAndServeBoth(httpAddr, httpsAddr, certFile, keyFile string, h http.Handler, opts ...Option) {
+	g := NewGroup(append([]Option{WithLogger(logger), withFatal()}, opts...)...)
+
+	g.Add("http", &http.Server{Addr: httpAddr, Handler: h})
+	g.AddTLS("https", &http.Server{Addr: httpsAddr, Handler: h}, certFile, keyFile)
+
+	if err := g.Run(context.Background()); err != nil && g.cfg.strict {
+		exit(ExitCode(err))
+	}
+}
@@ -0,0 +1,368 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	t.Run("drains all servers", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		var shutdowns int32
+
+		h := &countingHandler{&shutdowns}
+
+		var g *Group
+
+		listening := 0
+
+		// Shut down once both servers are bound, so that both are logged
+		g = NewGroup(WithLogger(log.New(&buf, "", 0)), WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				if listening++; listening == 2 {
+					g.Shutdown()
+				}
+			}
+		}))
+
+		g.Add("http", &http.Server{Addr: "127.0.0.1:0", Handler: h})
+		g.AddTLS("https", &http.Server{Addr: "127.0.0.1:0", Handler: h}, "testdata/server.crt", "testdata/server.key")
+
+		if err := g.Run(context.Background()); err != nil {
+			t.Fatalf("g.Run() = %v, want nil", err)
+		}
+
+		s := buf.String()
+
+		for _, want := range []string{
+			"Listening on http://127.0.0.1:",
+			"Listening on https://127.0.0.1:",
+		} {
+			if !strings.Contains(s, want) {
+				t.Fatalf("log output does not include %q", want)
+			}
+		}
+
+		if got, want := strings.Count(s, FinishedHTTP), 2; got != want {
+			t.Fatalf("servers drained = %d, want %d", got, want)
+		}
+
+		if got, want := atomic.LoadInt32(&shutdowns), int32(1); got != want {
+			t.Fatalf("shared handler shut down %d times, want %d", got, want)
+		}
+	})
+
+	t.Run("bind failure", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		g := NewGroup()
+
+		g.Add("public", &http.Server{Addr: "127.0.0.1:0"})
+		g.Add("taken", &http.Server{Addr: ln.Addr().String()})
+
+		if err := g.Run(context.Background()); err == nil {
+			t.Fatalf("g.Run() = nil, want error")
+		}
+	})
+
+	t.Run("partial bind failure", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		var events []Event
+
+		var g *Group
+
+		g = NewGroup(WithPartialFailure(), WithEventHandler(func(e Event) {
+			events = append(events, e)
+
+			if e.Kind == ErrorEvent && e.Server == "taken" {
+				go g.Shutdown()
+			}
+		}))
+
+		g.Add("public", &http.Server{Addr: "127.0.0.1:0"})
+		g.Add("taken", &http.Server{Addr: ln.Addr().String()})
+
+		if err := g.Run(context.Background()); err != nil {
+			t.Fatalf("g.Run() = %v, want nil", err)
+		}
+
+		if got, want := events[len(events)-2].Kind, FinishedEvent; got != want {
+			t.Fatalf("last logged event = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("partial bind failure of all servers", func(t *testing.T) {
+		g := NewGroup(WithPartialFailure())
+
+		g.Add("first", &http.Server{Addr: "invalid:address:0"})
+		g.Add("second", &http.Server{Addr: "invalid:address:0"})
+
+		if err := g.Run(context.Background()); err == nil {
+			t.Fatalf("g.Run() = nil, want error")
+		}
+	})
+}
+
+func TestGroupListener(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		drained []string
+	)
+
+	var serving sync.WaitGroup
+
+	// server records the order the servers are drained in
+	server := func(name string, shutdown func(ctx context.Context) error) Server {
+		stop := make(chan struct{})
+
+		serving.Add(1)
+
+		return ServerFunc(func() error {
+			serving.Done()
+			<-stop
+			return nil
+		}, func(ctx context.Context) error {
+			defer close(stop)
+
+			err := shutdown(ctx)
+
+			mu.Lock()
+			drained = append(drained, name)
+			mu.Unlock()
+
+			return err
+		})
+	}
+
+	wait := func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	g := NewGroup(WithLogger(log.New(&buf, "", 0)))
+
+	g.Add("admin", server("admin", wait))
+	g.Add("public", server("public", wait))
+	g.Add("unix", server("unix", wait))
+	g.Add("slow", server("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	g.Listener("admin").ShutdownLast()
+	g.Listener("public").ShutdownFirst().Timeout(time.Second)
+	g.Listener("slow").Timeout(50 * time.Millisecond)
+
+	go func() {
+		serving.Wait()
+		g.Shutdown()
+	}()
+
+	err := g.Run(context.Background())
+
+	var pe *PhaseError
+	if !errors.As(err, &pe) || pe.Phase != DrainPhase || pe.Name != "slow" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("g.Run() = %v, want the drain of slow to time out", err)
+	}
+
+	if got := strings.Join(drained, ","); got != "public,unix,slow,admin" {
+		t.Fatalf("drained %s, want public first and admin last", got)
+	}
+
+	r := g.Report()
+
+	if got, want := len(r.Listeners), 4; got != want {
+		t.Fatalf("len(r.Listeners) = %d, want %d", got, want)
+	}
+
+	for _, l := range r.Listeners {
+		switch l.Name {
+		case "public":
+			if l.Timeout != time.Second || l.Err != nil {
+				t.Fatalf("public listener report = %+v, want a timeout of 1s and no error", l)
+			}
+		case "slow":
+			if l.Timeout != 50*time.Millisecond || !errors.Is(l.Err, context.DeadlineExceeded) {
+				t.Fatalf("slow listener report = %+v, want a timeout of 50ms and a deadline error", l)
+			}
+		default:
+			if l.Timeout <= time.Second || l.Err != nil {
+				t.Fatalf("%s listener report = %+v, want the shared timeout and no error", l.Name, l)
+			}
+		}
+	}
+
+	if s := buf.String(); !strings.Contains(s, "Drained public in ") || !strings.Contains(s, " of 1s\n") {
+		t.Fatalf("log output does not include the drain of public:\n%s", s)
+	}
+
+	t.Run("unknown name", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("g.Listener(\"missing\") did not panic")
+			}
+		}()
+
+		g.Listener("missing")
+	})
+}
+
+func TestGroupListenerReserve(t *testing.T) {
+	left := make(chan time.Duration, 2)
+
+	// server records the time left to drain it, waiting for the deadline
+	server := func(ctx context.Context) error {
+		d, _ := Remaining(ctx)
+		left <- d
+
+		<-ctx.Done()
+		return nil
+	}
+
+	g := NewGroup(WithShutdownTimeout(400 * time.Millisecond))
+
+	var serving sync.WaitGroup
+
+	for _, name := range []string{"admin", "main"} {
+		stop := make(chan struct{})
+
+		serving.Add(1)
+
+		g.Add(name, ServerFunc(func() error {
+			serving.Done()
+			<-stop
+			return nil
+		}, func(ctx context.Context) error {
+			defer close(stop)
+			return server(ctx)
+		}))
+	}
+
+	g.Listener("admin").Order(2).Reserve(100 * time.Millisecond)
+
+	go func() {
+		serving.Wait()
+		g.Shutdown()
+	}()
+
+	g.Run(context.Background())
+
+	// main must have drained with 100ms to spare for admin
+	if main, admin := <-left, <-left; main > 300*time.Millisecond || admin < 50*time.Millisecond {
+		t.Fatalf("drained main with %s, admin with %s left, want 300ms and 100ms", main, admin)
+	}
+}
+
+func TestGroupListenerAfter(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		drained []string
+	)
+
+	var stages []string
+
+	g := NewGroup(WithShutdownTimeout(time.Second), WithEventHandler(func(e Event) {
+		if e.Kind == GroupStageEvent {
+			stages = append(stages, e.String())
+		}
+	}))
+
+	var serving sync.WaitGroup
+
+	for _, name := range []string{"callbacks", "ingress", "grpc"} {
+		name, stop := name, make(chan struct{})
+
+		serving.Add(1)
+
+		g.Add(name, ServerFunc(func() error {
+			serving.Done()
+			<-stop
+			return nil
+		}, func(ctx context.Context) error {
+			defer close(stop)
+
+			mu.Lock()
+			drained = append(drained, name)
+			mu.Unlock()
+
+			if name == "grpc" {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			return nil
+		}))
+	}
+
+	g.Listener("ingress").After("grpc")
+	g.Listener("callbacks").After("ingress", "grpc")
+	g.StageTimeout(0, 50*time.Millisecond)
+
+	go func() {
+		serving.Wait()
+		g.Shutdown()
+	}()
+
+	// The stage timeout of grpc leaves the rest of the shared one to the others
+	var pe *PhaseError
+	if err := g.Run(context.Background()); !errors.As(err, &pe) || pe.Name != "grpc" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("g.Run() = %v, want the drain of grpc to time out", err)
+	}
+
+	if got := strings.Join(drained, ","); got != "grpc,ingress,callbacks" {
+		t.Fatalf("drained %s, want grpc, ingress, then callbacks", got)
+	}
+
+	if len(stages) != 3 || stages[0] != "Draining stage 1 of 3 (grpc) within 50ms" ||
+		!strings.HasPrefix(stages[2], "Draining stage 3 of 3 (callbacks) within ") {
+		t.Fatalf("stages logged %q, want the three stages", stages)
+	}
+
+	for _, l := range g.Report().Listeners {
+		if want := map[string]int{"grpc": 1, "ingress": 2, "callbacks": 3}[l.Name]; l.Tier == nil || *l.Tier != want {
+			t.Fatalf("%s listener report has tier %v, want %d", l.Name, l.Tier, want)
+		}
+	}
+
+	t.Run("circular", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("g.Listener(\"grpc\").After(\"callbacks\") did not panic")
+			}
+		}()
+
+		g.Listener("grpc").After("callbacks")
+	})
+}
+
+type countingHandler struct {
+	shutdowns *int32
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (h *countingHandler) Shutdown(ctx context.Context) error {
+	atomic.AddInt32(h.shutdowns, 1)
+	return nil
+}
@@ -0,0 +1,165 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+var (
+	hijacksMu sync.Mutex
+	hijacks   []*Hijacks
+)
+
+// Hijacks holds hijacked connections, such as websockets, that every
+// Instance waits for once its servers have drained, until the deadline,
+// then closing those still open
+type Hijacks struct {
+	mu    sync.Mutex
+	conns map[*hijack]bool
+
+	// finished counts the connections whose done function has been called
+	finished int
+
+	// changed is closed, and replaced, whenever a connection is done
+	changed chan struct{}
+}
+
+type hijack struct {
+	c net.Conn
+}
+
+// HijackRegistry returns a new registry of hijacked connections
+//
+//	c, _, err := w.(http.Hijacker).Hijack()
+//	if err != nil {
+//		return
+//	}
+//
+//	done := hijacks.Add(c)
+//	defer done()
+func HijackRegistry() *Hijacks {
+	h := &Hijacks{conns: map[*hijack]bool{}, changed: make(chan struct{})}
+
+	hijacksMu.Lock()
+	hijacks = append(hijacks, h)
+	hijacksMu.Unlock()
+
+	return h
+}
+
+// Add adds c to the registry, returning the function to call once the
+// handler is done with it, which may be called more than once
+func (h *Hijacks) Add(c net.Conn) (done func()) {
+	hc := &hijack{c: c}
+
+	h.mu.Lock()
+	h.conns[hc] = true
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// Already done, or closed at the deadline
+		if !h.conns[hc] {
+			return
+		}
+
+		delete(h.conns, hc)
+		h.finished++
+
+		close(h.changed)
+		h.changed = make(chan struct{})
+	}
+}
+
+// Len returns the number of connections in the registry
+func (h *Hijacks) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.conns)
+}
+
+// mark returns the number of connections open,
+// and the number of those that have been done
+func (h *Hijacks) mark() (open, finished int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.conns), h.finished
+}
+
+// wait waits for the connections to be done, or ctx to be done, and then
+// closes those still open, returning how many were done since mark returned
+// before and how many were closed
+func (h *Hijacks) wait(ctx context.Context, before int) (closed, forced int) {
+	for {
+		h.mu.Lock()
+		open, changed := len(h.conns), h.changed
+		h.mu.Unlock()
+
+		if open == 0 || ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for hc := range h.conns {
+		hc.c.Close()
+		delete(h.conns, hc)
+		forced++
+	}
+
+	return h.finished - before, forced
+}
+
+// hijackMark is a registry returned by HijackRegistry,
+// with the number of its connections done when the drain began
+type hijackMark struct {
+	h        *Hijacks
+	finished int
+}
+
+// markHijacks returns the registries returned by HijackRegistry that have
+// connections open, marking how many have been done
+func markHijacks() []hijackMark {
+	hijacksMu.Lock()
+	hs := append([]*Hijacks(nil), hijacks...)
+	hijacksMu.Unlock()
+
+	var marks []hijackMark
+
+	for _, h := range hs {
+		if open, finished := h.mark(); open > 0 {
+			marks = append(marks, hijackMark{h, finished})
+		}
+	}
+
+	return marks
+}
+
+// waitHijacks waits for the connections of the registries marked when the
+// drain began to be done, or ctx to be done, closing those still open
+func (i *Instance) waitHijacks(ctx context.Context, marks []hijackMark, r *Report) {
+	if len(marks) == 0 {
+		return
+	}
+
+	for _, m := range marks {
+		closed, forced := m.h.wait(ctx, m.finished)
+
+		r.HijacksClosed += closed
+		r.HijacksForceClosed += forced
+	}
+
+	i.emit(Event{Kind: HijacksEvent, Phase: DrainPhase, Report: r})
+}
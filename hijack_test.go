@@ -0,0 +1,119 @@
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHijacks(t *testing.T) {
+	clk := newFakeClock()
+
+	reg := HijackRegistry()
+
+	addrs := make(chan string, 1)
+	hijacked, release := make(chan struct{}, 2), make(chan struct{})
+
+	hs := &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		done := reg.Add(c)
+
+		fmt.Fprint(c, "hijacked\n")
+		hijacked <- struct{}{}
+
+		// The stubborn connection ignores the shutdown
+		if r.URL.Path == "/polite" {
+			<-release
+			c.Close()
+			done()
+		}
+	})}
+
+	var events []Event
+
+	i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+		events = append(events, e)
+
+		if e.Kind == ListeningEvent {
+			addrs <- e.Addr
+		}
+	}), WithClock(clk))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	var conns []*bufio.Reader
+
+	for _, path := range []string{"/polite", "/stubborn"} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		fmt.Fprintf(c, "GET %s HTTP/1.1\r\nHost: localhost\r\n\r\n", path)
+
+		r := bufio.NewReader(c)
+
+		if line, err := r.ReadString('\n'); err != nil || line != "hijacked\n" {
+			t.Fatalf("ReadString() = %q, %v, want %q", line, err, "hijacked\n")
+		}
+
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		conns = append(conns, r)
+	}
+
+	<-hijacked
+	<-hijacked
+
+	i.Shutdown()
+
+	clk.WaitForTimers(1)
+	close(release)
+
+	// Wait for the polite connection to be done before the deadline
+	for reg.Len() > 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clk.Advance(Timeout)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if r := i.Report(); r.HijacksClosed != 1 || r.HijacksForceClosed != 1 {
+		t.Fatalf("report = %d closed and %d force-closed, want 1 and 1", r.HijacksClosed, r.HijacksForceClosed)
+	}
+
+	if _, err := conns[1].ReadByte(); err == nil || os.IsTimeout(err) {
+		t.Fatalf("ReadByte() = %v, want the stubborn connection closed", err)
+	}
+
+	if got, want := reg.Len(), 0; got != want {
+		t.Fatalf("reg.Len() = %d, want %d", got, want)
+	}
+
+	for _, e := range events {
+		if e.Kind == HijacksEvent {
+			if got, want := e.String(), "Closed 1 hijacked connections, force-closed 1 at the deadline"; got != want {
+				t.Fatalf("e.String() = %q, want %q", got, want)
+			}
+
+			return
+		}
+	}
+
+	t.Fatalf("no %q event was emitted", HijacksEvent)
+}
@@ -0,0 +1,113 @@
+package graceful
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the servers returned by NewHTTPServer
+var (
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultIdleTimeout       = 60 * time.Second
+	DefaultMaxHeaderBytes    = http.DefaultMaxHeaderBytes
+)
+
+// ServerOption configures a server returned by NewHTTPServer
+type ServerOption func(*http.Server)
+
+// ServerReadHeaderTimeout sets how long reading the headers of a request
+// may take (defaults to DefaultReadHeaderTimeout)
+func ServerReadHeaderTimeout(d time.Duration) ServerOption {
+	return func(hs *http.Server) {
+		hs.ReadHeaderTimeout = d
+	}
+}
+
+// ServerIdleTimeout sets how long a keep-alive connection may wait for its
+// next request (defaults to DefaultIdleTimeout)
+func ServerIdleTimeout(d time.Duration) ServerOption {
+	return func(hs *http.Server) {
+		hs.IdleTimeout = d
+	}
+}
+
+// ServerMaxHeaderBytes sets the most bytes the headers of a request may have
+// (defaults to DefaultMaxHeaderBytes)
+func ServerMaxHeaderBytes(n int) ServerOption {
+	return func(hs *http.Server) {
+		hs.MaxHeaderBytes = n
+	}
+}
+
+// ServerMiddleware wraps the handler in the Middleware of the Instance that
+// runs the server, with opts, as soon as it does. Until then requests are
+// passed straight to the handler.
+func ServerMiddleware(opts ...MiddlewareOption) ServerOption {
+	return func(hs *http.Server) {
+		hs.Handler = &boundMiddleware{next: hs.Handler, opts: opts}
+	}
+}
+
+// NewHTTPServer returns an *http.Server serving h on addr, with timeouts that
+// keep slow clients from holding on to connections, which any Instance can
+// run. Its ErrorLog is left unset, for the Instance to log through, and its
+// connections are counted by the Instance, see ConnCounts.
+//
+//	hs := graceful.NewHTTPServer(":8080", mux, graceful.ServerMiddleware(
+//		graceful.WithDrainResponse(http.StatusServiceUnavailable, 2*time.Second),
+//	))
+func NewHTTPServer(addr string, h http.Handler, opts ...ServerOption) *http.Server {
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		MaxHeaderBytes:    DefaultMaxHeaderBytes,
+	}
+
+	for _, opt := range opts {
+		opt(hs)
+	}
+
+	return hs
+}
+
+// boundMiddleware is the Middleware set by ServerMiddleware, once bound
+// to the Instance running its server
+type boundMiddleware struct {
+	next http.Handler
+	opts []MiddlewareOption
+
+	h atomic.Pointer[http.Handler]
+}
+
+// bindMiddleware binds the Middleware set by ServerMiddleware on hs, if any, to i
+func (i *Instance) bindMiddleware(hs *http.Server) {
+	bm, ok := hs.Handler.(*boundMiddleware)
+	if !ok {
+		return
+	}
+
+	next := bm.next
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+
+	h := i.Middleware(next, bm.opts...)
+	bm.h.Store(&h)
+}
+
+func (bm *boundMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := bm.h.Load(); h != nil {
+		(*h).ServeHTTP(w, r)
+		return
+	}
+
+	if bm.next == nil {
+		http.DefaultServeMux.ServeHTTP(w, r)
+		return
+	}
+
+	bm.next.ServeHTTP(w, r)
+}
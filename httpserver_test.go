@@ -0,0 +1,43 @@
+package graceful
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	hs := NewHTTPServer(":8080", http.NotFoundHandler(), ServerIdleTimeout(time.Second))
+
+	if hs.Addr != ":8080" || hs.ReadHeaderTimeout != DefaultReadHeaderTimeout || hs.IdleTimeout != time.Second ||
+		hs.MaxHeaderBytes != DefaultMaxHeaderBytes || hs.ErrorLog != nil {
+		t.Fatalf("NewHTTPServer() = %+v, want the defaults, with the idle timeout set", hs)
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	hs := NewHTTPServer(":8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		ServerMiddleware(WithDrainResponse(http.StatusTooManyRequests, 0)))
+
+	i := newInstance(hs, nil)
+
+	get := func() int {
+		rec := httptest.NewRecorder()
+		hs.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		return rec.Code
+	}
+
+	i.beginDrain()
+
+	if got, want := get(), http.StatusOK; got != want {
+		t.Fatalf("status = %d until bound, want %d", got, want)
+	}
+
+	i.bindMiddleware(hs)
+
+	if got, want := get(), http.StatusTooManyRequests; got != want {
+		t.Fatalf("status = %d once bound, while shutting down, want %d", got, want)
+	}
+}
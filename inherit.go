@@ -0,0 +1,240 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InheritedFDsEnv is the environment variable that WithInheritedListeners
+// reads the inherited file descriptors from, unless given another
+var InheritedFDsEnv = "GRACEFUL_FDS"
+
+// WithInheritedListeners makes the Instance serve on listening sockets passed
+// to the process as open file descriptors, listed in the environment variable
+// env, InheritedFDsEnv if empty, such as GRACEFUL_FDS=3,4, instead of binding
+// them itself. Each *http.Server is served on those listening on its Addr,
+// with a server without an Addr served on the rest of them. Run fails if the
+// variable lists a descriptor that is not a listening socket, if a server
+// has none listening on its Addr, or if some of them would not be served.
+// The variable is unset once read, so that a later Run, or a child process,
+// binds as usual, as does the Instance if it is not set.
+func WithInheritedListeners(env string) Option {
+	return func(c *config) {
+		if env == "" {
+			env = InheritedFDsEnv
+		}
+
+		c.inheritEnv = env
+	}
+}
+
+// inheritListeners wraps the file descriptors listed in the environment
+// variable set by WithInheritedListeners, if set, as listeners, and hands
+// them out to the *http.Server servers by their addresses
+func (i *Instance) inheritListeners() error {
+	env := i.cfg.inheritEnv
+
+	fds, ok := os.LookupEnv(env)
+	if !ok {
+		return nil
+	}
+
+	os.Unsetenv(env)
+
+	lns, err := fileListeners(env, fds)
+	if err != nil {
+		return err
+	}
+
+	inherited, err := matchListeners(env, lns, i.members)
+	if err != nil {
+		for _, ln := range lns {
+			ln.Close()
+		}
+
+		return err
+	}
+
+	i.inheritMu.Lock()
+	i.inherited = inherited
+	i.inheritMu.Unlock()
+
+	return nil
+}
+
+// fileListeners returns a listener for each of the comma separated file
+// descriptors in fds, listed in the environment variable env, checking that
+// all of them are numbers before taking any of them
+func fileListeners(env, fds string) ([]net.Listener, error) {
+	var nums []int
+
+	for _, s := range strings.Split(fds, ",") {
+		fd, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("graceful: invalid %s %q: %q is not a file descriptor", env, fds, s)
+		}
+
+		nums = append(nums, fd)
+	}
+
+	var lns []net.Listener
+
+	for _, fd := range nums {
+		ln, err := fileListener(env, fd)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+
+			return nil, err
+		}
+
+		lns = append(lns, ln)
+	}
+
+	return lns, nil
+}
+
+// fileListener returns a listener for the file descriptor fd, closing fd
+func fileListener(env string, fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), env+" fd "+strconv.Itoa(fd))
+	if f == nil {
+		return nil, fmt.Errorf("graceful: %s fd %d is not open", env, fd)
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("graceful: %s fd %d is not a listening socket: %v", env, fd, err)
+	}
+
+	return ln, nil
+}
+
+// matchListeners hands out lns to the *http.Server servers of members,
+// first to those listening on their addresses, then the rest of them
+// to a server without an address
+func matchListeners(env string, lns []net.Listener, members []*member) (map[*http.Server][]net.Listener, error) {
+	inherited := map[*http.Server][]net.Listener{}
+	taken := make([]bool, len(lns))
+
+	var unaddressed *http.Server
+
+	for _, m := range members {
+		hs, ok := m.server.(*http.Server)
+		if !ok || m.serve == nil {
+			continue
+		}
+
+		if hs.Addr == "" {
+			unaddressed = hs
+			continue
+		}
+
+		for n, ln := range lns {
+			if !taken[n] && listensOn(ln, hs.Addr) {
+				inherited[hs] = append(inherited[hs], ln)
+				taken[n] = true
+			}
+		}
+
+		if len(inherited[hs]) == 0 {
+			return nil, fmt.Errorf("graceful: %s has no listener for %s", env, hs.Addr)
+		}
+	}
+
+	var unserved []string
+
+	for n, ln := range lns {
+		switch {
+		case taken[n]:
+		case unaddressed != nil:
+			inherited[unaddressed] = append(inherited[unaddressed], ln)
+		default:
+			unserved = append(unserved, inheritedAddr(ln))
+		}
+	}
+
+	if len(unserved) > 0 {
+		return nil, fmt.Errorf("graceful: %s lists %d listeners, no server listens on %s",
+			env, len(lns), strings.Join(unserved, ", "))
+	}
+
+	return inherited, nil
+}
+
+// listensOn reports whether ln listens on addr, on any address with its
+// port if its host is empty
+func listensOn(ln net.Listener, addr string) bool {
+	if path := strings.TrimPrefix(addr, unixPrefix); path != addr {
+		return ln.Addr().Network() == "unix" && ln.Addr().String() == path
+	}
+
+	ta, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if p, err := net.LookupPort("tcp", port); err != nil || p != ta.Port {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return host == "" || ip != nil && ip.Equal(ta.IP)
+}
+
+// inheritedAddr returns the address ln listens on, as an Addr
+func inheritedAddr(ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return unixPrefix + ln.Addr().String()
+	}
+
+	return ln.Addr().String()
+}
+
+// listenFor returns the listeners inherited for hs, see
+// WithInheritedListeners, or else creates them, see listen
+func (i *Instance) listenFor(ctx context.Context, name string, hs *http.Server, defaultAddr string, tls bool) ([]net.Listener, error) {
+	i.inheritMu.Lock()
+	lns := i.inherited[hs]
+	delete(i.inherited, hs)
+	i.inheritMu.Unlock()
+
+	if lns == nil {
+		return i.listen(ctx, name, hs.Addr, defaultAddr, tls)
+	}
+
+	for n, ln := range lns {
+		i.emitListening(Event{Server: name, Addr: inheritedAddr(ln), TLS: tls, Network: family(ln.Addr().Network(), ln)}, ln.Addr())
+
+		lns[n] = i.pausable(i.counting(ln))
+	}
+
+	return lns, nil
+}
+
+// closeInherited closes the inherited listeners that were not served,
+// as the shutdown began before their servers were started
+func (i *Instance) closeInherited() {
+	i.inheritMu.Lock()
+	inherited := i.inherited
+	i.inherited = nil
+	i.inheritMu.Unlock()
+
+	for _, lns := range inherited {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//go:build unix
+
+package graceful
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWithInheritedListeners(t *testing.T) {
+	// inherit returns a copy of the descriptor of a new listener,
+	// which is closed by the Instance, and its address
+	inherit := func(t *testing.T) (string, string) {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		f, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		return dup(t, f), ln.Addr().String()
+	}
+
+	t.Run("serves", func(t *testing.T) {
+		fd, addr := inherit(t)
+
+		setenv(t, []string{"TEST_FDS"}, map[string]string{"TEST_FDS": fd})
+
+		listening := make(chan Event, 1)
+
+		hs := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("inherited"))
+		})}
+
+		i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithInheritedListeners("TEST_FDS"),
+			WithEventHandler(func(e Event) {
+				if e.Kind == ListeningEvent {
+					listening <- e
+				}
+			}))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		if e := <-listening; e.Addr != addr || e.Network != "IPv4" {
+			t.Fatalf("listening on %s over %s, want %s over IPv4", e.Addr, e.Network, addr)
+		}
+
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != "inherited" {
+			t.Fatalf("body = %q, want %q", body, "inherited")
+		}
+
+		if _, ok := os.LookupEnv("TEST_FDS"); ok {
+			t.Fatalf("TEST_FDS is still set")
+		}
+
+		i.Shutdown()
+
+		if err := <-errs; err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		fds  func(t *testing.T) (string, string)
+		err  string
+	}{
+		{"not a number", func(t *testing.T) (string, string) {
+			return "x", "127.0.0.1:0"
+		}, `graceful: invalid TEST_FDS "x": "x" is not a file descriptor`},
+		{"not a socket", func(t *testing.T) (string, string) {
+			f, err := os.Open("testdata/server.crt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			return dup(t, f), "127.0.0.1:0"
+		}, "is not a listening socket"},
+		{"no listener for the address", func(t *testing.T) (string, string) {
+			fd, _ := inherit(t)
+
+			return fd, "127.0.0.1:1"
+		}, "graceful: TEST_FDS has no listener for 127.0.0.1:1"},
+		{"too many listeners", func(t *testing.T) (string, string) {
+			fd, addr := inherit(t)
+			other, _ := inherit(t)
+
+			return fd + "," + other, addr
+		}, "graceful: TEST_FDS lists 2 listeners, no server listens on 127.0.0.1:"},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			fds, addr := tc.fds(t)
+
+			setenv(t, []string{"TEST_FDS"}, map[string]string{"TEST_FDS": fds})
+
+			i := New(&http.Server{Addr: addr}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+				WithInheritedListeners("TEST_FDS"))
+
+			if err := i.Run(context.Background()); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("i.Run() = %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		setenv(t, []string{InheritedFDsEnv}, nil)
+
+		listening := make(chan struct{}, 1)
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+			WithInheritedListeners(""), WithEventHandler(func(e Event) {
+				if e.Kind == ListeningEvent {
+					listening <- struct{}{}
+				}
+			}))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		<-listening
+
+		i.Shutdown()
+
+		if err := <-errs; err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	})
+}
+
+// dup returns a copy of the descriptor of f, not owned by an *os.File
+func dup(t *testing.T, f *os.File) string {
+	t.Helper()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strconv.Itoa(fd)
+}
@@ -0,0 +1,1144 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures an Instance
+type Option func(*config)
+
+type config struct {
+	logger        Logger
+	errorLogger   Logger
+	json          *jsonWriter
+	eventHandlers []func(Event)
+	onError       []func(Phase, error)
+	signals       <-chan os.Signal
+	signalSource  SignalSource
+	clock         Clock
+	shutdownSigs  []os.Signal
+	slowRequests  int
+	normalizePath func(r *http.Request) string
+	requestID     func(r *http.Request) string
+	drainStages   []Stage
+	configReload  *configReloader
+	escalation    EscalationPolicy
+	timeoutDump   io.Writer
+	stackDump     os.Signal
+	parentDeath   *parentDeath
+
+	warmup        func(context.Context) error
+	warmupTimeout time.Duration
+
+	deregister        func(context.Context) error
+	deregisterTimeout time.Duration
+	deregisterAbort   bool
+
+	timeout    time.Duration
+	drainDelay time.Duration
+	veto       func(ctx context.Context) bool
+	vetoWindow time.Duration
+	idleSweep  time.Duration
+
+	noHandlerShutdown bool
+	shutdowners       []Shutdowner
+	resolvers         []func() []Shutdowner
+
+	registry       *Registry
+	budget         BudgetPolicy
+	errorPolicy    ErrorPolicy
+	handlerReserve time.Duration
+	maxBudget      time.Duration
+	budgetTail     time.Duration
+	hardDeadline   time.Duration
+	maxExtension   time.Duration
+
+	listenConfig   *net.ListenConfig
+	network        string
+	splitDualStack bool
+	displayURL     func(addr net.Addr) string
+	pauseMode      *PauseMode
+	inheritEnv     string
+	packetConns    []*packetServer
+
+	protected []string
+
+	partial  bool
+	fatal    bool
+	strict   bool
+	unlogged map[EventKind]bool
+}
+
+// WithLogger sets the logger used by the Instance
+// (defaults to the logger set by LogListenAndServe)
+func WithLogger(l Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithLoggers sets the logger used by the Instance for progress, such as
+// the addresses listened on and the shutdown finishing, to infoLogger, and
+// that used for errors, and for failing fatally, to errorLogger
+//
+//	graceful.WithLoggers(log.New(os.Stdout, "", 0), log.New(os.Stderr, "", 0))
+func WithLoggers(infoLogger, errorLogger Logger) Option {
+	return func(c *config) {
+		c.logger = infoLogger
+		c.errorLogger = errorLogger
+	}
+}
+
+// WithJSONLogging makes the Instance write every event to w as a line of
+// JSON, see Event.MarshalJSON, instead of logging it using the logger
+func WithJSONLogging(w io.Writer) Option {
+	return func(c *config) {
+		c.json = &jsonWriter{w: w}
+	}
+}
+
+// WithEventHandler makes the Instance call fn with every event it emits,
+// in addition to logging it. Events are passed to fn one at a time.
+func WithEventHandler(fn func(Event)) Option {
+	return func(c *config) {
+		c.eventHandlers = append(c.eventHandlers, fn)
+	}
+}
+
+// WithoutLogging stops the Instance from logging the events of kinds,
+// which are still passed to the event handlers. An event whose format
+// string, such as FinishedHTTP, is set to "" is not logged either.
+func WithoutLogging(kinds ...EventKind) Option {
+	return func(c *config) {
+		if c.unlogged == nil {
+			c.unlogged = map[EventKind]bool{}
+		}
+
+		for _, kind := range kinds {
+			c.unlogged[kind] = true
+		}
+	}
+}
+
+// WithSignals makes the Instance wait for shutdown signals on ch
+// instead of registering for os.Interrupt and syscall.SIGTERM
+func WithSignals(ch <-chan os.Signal) Option {
+	return func(c *config) {
+		c.signals = ch
+	}
+}
+
+// WithSignalSource makes the Instance receive every signal it handles,
+// the shutdown signals and those set by WithStackDumpSignal and
+// WithConfigReload, from src instead of os/signal, such as a
+// *gracefultest.Signals that tests send signals with. It replaces the
+// channel set by WithSignals, if used before it.
+func WithSignalSource(src SignalSource) Option {
+	return func(c *config) {
+		c.signals = nil
+		c.signalSource = src
+	}
+}
+
+// WithShutdownSignals makes the Instance shut down on sigs, such as
+// ContainerSignals(), instead of DevSignals(). Those of DevSignals() that are
+// not among sigs are logged and otherwise ignored.
+//
+//	graceful.WithShutdownSignals(graceful.ContainerSignals()...)
+func WithShutdownSignals(sigs ...os.Signal) Option {
+	return func(c *config) {
+		c.shutdownSigs = sigs
+	}
+}
+
+// WithSignalEscalation makes every signal received while shutting down
+// shorten the deadline to what policy returns, such as HalveRemaining(),
+// logging the time left
+func WithSignalEscalation(policy EscalationPolicy) Option {
+	return func(c *config) {
+		c.escalation = policy
+	}
+}
+
+// WithTimeoutDump makes the Instance write the stacks of all goroutines to w
+// when a Shutdowner is abandoned for not returning before the deadline
+func WithTimeoutDump(w io.Writer) Option {
+	return func(c *config) {
+		c.timeoutDump = w
+	}
+}
+
+// WithStackDumpSignal makes the Instance log the stacks of all goroutines
+// when it receives sig, such as syscall.SIGQUIT, and keep serving, instead of
+// letting the runtime dump them and exit. It is registered separately from
+// the shutdown signals.
+func WithStackDumpSignal(sig os.Signal) Option {
+	return func(c *config) {
+		c.stackDump = sig
+	}
+}
+
+// WithWarmup makes Run call fn, for example to fill caches, before listening,
+// failing with its error like a server that fails to start. The call is
+// given timeout, unless it is zero, and is canceled if the Instance is
+// told to shut down, in which case the servers are never started. Once
+// canceled, or timed out, it is abandoned if it has not returned within
+// WarmupGrace.
+func WithWarmup(fn func(ctx context.Context) error, timeout time.Duration) Option {
+	return func(c *config) {
+		c.warmup = fn
+		c.warmupTimeout = timeout
+	}
+}
+
+// WithDeregister makes the Instance call fn, for example to deregister from
+// a load balancer, after receiving the shutdown signal but before the server
+// stops accepting connections. The call gets timeout out of the shutdown
+// timeout, and the drain proceeds even if it fails.
+func WithDeregister(fn func(ctx context.Context) error, timeout time.Duration) Option {
+	return func(c *config) {
+		c.deregister = fn
+		c.deregisterTimeout = timeout
+	}
+}
+
+// WithAbortOnDeregisterError makes the Instance skip the drain, leaving the
+// server running, if the function set by WithDeregister fails
+func WithAbortOnDeregisterError() Option {
+	return func(c *config) {
+		c.deregisterAbort = true
+	}
+}
+
+// WithRegistry makes the Instance shut down the Shutdowners in r,
+// instead of those in the DefaultRegistry
+func WithRegistry(r *Registry) Option {
+	return func(c *config) {
+		c.registry = r
+	}
+}
+
+// WithBudgetPolicy sets how the time remaining after the servers and their
+// handlers have shut down is split between the Shutdowners in the Registry
+// (defaults to SharedBudget)
+func WithBudgetPolicy(p BudgetPolicy) Option {
+	return func(c *config) {
+		c.budget = p
+	}
+}
+
+// WithErrorPolicy sets what happens to the rest of the Shutdowners in the
+// Registry when one of them fails, unless set for it by HookErrorPolicy
+// (defaults to ContinueOnError)
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(c *config) {
+		c.errorPolicy = p
+	}
+}
+
+// WithHandlerShutdown, if enabled is false, stops the Instance from shutting
+// down the handlers of its *http.Server servers that are Shutdowners
+func WithHandlerShutdown(enabled bool) Option {
+	return func(c *config) {
+		c.noHandlerShutdown = !enabled
+	}
+}
+
+// WithShutdowners makes the Instance shut down ss once the servers have
+// drained, concurrently and sharing the deadline, as it does their handlers
+func WithShutdowners(ss ...Shutdowner) Option {
+	return func(c *config) {
+		c.shutdowners = append(c.shutdowners, ss...)
+	}
+}
+
+// WithShutdownerResolver makes the Instance call resolve once the servers
+// have drained, and shut down the Shutdowners it returns along with those
+// set by WithShutdowners, for components created after the Instance, such
+// as those assembled lazily by a dependency injection container
+func WithShutdownerResolver(resolve func() []Shutdowner) Option {
+	return func(c *config) {
+		c.resolvers = append(c.resolvers, resolve)
+	}
+}
+
+// WithShutdownTimeout sets the shutdown timeout of the Instance,
+// instead of Timeout
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithDrainDelay makes the Instance keep serving for d, or until the
+// deadline, once deregistered, so that load balancers stop sending
+// requests before the servers stop accepting them
+func WithDrainDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.drainDelay = d
+	}
+}
+
+// WithIdleSweep makes the Instance close the idle connections of its
+// *http.Server servers every interval while draining, for clients that
+// reuse a connection before Shutdown closes it, logging how many each
+// sweep closed
+func WithIdleSweep(interval time.Duration) Option {
+	return func(c *config) {
+		c.idleSweep = interval
+	}
+}
+
+// WithReservedHandlerBudget makes the drain of the servers stop d before the
+// deadline, leaving at least d for shutting down their handlers. Handlers are
+// shut down also if the drain fails, but only while there is time left.
+func WithReservedHandlerBudget(d time.Duration) Option {
+	return func(c *config) {
+		c.handlerReserve = d
+	}
+}
+
+// WithMaxShutdownBudget clamps the shutdown timeout to max minus tail, for
+// platforms that kill the process a fixed grace period after sending SIGTERM.
+// The tail is left for flushing logs and exiting after the shutdown, and a
+// warning is logged when the timeout is clamped.
+func WithMaxShutdownBudget(max, tail time.Duration) Option {
+	return func(c *config) {
+		c.maxBudget = max
+		c.budgetTail = tail
+	}
+}
+
+// WithHardDeadline makes the Instance exit the process with
+// HardDeadlineExitCode if it has not shut down d after being told to.
+// The servers are closed, and anything still shutting down abandoned,
+// after logging that the deadline was exceeded.
+func WithHardDeadline(d time.Duration) Option {
+	return func(c *config) {
+		c.hardDeadline = d
+	}
+}
+
+// WithListenConfig makes the Instance create the listeners of its
+// *http.Server servers using lc, for example to set socket options
+// in its Control function, and then serve on them
+func WithListenConfig(lc net.ListenConfig) Option {
+	return func(c *config) {
+		c.listenConfig = &lc
+	}
+}
+
+// WithNetwork makes the Instance create the listeners of its *http.Server
+// servers on network, which is "tcp4", "tcp6" or "tcp" (the default)
+func WithNetwork(network string) Option {
+	return func(c *config) {
+		c.network = network
+	}
+}
+
+// WithSplitDualStack makes the Instance also listen on IPv6, on the same port,
+// when listening on all addresses over "tcp" only listened on IPv4, as on
+// platforms without dual-stack sockets. The server is served, and drained,
+// on both listeners.
+func WithSplitDualStack() Option {
+	return func(c *config) {
+		c.splitDualStack = true
+	}
+}
+
+// WithDisplayURL makes the Instance log the URL returned by fn for each address
+// it listens on, such as one with the public hostname of the service, instead
+// of the address itself, overriding DisplayURL. The ListeningEvent still has
+// the address in Addr.
+func WithDisplayURL(fn func(addr net.Addr) string) Option {
+	return func(c *config) {
+		c.displayURL = fn
+	}
+}
+
+// WithProtectedPaths keeps the listeners of the *http.Server servers open
+// while shutting down, serving requests for paths, such as a health check
+// served by HealthHandler, until the shutdown has finished. Every other
+// request is answered with 503 Service Unavailable once the drain begins,
+// and Middleware passes requests for paths to its handler.
+func WithProtectedPaths(paths ...string) Option {
+	return func(c *config) {
+		c.protected = append(c.protected, paths...)
+	}
+}
+
+// WithPartialFailure makes an Instance running several servers keep serving
+// on those that started when others fail, logging the errors. By default
+// all servers are shut down, and the error returned, when one of them fails.
+func WithPartialFailure() Option {
+	return func(c *config) {
+		c.partial = true
+	}
+}
+
+// withFatal makes the Instance call Fatal on the logger when the server fails,
+// as the package level functions always have
+func withFatal() Option {
+	return func(c *config) {
+		c.fatal = true
+	}
+}
+
+// withoutListening stops the Instance from logging the address it listens on,
+// as ListenAndServe never has
+func withoutListening() Option {
+	return WithoutLogging(ListeningEvent, ListeningPacketEvent)
+}
+
+// Instance runs a server until it receives a shutdown signal,
+// or until its Shutdown method is called
+type Instance struct {
+	cfg     config
+	members []*member
+
+	// stageTimeouts limit the drain of the stages of a Group, by order,
+	// see StageTimeout
+	stageTimeouts map[int]time.Duration
+
+	// starters are run by Run, in order, before the server is started
+	starters []func(ctx context.Context) error
+
+	// active is set while Run is running
+	runMu  sync.Mutex
+	active bool
+
+	triggerMu sync.Mutex
+	trigger   chan struct{}
+	triggered bool
+
+	// reason is what triggered the shutdown, and additional the causes
+	// recorded after it, see Reason
+	reasonMu   sync.Mutex
+	reason     Reason
+	additional []Reason
+
+	// draining is closed, and drainCtx canceled, once shutting down begins,
+	// and unready and rejecting then too, unless scheduled by WithDrainStages
+	drainMu     sync.Mutex
+	draining    chan struct{}
+	drainCtx    context.Context
+	cancelDrain context.CancelFunc
+	drained     bool
+	unready     chan struct{}
+	rejecting   chan struct{}
+
+	// resumed is closed once resumed, and nil unless paused, see Pause,
+	// with refused the connections refused meanwhile
+	pauseMu  sync.Mutex
+	resumed  chan struct{}
+	pausedAt time.Time
+	refused  atomic.Int64
+
+	// accepts counts the connections accepted on the listeners created by
+	// the Instance, counted is set once it serves any
+	accepts acceptCounter
+	counted atomic.Bool
+
+	// refusingWork is set once the shutdown has begun, see AcceptingWork,
+	// and refusal while it counts towards that of the process, until Run
+	// returns
+	refusingWork atomic.Bool
+	refusal      atomic.Bool
+
+	// background goroutines, stopped when shutdown begins
+	background sync.WaitGroup
+
+	emitMu sync.Mutex
+
+	// signaled is when Run was told to shut down,
+	// and signal the signal that told it, if any
+	signaled time.Time
+	signal   os.Signal
+
+	// signals is the channel Run receives signals on, while running
+	signals <-chan os.Signal
+
+	// unstarted is set if the shutdown began before the servers were started
+	unstarted bool
+
+	reportMu sync.Mutex
+	report   *Report
+
+	// inherited are the listeners inherited for each server, until it is
+	// served, see WithInheritedListeners
+	inheritMu sync.Mutex
+	inherited map[*http.Server][]net.Listener
+
+	// kept are the servers whose listeners are kept open while shutting down
+	keptMu sync.Mutex
+	kept   map[*http.Server]*kept
+
+	// counts of what was dropped while shutting down, see Report
+	rejected            atomic.Int64
+	forceClosed         atomic.Int64
+	forceClosedRequests atomic.Int64
+	hijackedCut         atomic.Int64
+
+	// aborted are the IDs of the requests whose connections were force
+	// closed, see WithRequestIDExtractor
+	abortedMu sync.Mutex
+	aborted   []string
+
+	// schedule are the stages set by WithDrainStages that were reached
+	scheduleMu sync.Mutex
+	schedule   []StageReport
+
+	// onShutdownRunning counts the callbacks registered by RegisterOnShutdown
+	// that did not return before the deadline
+	onShutdownRunning atomic.Int64
+
+	// extensions are the extensions of the deadline of the shutdown,
+	// see RequestExtension
+	extensions extensions
+
+	// swept counts the idle connections closed by WithIdleSweep
+	swept atomic.Int64
+
+	// stats are the Stats of the shutdown in progress
+	stats shutdownStats
+
+	// result is the result of Run, see Wait
+	result runResult
+}
+
+// member is one of the servers run by an Instance
+type member struct {
+	name   string
+	server Shutdowner
+	serve  func(ctx context.Context) error
+	conns  *connTracker
+	tls    bool
+
+	// stage orders the drain, see Order, timeout limits it, if set,
+	// and reserve is the time kept for it by the stages before, see Reserve
+	stage   int
+	timeout time.Duration
+	reserve time.Duration
+
+	// after are the members drained before it, see After
+	after []*member
+
+	// supervisor replaces the server when it fails, if set
+	supervisor *supervisor
+
+	// packet is set if the server is a net.PacketConn, see WithPacketConn
+	packet bool
+}
+
+// New returns an Instance that serves using s.ListenAndServe
+func New(s Server, opts ...Option) *Instance {
+	i := newInstance(s, nil, opts...)
+
+	i.members[0].serve = func(ctx context.Context) error {
+		return i.serveHTTP(ctx, "", s)
+	}
+
+	return i
+}
+
+// NewTLS returns an Instance that serves using s.ListenAndServeTLS
+func NewTLS(s TLSServer, certFile, keyFile string, opts ...Option) *Instance {
+	i := newInstance(s, nil, opts...)
+
+	i.members[0].serve = func(ctx context.Context) error {
+		return i.serveHTTPS(ctx, "", s, certFile, keyFile)
+	}
+	i.members[0].tls = true
+
+	return i
+}
+
+func newInstance(s Shutdowner, serve func(ctx context.Context) error, opts ...Option) *Instance {
+	i := &Instance{
+		members:   []*member{{server: s, serve: serve}},
+		trigger:   make(chan struct{}),
+		draining:  make(chan struct{}),
+		unready:   make(chan struct{}),
+		rejecting: make(chan struct{}),
+	}
+
+	i.drainCtx, i.cancelDrain = context.WithCancel(context.Background())
+
+	for _, opt := range opts {
+		opt(&i.cfg)
+	}
+
+	i.accepts.clk = i.cfg.clock
+	i.members = append(i.members, i.packetMembers()...)
+
+	return i
+}
+
+// Shutdown makes Run shut down the server as if it had received a signal.
+// It is safe to call Shutdown before Run, and more than once.
+func (i *Instance) Shutdown() {
+	i.triggerShutdown(Reason{Kind: TriggerReason})
+}
+
+// triggerShutdown records r as a reason for the shutdown, and makes Run
+// shut down, like Shutdown
+func (i *Instance) triggerShutdown(r Reason) {
+	i.recordReason(r)
+
+	i.triggerMu.Lock()
+	defer i.triggerMu.Unlock()
+
+	if !i.triggered {
+		i.triggered = true
+		close(i.trigger)
+	}
+}
+
+// begin marks the Instance as running,
+// returning false if it already is
+func (i *Instance) begin() bool {
+	i.runMu.Lock()
+	defer i.runMu.Unlock()
+
+	if i.active {
+		return false
+	}
+
+	i.active = true
+
+	return true
+}
+
+// end marks the Instance as no longer running
+func (i *Instance) end() {
+	i.runMu.Lock()
+	i.active = false
+	i.runMu.Unlock()
+}
+
+// shutdownRequested returns the channel closed by Shutdown
+func (i *Instance) shutdownRequested() <-chan struct{} {
+	i.triggerMu.Lock()
+	defer i.triggerMu.Unlock()
+
+	return i.trigger
+}
+
+// reset prepares the Instance for being run again,
+// once Run has shut it down
+func (i *Instance) reset() {
+	i.triggerMu.Lock()
+	if i.triggered {
+		i.trigger, i.triggered = make(chan struct{}), false
+	}
+	i.triggerMu.Unlock()
+
+	i.drainMu.Lock()
+	if i.drained {
+		i.draining, i.drained = make(chan struct{}), false
+		i.unready, i.rejecting = make(chan struct{}), make(chan struct{})
+		i.drainCtx, i.cancelDrain = context.WithCancel(context.Background())
+	}
+	i.drainMu.Unlock()
+
+	i.pauseMu.Lock()
+	if i.resumed != nil {
+		close(i.resumed)
+		i.resumed = nil
+	}
+	i.pauseMu.Unlock()
+
+	i.signal, i.signaled, i.signals, i.unstarted = nil, time.Time{}, nil, false
+
+	i.closeInherited()
+
+	i.reasonMu.Lock()
+	i.reason, i.additional = Reason{}, nil
+	i.reasonMu.Unlock()
+
+	for _, m := range i.members {
+		if m.supervisor != nil {
+			m.supervisor.reset()
+		}
+	}
+}
+
+// Run starts the server in a goroutine and blocks until a shutdown signal
+// is received, Shutdown is called or ctx is done, then shuts the server down.
+// The error from the server is returned if it fails to start. If the shutdown
+// is requested before the server has started, it is never started, but its
+// handler and the Registry are still shut down.
+//
+// Run can be called again once it has returned, as long as the servers can
+// be served again, which an *http.Server that has been shut down cannot:
+// Run returns ErrAlreadyShutdown for it instead of serving. NewSupervised
+// creates new servers every time it is run. Run returns ErrAlreadyRunning
+// if it is called while already running, and a Shutdown before Run makes
+// Run shut down as soon as it has started.
+func (i *Instance) Run(ctx context.Context) (err error) {
+	if !i.begin() {
+		return ErrAlreadyRunning
+	}
+
+	i.result.start()
+	i.clearReport()
+	defer func() { i.result.finish(i.Report(), err) }()
+
+	i.acceptWork()
+	defer i.releaseRefusal()
+
+	defer i.end()
+	defer i.reset()
+	defer i.releaseRequests()
+
+	trigger := i.shutdownRequested()
+
+	signals, stopSignals := i.notify()
+	defer stopSignals()
+
+	i.signals = signals
+
+	lifecycle, stop := context.WithCancel(context.Background())
+	defer i.background.Wait()
+	defer stop()
+
+	if i.cfg.stackDump != nil {
+		i.dumpStacksOn(lifecycle, i.cfg.stackDump)
+	}
+
+	if i.cfg.parentDeath != nil {
+		i.watchParent(lifecycle, i.cfg.parentDeath)
+	}
+
+	for _, start := range i.starters {
+		if err := phaseError(ServePhase, "", start(lifecycle)); err != nil {
+			if i.cfg.fatal {
+				i.fatal(err)
+			}
+
+			return err
+		}
+	}
+
+	if i.cfg.inheritEnv != "" {
+		if err := phaseError(ServePhase, "", i.inheritListeners()); err != nil {
+			if i.cfg.fatal {
+				i.fatal(err)
+			}
+
+			return err
+		}
+	}
+
+	if i.cfg.configReload != nil {
+		if err := i.startConfigReload(lifecycle); err != nil {
+			if i.cfg.fatal {
+				i.fatal(err)
+			}
+
+			return err
+		}
+	}
+
+	stopped, err := i.warmup(ctx, signals, trigger)
+	if err != nil {
+		if i.cfg.fatal {
+			i.fatal(err)
+		}
+
+		return err
+	}
+
+	// A shutdown requested during startup keeps the servers from listening
+	if !stopped {
+		select {
+		case sig := <-signals:
+			i.signal, stopped = sig, true
+		case <-trigger:
+			stopped = true
+		case <-ctx.Done():
+			stopped = true
+		default:
+		}
+	}
+
+	if stopped {
+		i.signaled, i.unstarted = i.clock().Now(), true
+		i.stoppedBy(ctx)
+
+		defer i.noteContext(ctx)()
+
+		return i.shutdown()
+	}
+
+	i.startLoops()
+
+	errs := make(chan memberError, len(i.members))
+	serving := 0
+
+	for _, m := range i.members {
+		if m.serve == nil {
+			continue
+		}
+
+		i.announce(m)
+
+		if hs, ok := m.server.(*http.Server); ok && m.conns == nil {
+			m.conns = &connTracker{}
+			m.conns.track(hs)
+			i.bindMiddleware(hs)
+			i.trackRequests(m.conns, hs)
+			i.useBaseContext(m.conns, hs)
+			i.useErrorLog(hs, m.name)
+		}
+
+		serving++
+
+		go func(m *member) {
+			err := m.serve(lifecycle)
+
+			// The server was shut down by an earlier run
+			if err == http.ErrServerClosed && !i.shuttingDown() {
+				err = ErrAlreadyShutdown
+			}
+
+			if err != http.ErrServerClosed {
+				errs <- memberError{m, phaseError(ServePhase, m.name, err)}
+			}
+		}(m)
+	}
+
+	for failed := 0; ; {
+		select {
+		case me := <-errs:
+			if failed++; i.cfg.partial && failed < serving {
+				i.emit(Event{Kind: ErrorEvent, Phase: ServePhase, Server: me.m.name, Err: me.err})
+				continue
+			}
+
+			if i.cfg.fatal {
+				i.fatal(me.err)
+			}
+
+			stop()
+
+			i.recordReason(Reason{Kind: ServeErrorReason, Err: me.err})
+
+			// Stop the servers that did start
+			if len(i.members) > 1 {
+				i.shutdownMembers(i.running(me.m))
+			}
+
+			return me.err
+		case sig := <-signals:
+			if i.vetoed(ctx, sig, signals, trigger) {
+				continue
+			}
+
+			if i.signal == nil {
+				i.signal = sig
+			}
+		case <-trigger:
+		case <-ctx.Done():
+		}
+
+		break
+	}
+
+	i.signaled = i.clock().Now()
+	i.stoppedBy(ctx)
+
+	stop()
+
+	// Serve errors no longer matter once draining has begun
+	defer i.logServeErrors(errs)()
+	defer i.noteContext(ctx)()
+
+	return i.shutdown()
+}
+
+// logServeErrors emits the errors received on errs until the returned
+// function is called, after which any errors still buffered are emitted
+func (i *Instance) logServeErrors(errs <-chan memberError) func() {
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	emit := func(me memberError) {
+		i.emit(Event{Kind: ErrorEvent, Phase: DrainPhase, Server: me.m.name, Err: me.err})
+	}
+
+	go func() {
+		defer close(exited)
+
+		for {
+			select {
+			case me := <-errs:
+				emit(me)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+
+		for {
+			select {
+			case me := <-errs:
+				emit(me)
+			default:
+				return
+			}
+		}
+	}
+}
+
+// memberError is an error returned when serving m
+type memberError struct {
+	m   *member
+	err error
+}
+
+// running returns the members, except failed
+func (i *Instance) running(failed *member) []*member {
+	var ms []*member
+
+	for _, m := range i.members {
+		if m != failed {
+			ms = append(ms, m)
+		}
+	}
+
+	return ms
+}
+
+// dumpStacksOn emits a StackDumpEvent every time sig is received,
+// until ctx is done
+func (i *Instance) dumpStacksOn(ctx context.Context, sig os.Signal) {
+	ch, stop := i.signalSource().Notify(sig)
+
+	i.goBackground(ctx, func(ctx context.Context) {
+		defer stop()
+
+		for {
+			select {
+			case <-ch:
+				var buf bytes.Buffer
+
+				pprof.Lookup("goroutine").WriteTo(&buf, 2)
+
+				i.emit(Event{Kind: StackDumpEvent, Stacks: buf.String()})
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// notify returns the channel set by WithSignals, or one that the signals
+// set by WithShutdownSignals, DevSignals() by default, are relayed to until
+// stop is called
+func (i *Instance) notify() (signals <-chan os.Signal, stop func()) {
+	if i.cfg.signals != nil {
+		return i.cfg.signals, func() {}
+	}
+
+	sigs := i.cfg.shutdownSigs
+
+	if len(sigs) == 0 {
+		sigs = DevSignals()
+	}
+
+	ch, stopNotify := i.signalSource().Notify(sigs...)
+	stopIgnoring := i.ignoreSignals(sigs)
+
+	return ch, func() {
+		stopNotify()
+		stopIgnoring()
+	}
+}
+
+// goBackground runs fn in a goroutine that Run waits for before returning,
+// ctx is done once shutdown begins
+func (i *Instance) goBackground(ctx context.Context, fn func(ctx context.Context)) {
+	i.background.Add(1)
+
+	go func() {
+		defer i.background.Done()
+
+		fn(ctx)
+	}()
+}
+
+// announce logs the address the server of m listens on before it is served,
+// unless it is an *http.Server, whose listeners are created, and logged once
+// bound, by the Instance
+func (i *Instance) announce(m *member) {
+	if _, isHTTP := m.server.(*http.Server); isHTTP {
+		// Counted from here on, so that the count is logged
+		// even if shut down before binding
+		i.counted.Store(true)
+		return
+	}
+
+	if addr, network, ok := m.listenAddr(); ok {
+		i.emitListening(Event{Server: m.name, Addr: addr, TLS: m.tls, Network: network}, listenedAddr(addr))
+	}
+}
+
+// listenAddr returns the address the server listens on, and its address
+// family if the server is a ListenAddrer reporting one, for logging
+func (m *member) listenAddr() (addr, family string, ok bool) {
+	if la, isLA := m.server.(ListenAddrer); isLA {
+		network, address := la.ListenAddr()
+
+		switch network {
+		case "unix", "unixpacket":
+			return unixPrefix + address, "", true
+		case "tcp4":
+			family = "IPv4"
+		case "tcp6":
+			family = "IPv6"
+		}
+
+		addr, ok = address, true
+	} else {
+		addr, ok = serverAddr(m.server)
+	}
+
+	if !ok {
+		return "", "", false
+	}
+
+	if strings.HasPrefix(addr, unixPrefix) {
+		return addr, "", true
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", false
+	}
+
+	if host == "" {
+		host = net.IPv4zero.String()
+
+		if family == "IPv6" {
+			host = net.IPv6unspecified.String()
+		}
+	}
+
+	return net.JoinHostPort(host, port), family, true
+}
+
+// serverAddr returns the Addr of s if it is an *http.Server, of the
+// *http.Server returned by its Unwrap method, for a type wrapping one, or
+// returned by its Addr method
+func serverAddr(s Shutdowner) (string, bool) {
+	switch s := s.(type) {
+	case *http.Server:
+		return s.Addr, true
+	case interface{ Unwrap() *http.Server }:
+		if hs := s.Unwrap(); hs != nil {
+			return hs.Addr, true
+		}
+	case interface{ Addr() string }:
+		return s.Addr(), true
+	}
+
+	return "", false
+}
+
+func (i *Instance) logger() Logger {
+	if i.cfg.logger != nil {
+		return i.cfg.logger
+	}
+
+	if logger != nil {
+		return logger
+	}
+
+	return log.New(ioutil.Discard, "", 0)
+}
+
+// errorLogger returns the logger used for errors, see WithLoggers
+func (i *Instance) errorLogger() Logger {
+	if i.cfg.errorLogger != nil {
+		return i.cfg.errorLogger
+	}
+
+	return i.logger()
+}
+
+// emit logs the event and passes it to the event handlers,
+// one event at a time
+func (i *Instance) emit(e Event) {
+	i.emitMu.Lock()
+	defer i.emitMu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = i.clock().Now()
+	}
+
+	if st, ok := i.stats.snapshot(); ok && e.Stats == nil {
+		e.Stats = &st
+	}
+
+	format, args := e.format()
+
+	switch {
+	case e.Kind == ReportEvent, e.Kind == PhaseEvent:
+	case format == "" || i.cfg.unlogged[e.Kind]:
+	case i.cfg.json != nil:
+		i.cfg.json.write(e)
+	default:
+		l := i.logger()
+		if e.isError() {
+			l = i.errorLogger()
+		}
+
+		if kv, ok := l.(KeyValueLogger); ok {
+			kv.Printw(e.String(), e.keysAndValues()...)
+			break
+		}
+
+		l.Printf(format, args...)
+	}
+
+	for _, fn := range i.cfg.eventHandlers {
+		if err := safely(func() error { fn(e); return nil }); err != nil {
+			// Logged, instead of emitted, not to call the handlers again
+			i.errorLogger().Printf(ErrorFormat, fmt.Errorf("event handler: %w", err))
+		}
+	}
+
+	if e.Kind == ErrorEvent && e.Err != nil {
+		for _, fn := range i.cfg.onError {
+			i.callOnError(fn, e)
+		}
+	}
+}
+
+// fatal logs err, then exits the process
+func (i *Instance) fatal(err error) {
+	if i.cfg.json == nil {
+		i.errorLogger().Fatal(err)
+		return
+	}
+
+	i.emit(Event{Kind: ErrorEvent, Phase: ServePhase, Err: err})
+	os.Exit(1)
+}
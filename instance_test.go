@@ -0,0 +1,613 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/TV4/graceful/internal/signaltest"
+)
+
+func TestInstanceRun(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		trigger func(i *Instance, signals chan os.Signal, cancel context.CancelFunc)
+	}{
+		{"shutdown", func(i *Instance, _ chan os.Signal, _ context.CancelFunc) { i.Shutdown() }},
+		{"signal", func(_ *Instance, signals chan os.Signal, _ context.CancelFunc) { signals <- os.Interrupt }},
+		{"context", func(_ *Instance, _ chan os.Signal, cancel context.CancelFunc) { cancel() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			signals := make(chan os.Signal, 1)
+
+			i := New(&http.Server{
+				Addr: "127.0.0.1:0", Handler: &testHandler{log.New(&buf, "", 0)},
+			}, WithSignals(signals))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tc.trigger(i, signals, cancel)
+
+			if err := i.Run(ctx); err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			if s := buf.String(); !strings.Contains(s, "Shutdown in testHandler") {
+				t.Fatalf("log output does not include %q", "Shutdown in testHandler")
+			}
+		})
+	}
+
+	t.Run("shutdown twice", func(t *testing.T) {
+		i := New(&http.Server{Addr: "127.0.0.1:0"})
+
+		i.Shutdown()
+		i.Shutdown()
+
+		if err := i.Run(context.Background()); err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	})
+
+	t.Run("serve error", func(t *testing.T) {
+		i := New(&http.Server{Addr: "invalid:address:0"})
+
+		if err := i.Run(context.Background()); err == nil {
+			t.Fatalf("i.Run() = nil, want error")
+		}
+	})
+
+	t.Run("serve error while draining", func(t *testing.T) {
+		var events []Event
+
+		serveErr := errors.New("accept: use of closed network connection")
+		serving, served := make(chan struct{}), make(chan struct{})
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			<-served
+			return nil
+		}), func(ctx context.Context) error {
+			close(serving)
+			<-ctx.Done()
+			close(served)
+			return serveErr
+		}, WithLogger(fatalLogger{t}), withFatal(), WithEventHandler(func(e Event) {
+			events = append(events, e)
+		}))
+
+		go func() {
+			<-serving
+			i.Shutdown()
+		}()
+
+		if err := i.Run(context.Background()); err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		for _, e := range events {
+			if e.Kind == ErrorEvent && e.Phase == DrainPhase && errors.Is(e.Err, serveErr) {
+				return
+			}
+		}
+
+		t.Fatalf("events do not include the serve error")
+	})
+
+	t.Run("shutdown error", func(t *testing.T) {
+		want := errors.New("shutdown failed")
+
+		serving := make(chan struct{})
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			return want
+		}), func(ctx context.Context) error {
+			close(serving)
+			<-ctx.Done()
+			return http.ErrServerClosed
+		})
+
+		go func() {
+			<-serving
+			i.Shutdown()
+		}()
+
+		if got := i.Run(context.Background()); !errors.Is(got, want) {
+			t.Fatalf("i.Run() = %v, want %v", got, want)
+		}
+	})
+}
+
+// fatalLogger fails the test if Fatal is called
+type fatalLogger struct {
+	t *testing.T
+}
+
+func (l fatalLogger) Printf(format string, v ...interface{}) {}
+
+func (l fatalLogger) Fatal(v ...interface{}) {
+	l.t.Errorf("Fatal(%v) called", v)
+}
+
+// shutdownOnListening makes the Instance shut down, sending it SIGTERM,
+// as soon as it listens
+func shutdownOnListening() Option {
+	sigs := signaltest.New()
+
+	var once sync.Once
+
+	return func(c *config) {
+		WithSignalSource(sigs)(c)
+		WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent || e.Kind == ListeningPacketEvent {
+				once.Do(func() { go sigs.Send(syscall.SIGTERM) })
+			}
+		})(c)
+	}
+}
+
+func TestWithLoggers(t *testing.T) {
+	clk := newFakeClock()
+
+	var info, errs bytes.Buffer
+
+	r := &Registry{}
+	r.Register("db", shutdownFunc(func(context.Context) error { return errors.New("close failed") }))
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r),
+		WithLoggers(log.New(&info, "", 0), log.New(&errs, "", 0)), WithClock(clk))
+
+	if err := i.shutdown(); err == nil {
+		t.Fatalf("i.shutdown() = nil, want an error")
+	}
+
+	wantInfo := "\nServer shutdown with timeout: 15s\nFinished all in-flight HTTP requests\nShut down db in 0s of 15s\nShutdown finished 15s before deadline\n"
+	wantErrs := "Error: cleanup (db): close failed\n1 of 1 cleanup steps failed: db\n"
+
+	if info.String() != wantInfo || errs.String() != wantErrs {
+		t.Fatalf("logged\n%q\nand\n%q, want\n%q\nand\n%q", info.String(), errs.String(), wantInfo, wantErrs)
+	}
+}
+
+func TestWithoutLogging(t *testing.T) {
+	clk := newFakeClock()
+
+	defer func(format string) { FinishedHTTP = format }(FinishedHTTP)
+	FinishedHTTP = ""
+
+	rl := &recordingLogger{order: &[]string{}}
+
+	var kinds []EventKind
+
+	err := New(&http.Server{Addr: "127.0.0.1:0"}, WithLogger(rl), shutdownOnListening(), WithRegistry(&Registry{}),
+		WithoutLogging(ListeningEvent), WithEventHandler(func(e Event) {
+			kinds = append(kinds, e.Kind)
+		}), WithClock(clk)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(rl.lines, ""), fmt.Sprintf(ShutdownConnsFormat+FinishedConnsFormat, Timeout, &Reason{Kind: SignalReason, Signal: syscall.SIGTERM}, 0, 15*time.Second, 0); got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	for _, kind := range []EventKind{ListeningEvent, FinishedHTTPEvent} {
+		if !strings.Contains(fmt.Sprint(kinds), string(kind)) {
+			t.Fatalf("the event handler saw %v, want %s too", kinds, kind)
+		}
+	}
+}
+
+func TestWithDeregister(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithDeregister(func(ctx context.Context) error {
+			clk.Advance(2 * time.Second)
+			return nil
+		}, 5*time.Second), WithClock(clk))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		want := fmt.Sprintf(ShutdownFormat+DeregisteredFormat+FinishedHTTP+FinishedDurationFormat,
+			Timeout, 2*time.Second, 13*time.Second)
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		want := errors.New("deregister failed")
+
+		i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithDeregister(func(ctx context.Context) error {
+			return want
+		}, 5*time.Second), WithClock(clk))
+
+		if got := i.shutdown(); !errors.Is(got, want) {
+			t.Fatalf("i.shutdown() = %v, want %v", got, want)
+		}
+
+		if got := buf.String(); !strings.Contains(got, FinishedHTTP) {
+			t.Fatalf("drain did not proceed after deregister error: %q", got)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var deadline time.Duration
+
+		i := newInstance(&http.Server{}, nil, WithDeregister(func(ctx context.Context) error {
+			deadline, _ = Remaining(ctx)
+			clk.Advance(5 * time.Second)
+			<-ctx.Done()
+			return ctx.Err()
+		}, 5*time.Second), WithClock(clk))
+
+		if got, want := i.shutdown(), context.DeadlineExceeded; !errors.Is(got, want) {
+			t.Fatalf("i.shutdown() = %v, want %v", got, want)
+		}
+
+		if want := 5 * time.Second; deadline != want {
+			t.Fatalf("deregister deadline = %v, want %v", deadline, want)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		clk := newFakeClock()
+
+		want := errors.New("deregister failed")
+
+		drained := false
+
+		i := newInstance(shutdownFunc(func(ctx context.Context) error {
+			drained = true
+			return nil
+		}), nil, WithAbortOnDeregisterError(), WithDeregister(func(ctx context.Context) error {
+			return want
+		}, 5*time.Second), WithClock(clk))
+
+		if got := i.shutdown(); !errors.Is(got, want) {
+			t.Fatalf("i.shutdown() = %v, want %v", got, want)
+		}
+
+		if drained {
+			t.Fatalf("server was drained after deregister error")
+		}
+	})
+}
+
+func TestWithMaxShutdownBudget(t *testing.T) {
+	t.Run("clamped", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		var handlerRemaining time.Duration
+
+		i := newInstance(&http.Server{Handler: shutdownFunc(func(ctx context.Context) error {
+			handlerRemaining, _ = Remaining(ctx)
+			return nil
+		})}, nil, WithLogger(log.New(&buf, "", 0)), WithMaxShutdownBudget(10*time.Second, time.Second), WithClock(clk))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		want := fmt.Sprintf(ClampedFormat+ShutdownFormat, Timeout, 9*time.Second, 9*time.Second)
+
+		if got := buf.String(); !strings.HasPrefix(got, want) {
+			t.Fatalf("buf.String() = %q, want prefix %q", got, want)
+		}
+
+		if want := 9 * time.Second; handlerRemaining != want {
+			t.Fatalf("handler remaining = %v, want %v", handlerRemaining, want)
+		}
+	})
+
+	t.Run("not clamped", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithMaxShutdownBudget(30*time.Second, time.Second), WithClock(clk))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		if want := fmt.Sprintf(ShutdownFormat, Timeout); !strings.HasPrefix(buf.String(), want) {
+			t.Fatalf("buf.String() = %q, want prefix %q", buf.String(), want)
+		}
+	})
+}
+
+func TestSignalBeforeListening(t *testing.T) {
+	// Listening would fail, as the address is already in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	signals := make(chan os.Signal, 1)
+
+	var (
+		handlerShutdown bool
+		cleanedUp       bool
+		kinds           []EventKind
+	)
+
+	r := &Registry{}
+	r.Register("db", shutdownFunc(func(ctx context.Context) error {
+		cleanedUp = true
+		return nil
+	}))
+
+	i := New(&http.Server{Addr: ln.Addr().String(), Handler: shutdownFunc(func(ctx context.Context) error {
+		handlerShutdown = true
+		return nil
+	})}, WithSignals(signals), WithRegistry(r), WithEventHandler(func(e Event) {
+		kinds = append(kinds, e.Kind)
+	}))
+
+	i.starters = append(i.starters, func(context.Context) error {
+		signals <- syscall.SIGTERM
+		return nil
+	})
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if !handlerShutdown || !cleanedUp {
+		t.Fatalf("handler shut down = %v, cleaned up = %v, want both", handlerShutdown, cleanedUp)
+	}
+
+	for _, kind := range kinds {
+		if kind == ListeningEvent || kind == FinishedHTTPEvent {
+			t.Fatalf("events include %q", kind)
+		}
+	}
+
+	if got, want := i.Report().Signal, syscall.SIGTERM.String(); got != want {
+		t.Fatalf("i.Report().Signal = %q, want %q", got, want)
+	}
+}
+
+func TestListenDuringShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	i := New(&http.Server{}, WithNetwork("tcp4"))
+
+	if _, err := i.listen(ctx, "", "127.0.0.1:0", ":http", false); err != http.ErrServerClosed {
+		t.Fatalf("i.listen() = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestInstanceRunAgain(t *testing.T) {
+	addrs := make(chan string, 1)
+	sigs := signaltest.New()
+
+	var servers int
+
+	i := NewSupervised(func() Server {
+		servers++
+
+		return &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "ok")
+		})}
+	}, ExponentialBackoff(time.Millisecond, time.Second), WithNetwork("tcp4"), WithSignalSource(sigs), WithEventHandler(func(e Event) {
+		if e.Kind == ListeningEvent {
+			addrs <- e.Addr
+		}
+	}))
+
+	for cycle := 1; cycle <= 3; cycle++ {
+		errs := make(chan error, 1)
+
+		go func() { errs <- i.Run(context.Background()) }()
+
+		resp, err := http.Get("http://" + <-addrs)
+		if err != nil {
+			t.Fatalf("cycle %d: %v", cycle, err)
+		}
+		resp.Body.Close()
+
+		// Signal handling is armed again by every run
+		if cycle == 2 {
+			sigs.Send(syscall.SIGTERM)
+		} else {
+			i.Shutdown()
+		}
+
+		if err := <-errs; err != nil {
+			t.Fatalf("cycle %d: i.Run() = %v, want nil", cycle, err)
+		}
+
+		report := i.Report()
+
+		if report == nil || report.Err != nil {
+			t.Fatalf("cycle %d: i.Report() = %+v", cycle, report)
+		}
+
+		if cycle == 2 && report.Signal != syscall.SIGTERM.String() {
+			t.Fatalf("cycle %d: report.Signal = %q, want %q", cycle, report.Signal, syscall.SIGTERM.String())
+		}
+	}
+
+	if got, want := servers, 3; got != want {
+		t.Fatalf("servers = %d, want %d", got, want)
+	}
+}
+
+func TestInstanceRunOrderings(t *testing.T) {
+	// run runs i, shutting it down once it is listening, unless it is not told
+	// to, and returns the error and whether it listened
+	run := func(i *Instance, listening chan struct{}, shutdown bool) (error, bool) {
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		select {
+		case <-listening:
+			if shutdown {
+				i.Shutdown()
+			}
+
+			return <-errs, true
+		case err := <-errs:
+			return err, false
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		signal    bool
+		before    func(i *Instance)
+		again     bool
+		want      error
+		listening bool
+	}{
+		{name: "run then shutdown", listening: true},
+		{name: "shutdown before run", before: (*Instance).Shutdown},
+		{name: "signal before run", signal: true},
+		{name: "shutdown twice before run", before: func(i *Instance) { i.Shutdown(); i.Shutdown() }},
+		{name: "run again", again: true, want: ErrAlreadyShutdown, listening: true},
+		{name: "shutdown before running again", before: (*Instance).Shutdown, again: true},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			signals := make(chan os.Signal, 1)
+			listening := make(chan struct{}, 2)
+
+			i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithRegistry(&Registry{}), WithNetwork("tcp4"),
+				WithEventHandler(func(e Event) {
+					if e.Kind == ListeningEvent {
+						listening <- struct{}{}
+					}
+				}))
+
+			if tc.again {
+				if err, _ := run(i, listening, true); err != nil {
+					t.Fatalf("first i.Run() = %v, want nil", err)
+				}
+			}
+
+			if tc.signal {
+				signals <- os.Interrupt
+			}
+
+			if tc.before != nil {
+				tc.before(i)
+			}
+
+			// Run returns by itself if it fails
+			err, listened := run(i, listening, tc.want == nil)
+
+			if !errors.Is(err, tc.want) || (tc.want == nil && err != nil) {
+				t.Fatalf("i.Run() = %v, want %v", err, tc.want)
+			}
+
+			if listened != tc.listening {
+				t.Fatalf("listened = %t, want %t", listened, tc.listening)
+			}
+		})
+	}
+
+	t.Run("run while running", func(t *testing.T) {
+		listening := make(chan struct{}, 1)
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"),
+			WithEventHandler(func(e Event) {
+				if e.Kind == ListeningEvent {
+					listening <- struct{}{}
+				}
+			}))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		<-listening
+
+		if err := i.Run(context.Background()); err != ErrAlreadyRunning {
+			t.Fatalf("second i.Run() = %v, want %v", err, ErrAlreadyRunning)
+		}
+
+		i.Shutdown()
+
+		if err := <-errs; err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	})
+}
+
+func TestConcurrentInstancesShareSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can not be sent to the process on Windows")
+	}
+
+	listening := make(chan struct{}, 2)
+
+	var instances []*Instance
+
+	for n := 0; n < 2; n++ {
+		instances = append(instances, New(&http.Server{Addr: "127.0.0.1:0"}, WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				listening <- struct{}{}
+			}
+		})))
+	}
+
+	errs := make(chan error, len(instances))
+
+	for _, i := range instances {
+		go func(i *Instance) { errs <- i.Run(context.Background()) }(i)
+	}
+
+	<-listening
+	<-listening
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGTERM)
+
+	for range instances {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("not all instances were shut down by the signal")
+		}
+	}
+
+	for n, i := range instances {
+		if got, want := i.Report().Signal, syscall.SIGTERM.String(); got != want {
+			t.Fatalf("instances[%d].Report().Signal = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package signaltest provides the signal source that gracefultest.Signals
+// wraps, and that the package tests of graceful send signals with, as they
+// can not import gracefultest. Tests that are never signaled pass
+// graceful.WithSignals a channel that nothing is sent on instead.
+package signaltest
+
+import (
+	"os"
+	"sync"
+)
+
+// Signals relays the signals sent by Send to the channels returned by Notify
+type Signals struct {
+	mu   sync.Mutex
+	subs map[*subscription]bool
+
+	// changed is closed, and replaced, whenever Notify is called
+	changed chan struct{}
+}
+
+type subscription struct {
+	sigs    []os.Signal
+	ch      chan os.Signal
+	stopped chan struct{}
+}
+
+// New returns a source of signals that none have been sent by
+func New() *Signals {
+	return &Signals{subs: map[*subscription]bool{}, changed: make(chan struct{})}
+}
+
+// Notify returns a channel that the signals among sigs sent by Send are
+// relayed to, until stop is called
+func (s *Signals) Notify(sigs ...os.Signal) (ch <-chan os.Signal, stop func()) {
+	sub := &subscription{sigs: sigs, ch: make(chan os.Signal), stopped: make(chan struct{})}
+
+	s.mu.Lock()
+	s.subs[sub] = true
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+
+	var once sync.Once
+
+	return sub.ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs, sub)
+			s.mu.Unlock()
+
+			close(sub.stopped)
+		})
+	}
+}
+
+// Send waits until sig is waited for, then sends it to every channel
+// waiting for it, returning once each has received it, or been stopped
+func (s *Signals) Send(sig os.Signal) {
+	for {
+		s.mu.Lock()
+
+		var subs []*subscription
+
+		for sub := range s.subs {
+			if sub.wants(sig) {
+				subs = append(subs, sub)
+			}
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(subs) == 0 {
+			<-changed
+			continue
+		}
+
+		for _, sub := range subs {
+			select {
+			case sub.ch <- sig:
+			case <-sub.stopped:
+			}
+		}
+
+		return
+	}
+}
+
+func (sub *subscription) wants(sig os.Signal) bool {
+	for _, s := range sub.sigs {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
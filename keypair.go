@@ -0,0 +1,102 @@
+package graceful
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+// ListenAndServeTLSKeyPair is like ListenAndServeTLS, but with the
+// certificate and key given as PEM encoded bytes instead of files
+func ListenAndServeTLSKeyPair(hs *http.Server, certPEM, keyPEM []byte) {
+	NewTLSKeyPair(hs, certPEM, keyPEM, WithLogger(logger), withFatal(), withoutListening()).Run(context.Background())
+}
+
+// ListenAndServeTLSCertificate is like ListenAndServeTLS, but with an
+// already loaded certificate instead of files
+func ListenAndServeTLSCertificate(hs *http.Server, cert tls.Certificate) {
+	NewTLSCertificate(hs, cert, WithLogger(logger), withFatal(), withoutListening()).Run(context.Background())
+}
+
+// ListenAndServeTLSFS is like ListenAndServeTLS, but with the
+// certificate and key files read from fsys, such as an embed.FS
+func ListenAndServeTLSFS(hs *http.Server, fsys fs.FS, certPath, keyPath string) {
+	NewTLSFS(hs, fsys, certPath, keyPath, WithLogger(logger), withFatal(), withoutListening()).Run(context.Background())
+}
+
+// NewTLSKeyPair returns an Instance that serves TLS using hs, with the
+// certificate and key given as PEM encoded bytes. They are parsed by Run,
+// which returns the error before listening if they are invalid.
+func NewTLSKeyPair(hs *http.Server, certPEM, keyPEM []byte, opts ...Option) *Instance {
+	return newTLSCertificate(hs, func() (tls.Certificate, error) {
+		return parseKeyPair(certPEM, keyPEM)
+	}, opts...)
+}
+
+// NewTLSFS returns an Instance that serves TLS using hs, with the
+// certificate and key files read from fsys. They are read and parsed
+// by Run, which returns the error before listening if they are invalid.
+func NewTLSFS(hs *http.Server, fsys fs.FS, certPath, keyPath string, opts ...Option) *Instance {
+	return newTLSCertificate(hs, func() (tls.Certificate, error) {
+		certPEM, err := fs.ReadFile(fsys, certPath)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("invalid TLS key pair: %w", err)
+		}
+
+		keyPEM, err := fs.ReadFile(fsys, keyPath)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("invalid TLS key pair: %w", err)
+		}
+
+		return parseKeyPair(certPEM, keyPEM)
+	}, opts...)
+}
+
+// NewTLSCertificate returns an Instance that serves TLS using hs with cert
+func NewTLSCertificate(hs *http.Server, cert tls.Certificate, opts ...Option) *Instance {
+	return newTLSCertificate(hs, func() (tls.Certificate, error) {
+		return cert, nil
+	}, opts...)
+}
+
+// newTLSCertificate returns an Instance that serves TLS using hs,
+// with the certificate returned by load added to its TLSConfig on Run
+func newTLSCertificate(hs *http.Server, load func() (tls.Certificate, error), opts ...Option) *Instance {
+	i := newInstance(hs, nil, opts...)
+
+	i.members[0].serve = func(ctx context.Context) error {
+		return i.serveHTTPS(ctx, "", hs, "", "")
+	}
+	i.members[0].tls = true
+
+	i.starters = append(i.starters, func(context.Context) error {
+		cert, err := load()
+		if err != nil {
+			return err
+		}
+
+		cfg := &tls.Config{}
+		if hs.TLSConfig != nil {
+			cfg = hs.TLSConfig.Clone()
+		}
+
+		cfg.Certificates = append([]tls.Certificate{cert}, cfg.Certificates...)
+		hs.TLSConfig = cfg
+
+		return nil
+	})
+
+	return i
+}
+
+// parseKeyPair parses a PEM encoded certificate and key
+func parseKeyPair(certPEM, keyPEM []byte) (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid TLS key pair: %w", err)
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,90 @@
+package graceful
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewTLSKeyPair(t *testing.T) {
+	t.Run("serve", func(t *testing.T) {
+		certPEM, keyPEM := newCert(t, "in-memory")
+
+		hs := &http.Server{Addr: "127.0.0.1:0"}
+
+		if err := NewTLSKeyPair(hs, certPEM, keyPEM, shutdownOnListening()).Run(context.Background()); err != nil {
+			t.Fatalf("Run() = %v, want nil", err)
+		}
+
+		leaf, err := x509.ParseCertificate(hs.TLSConfig.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := leaf.Subject.CommonName, "in-memory"; got != want {
+			t.Fatalf("CommonName = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid key pair", func(t *testing.T) {
+		// Listening would fail with a different error,
+		// as the address is already in use
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		certPEM, _ := newCert(t, "cert")
+		_, keyPEM := newCert(t, "other")
+
+		err = NewTLSKeyPair(&http.Server{Addr: ln.Addr().String()}, certPEM, keyPEM).Run(context.Background())
+
+		if err == nil || !strings.HasPrefix(err.Error(), "serve: invalid TLS key pair") {
+			t.Fatalf("Run() = %v, want invalid key pair error", err)
+		}
+	})
+}
+
+func TestNewTLSFS(t *testing.T) {
+	certPEM, keyPEM := newCert(t, "embedded")
+
+	fsys := fstest.MapFS{
+		"certs/server.crt": {Data: certPEM},
+		"certs/server.key": {Data: keyPEM},
+	}
+
+	t.Run("serve", func(t *testing.T) {
+		hs := &http.Server{Addr: "127.0.0.1:0"}
+
+		if err := NewTLSFS(hs, fsys, "certs/server.crt", "certs/server.key", shutdownOnListening()).Run(context.Background()); err != nil {
+			t.Fatalf("Run() = %v, want nil", err)
+		}
+
+		if got, want := len(hs.TLSConfig.Certificates), 1; got != want {
+			t.Fatalf("len(hs.TLSConfig.Certificates) = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := NewTLSFS(&http.Server{Addr: "127.0.0.1:0"}, fsys, "certs/server.crt", "certs/missing.key").Run(context.Background())
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("Run() = %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+
+	t.Run("invalid key pair", func(t *testing.T) {
+		err := NewTLSFS(&http.Server{Addr: "127.0.0.1:0"}, fsys, "certs/server.key", "certs/server.crt").Run(context.Background())
+
+		if err == nil || !strings.HasPrefix(err.Error(), "serve: invalid TLS key pair") {
+			t.Fatalf("Run() = %v, want invalid key pair error", err)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// unixPrefix starts the Addr of an *http.Server that listens on a unix socket,
+// such as "unix:/run/app.sock", or "unix:@app" for an abstract socket (Linux only)
+const unixPrefix = "unix:"
+
+// serveHTTP serves s using s.ListenAndServe, unless s is an *http.Server,
+// which is served on listeners created by the Instance, counting their
+// connections
+func (i *Instance) serveHTTP(ctx context.Context, name string, s Server) error {
+	hs, ok := s.(*http.Server)
+	if !ok {
+		return s.ListenAndServe()
+	}
+
+	lns, err := i.listenFor(ctx, name, hs, ":http", false)
+	if err != nil {
+		return err
+	}
+
+	lns = i.keep(hs, lns, (*http.Server).Serve)
+
+	return i.served(hs, serveAll(lns, hs.Serve))
+}
+
+// serveHTTPS serves s using s.ListenAndServeTLS, unless s is an *http.Server,
+// which is served on listeners created by the Instance, counting their
+// connections
+func (i *Instance) serveHTTPS(ctx context.Context, name string, s TLSServer, certFile, keyFile string) error {
+	hs, ok := s.(*http.Server)
+	if !ok {
+		return s.ListenAndServeTLS(certFile, keyFile)
+	}
+
+	lns, err := i.listenFor(ctx, name, hs, ":https", true)
+	if err != nil {
+		return err
+	}
+
+	lns = i.keep(hs, lns, func(s *http.Server, ln net.Listener) error {
+		return s.ServeTLS(ln, certFile, keyFile)
+	})
+
+	return i.served(hs, serveAll(lns, func(ln net.Listener) error {
+		return hs.ServeTLS(ln, certFile, keyFile)
+	}))
+}
+
+// configuresListener reports whether the listeners for addr are configured
+// by the options of the Instance, in which case the address families they
+// accept are logged along with the addresses they are bound to
+func (i *Instance) configuresListener(addr string) bool {
+	return i.cfg.listenConfig != nil || i.cfg.network != "" || i.cfg.splitDualStack ||
+		len(i.cfg.protected) > 0 || i.cfg.pauseMode != nil || i.cfg.inheritEnv != "" ||
+		strings.HasPrefix(addr, unixPrefix)
+}
+
+// listen creates the listeners for addr, or defaultAddr if addr is empty,
+// using the ListenConfig set by WithListenConfig, and logs the addresses
+// they are bound to
+func (i *Instance) listen(ctx context.Context, name, addr, defaultAddr string, tls bool) ([]net.Listener, error) {
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	lc := i.cfg.listenConfig
+	if lc == nil {
+		lc = &net.ListenConfig{}
+	}
+
+	if path := strings.TrimPrefix(addr, unixPrefix); path != addr {
+		ln, err := listenUnix(ctx, lc, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if ctx.Err() != nil {
+			ln.Close()
+			return nil, http.ErrServerClosed
+		}
+
+		i.emitListening(Event{Server: name, Addr: addr, TLS: tls}, ln.Addr())
+
+		return []net.Listener{i.pausable(i.counting(ln))}, nil
+	}
+
+	network := i.cfg.network
+	if network == "" {
+		network = "tcp"
+	}
+
+	ln, err := lc.Listen(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	lns := []net.Listener{ln}
+
+	if i.cfg.splitDualStack && network == "tcp" && family(network, ln) == "IPv4" && unspecified(addr) {
+		ln6, err := listenIPv6(ctx, lc, ln)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+
+		lns = append(lns, ln6)
+	}
+
+	// The shutdown began while binding
+	if ctx.Err() != nil {
+		for _, ln := range lns {
+			ln.Close()
+		}
+
+		return nil, http.ErrServerClosed
+	}
+
+	for n, ln := range lns {
+		e := Event{Server: name, Addr: boundAddr(addr, ln), TLS: tls}
+
+		if i.configuresListener(addr) {
+			e.Addr, e.Network = ln.Addr().String(), family(network, ln)
+		}
+
+		i.emitListening(e, ln.Addr())
+
+		lns[n] = i.pausable(i.counting(ln))
+	}
+
+	return lns, nil
+}
+
+// emitListening emits e as a ListeningEvent for addr, unless listening
+// is not logged
+func (i *Instance) emitListening(e Event, addr net.Addr) {
+	e.Kind, e.Phase = ListeningEvent, ServePhase
+
+	if displayURL := i.cfg.displayURL; displayURL != nil {
+		e.URL = displayURL(addr)
+	} else if DisplayURL != nil {
+		e.URL = DisplayURL(addr)
+	}
+
+	i.emit(e)
+}
+
+// listenedAddr is the address of a server that creates its own listeners
+type listenedAddr string
+
+func (a listenedAddr) Network() string {
+	if strings.HasPrefix(string(a), unixPrefix) {
+		return "unix"
+	}
+
+	return "tcp"
+}
+
+func (a listenedAddr) String() string { return strings.TrimPrefix(string(a), unixPrefix) }
+
+// listenUnix listens on the unix socket at path, removing any socket left
+// behind at path by a previous process. A path starting with @ is an
+// abstract socket, which has no file.
+func listenUnix(ctx context.Context, lc *net.ListenConfig, path string) (net.Listener, error) {
+	if strings.HasPrefix(path, "@") {
+		if !abstractUnixSockets {
+			return nil, fmt.Errorf("abstract unix socket %q is only supported on Linux", path)
+		}
+
+		return lc.Listen(ctx, "unix", path)
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return lc.Listen(ctx, "unix", path)
+}
+
+// listenIPv6 listens on the IPv6 unspecified address,
+// on the same port as the IPv4 listener ln4
+func listenIPv6(ctx context.Context, lc *net.ListenConfig, ln4 net.Listener) (net.Listener, error) {
+	_, port, err := net.SplitHostPort(ln4.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	return lc.Listen(ctx, "tcp6", net.JoinHostPort(net.IPv6unspecified.String(), port))
+}
+
+// family returns the address families that ln, listening on network,
+// accepts connections over
+func family(network string, ln net.Listener) string {
+	switch network {
+	case "tcp4":
+		return "IPv4"
+	case "tcp6":
+		return "IPv6"
+	}
+
+	ta, ok := ln.Addr().(*net.TCPAddr)
+	switch {
+	case !ok:
+		return network
+	case ta.IP.To4() != nil:
+		return "IPv4"
+	case ta.IP.IsUnspecified():
+		return "dual-stack"
+	}
+
+	return "IPv6"
+}
+
+// boundAddr returns the address ln is bound to, keeping the host of addr,
+// 0.0.0.0 if empty, when that listens on all addresses
+func boundAddr(addr string, ln net.Listener) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || !unspecified(addr) {
+		return ln.Addr().String()
+	}
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		return ln.Addr().String()
+	}
+
+	if host == "" {
+		host = net.IPv4zero.String()
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// unspecified reports whether addr listens on all addresses
+func unspecified(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return host == "" || ip != nil && ip.IsUnspecified()
+}
+
+// serveAll serves on every listener in lns, closing all of them
+// once serving on one of them fails
+func serveAll(lns []net.Listener, serve func(net.Listener) error) error {
+	if len(lns) == 1 {
+		return serve(lns[0])
+	}
+
+	errs := make(chan error, len(lns))
+
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			errs <- serve(ln)
+		}(ln)
+	}
+
+	var first error
+
+	for range lns {
+		err := <-errs
+
+		if first == nil {
+			first = err
+
+			if err != http.ErrServerClosed {
+				for _, ln := range lns {
+					ln.Close()
+				}
+			}
+		}
+	}
+
+	return first
+}
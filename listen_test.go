@@ -0,0 +1,353 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithListenConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func(hs *http.Server, opts ...Option) *Instance
+	}{
+		{"http", func(hs *http.Server, opts ...Option) *Instance {
+			return New(hs, opts...)
+		}},
+		{"https", func(hs *http.Server, opts ...Option) *Instance {
+			return NewTLS(hs, "testdata/server.crt", "testdata/server.key", opts...)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				once     sync.Once
+				listened = make(chan struct{})
+			)
+
+			lc := WithListenConfig(net.ListenConfig{
+				Control: func(network, address string, c syscall.RawConn) error {
+					once.Do(func() { close(listened) })
+					return nil
+				},
+			})
+
+			i := tc.new(&http.Server{Addr: "127.0.0.1:0"}, lc)
+
+			go func() {
+				<-listened
+				i.Shutdown()
+			}()
+
+			if err := i.Run(context.Background()); err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	t.Run("path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.sock")
+
+		// A socket left behind by a previous process
+		stale, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		testUnixSocket(t, "unix:"+path)
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("socket file not removed on shutdown: %v", err)
+		}
+	})
+
+	t.Run("abstract", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			err := New(&http.Server{Addr: "unix:@graceful-test"}).Run(context.Background())
+
+			if err == nil || !strings.Contains(err.Error(), "only supported on Linux") {
+				t.Fatalf("Run() = %v, want unsupported error", err)
+			}
+
+			return
+		}
+
+		testUnixSocket(t, fmt.Sprintf("unix:@graceful-test-%d", os.Getpid()))
+	})
+}
+
+// testUnixSocket makes a request to a server listening on addr,
+// and checks that the listening log includes addr
+func testUnixSocket(t *testing.T, addr string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	var i *Instance
+
+	i = New(&http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.Shutdown()
+	})}, WithLogger(log.New(&buf, "", 0)))
+
+	errs := make(chan error, 1)
+
+	go func() { errs <- i.Run(context.Background()) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", strings.TrimPrefix(addr, "unix:"))
+		},
+	}}
+
+	for {
+		resp, err := client.Get("http://unix/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+
+		select {
+		case err := <-errs:
+			t.Fatalf("i.Run() = %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if want := fmt.Sprintf(ListeningUnixFormat, addr); !strings.HasPrefix(buf.String(), want) {
+		t.Fatalf("buf.String() = %q, want prefix %q", buf.String(), want)
+	}
+}
+
+func TestWithNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		network string
+		addr    string
+		want    string
+	}{
+		{"tcp4", "127.0.0.1:0", "IPv4"},
+		{"tcp6", "[::1]:0", "IPv6"},
+		{"tcp", ":0", "dual-stack"},
+	} {
+		t.Run(tc.network, func(t *testing.T) {
+			var events []Event
+
+			var i *Instance
+
+			i = New(&http.Server{Addr: tc.addr}, WithNetwork(tc.network), WithEventHandler(func(e Event) {
+				events = append(events, e)
+
+				if e.Kind == ListeningEvent {
+					go i.Shutdown()
+				}
+			}))
+
+			err := i.Run(context.Background())
+			if err != nil && tc.network == "tcp6" {
+				t.Skipf("IPv6 is not available: %v", err)
+			}
+
+			if err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			if got := events[0]; got.Kind != ListeningEvent || got.Network != tc.want || strings.HasSuffix(got.Addr, ":0") {
+				t.Fatalf("events[0] = %+v, want %s listening on the bound port", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestListeningBoundAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		host string
+	}{
+		{"127.0.0.1:0", "127.0.0.1"},
+		{":0", "0.0.0.0"},
+	} {
+		tc := tc
+
+		t.Run(tc.addr, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			i := New(&http.Server{Addr: tc.addr}, WithLogger(log.New(&buf, "", 0)), WithRegistry(&Registry{}),
+				shutdownOnListening())
+
+			if err := i.Run(context.Background()); err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			line := strings.SplitN(buf.String(), "\n", 2)[0]
+
+			host, port, err := net.SplitHostPort(strings.TrimPrefix(line, "Listening on http://"))
+			if err != nil || host != tc.host || port == "0" {
+				t.Fatalf("logged %q, want %s listening on the bound port", line, tc.host)
+			}
+		})
+	}
+}
+
+func TestWithDisplayURL(t *testing.T) {
+	localhost := func(addr net.Addr) string {
+		_, port, _ := net.SplitHostPort(addr.String())
+
+		return "http://localhost:" + port
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		addr string
+	}{
+		{"created listener", []Option{WithNetwork("tcp4")}, "127.0.0.1:0"},
+		{"ListenAndServe", nil, "127.0.0.1:0"},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			var (
+				listening Event
+				i         *Instance
+			)
+
+			i = New(&http.Server{Addr: tc.addr}, append(tc.opts, WithLogger(log.New(&buf, "", 0)), WithDisplayURL(localhost),
+				WithEventHandler(func(e Event) {
+					if e.Kind == ListeningEvent {
+						listening = e
+						go i.Shutdown()
+					}
+				}))...)
+
+			if err := i.Run(context.Background()); err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			_, port, _ := net.SplitHostPort(listening.Addr)
+
+			if got, want := listening.URL, "http://localhost:"+port; got != want {
+				t.Fatalf("listening.URL = %q, want %q", got, want)
+			}
+
+			if !strings.HasPrefix(listening.Addr, "127.0.0.1:") {
+				t.Fatalf("listening.Addr = %q, want the address listened on", listening.Addr)
+			}
+
+			if got, want := strings.SplitN(buf.String(), "\n", 2)[0], "Listening on http://localhost:"+port; got != want {
+				t.Fatalf("logged %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestListenAddrer(t *testing.T) {
+	for _, tc := range []struct {
+		network, address string
+		tls              bool
+		want             string
+	}{
+		{"tcp", ":8080", false, "Listening on http://0.0.0.0:8080"},
+		{"tcp", "127.0.0.1:8443", true, "Listening on https://127.0.0.1:8443"},
+		{"tcp6", ":8080", false, "Listening on http://[::]:8080 (IPv6)"},
+		{"tcp4", "127.0.0.1:8080", true, "Listening on https://127.0.0.1:8080 (IPv4)"},
+		{"unix", "/run/app.sock", false, "Listening on unix:/run/app.sock"},
+	} {
+		tc := tc
+
+		t.Run(tc.network+" "+tc.address, func(t *testing.T) {
+			var got string
+
+			i := newInstance(&listenAddrServer{tc.network, tc.address}, nil, WithEventHandler(func(e Event) {
+				got = e.String()
+			}))
+			i.members[0].tls = tc.tls
+
+			i.announce(i.members[0])
+
+			if got != tc.want {
+				t.Fatalf("logged %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+type listenAddrServer struct {
+	network, address string
+}
+
+func (s *listenAddrServer) ListenAndServe() error              { return http.ErrServerClosed }
+func (s *listenAddrServer) Shutdown(ctx context.Context) error { return nil }
+
+func (s *listenAddrServer) ListenAddr() (network, address string) {
+	return s.network, s.address
+}
+
+func TestListenIPv6(t *testing.T) {
+	ln4, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln4.Close()
+
+	ln6, err := listenIPv6(context.Background(), &net.ListenConfig{}, ln4)
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	defer ln6.Close()
+
+	_, port4, _ := net.SplitHostPort(ln4.Addr().String())
+
+	if got, want := ln6.Addr().String(), net.JoinHostPort("::", port4); got != want {
+		t.Fatalf("ln6.Addr() = %s, want %s", got, want)
+	}
+}
+
+func TestServeAll(t *testing.T) {
+	var lns []net.Listener
+
+	for n := 0; n < 2; n++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lns = append(lns, ln)
+	}
+
+	failed := errors.New("serve failed")
+
+	err := serveAll(lns, func(ln net.Listener) error {
+		if ln == lns[0] {
+			return failed
+		}
+
+		// Blocks until closed by serveAll
+		_, err := ln.Accept()
+		return err
+	})
+
+	if err != failed {
+		t.Fatalf("serveAll() = %v, want %v", err, failed)
+	}
+}
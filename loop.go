@@ -0,0 +1,146 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LoopFailures is the number of times in a row that the function of a Loop
+// has to fail for its error to be logged
+var LoopFailures = 3
+
+type loop struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) error
+
+	// cancel stops the loop, and done is closed once it has stopped,
+	// both set once it is started
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Loop adds fn to the DefaultRegistry, see Registry.Loop
+//
+//	graceful.Loop("cache-refresh", time.Minute, cache.Refresh)
+func Loop(name string, interval time.Duration, fn func(ctx context.Context) error) error {
+	return DefaultRegistry.Loop(name, interval, fn)
+}
+
+// Loop adds fn to the registry, to be called every interval by the Instance
+// running the registry, from the time it starts serving until it shuts down.
+// The loops are stopped, and waited for, once the handlers and Drainers have
+// shut down, before the Shutdowners in the registry, with the ctx passed to fn
+// done. Those still running at the deadline are counted in the report. An
+// error returned by fn LoopFailures times in a row is logged.
+//
+// It returns ErrRegistryClosed once an Instance has begun shutting down the
+// registry.
+func (r *Registry) Loop(name string, interval time.Duration, fn func(ctx context.Context) error) error {
+	l := &loop{name: name, interval: interval, fn: fn}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRegistryClosed
+	}
+
+	r.loops = append(r.loops, l)
+
+	if r.loopRunner != nil {
+		r.loopRunner.runLoop(l)
+	}
+
+	return nil
+}
+
+// startLoops starts the loops of the registry, and makes loops added
+// later start right away, unless another Instance already runs them
+func (i *Instance) startLoops() {
+	r := i.registry()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loopRunner != nil {
+		return
+	}
+
+	r.loopRunner = i
+
+	for _, l := range r.loops {
+		i.runLoop(l)
+	}
+}
+
+// runLoop calls the function of l every interval until it is stopped
+func (i *Instance) runLoop(l *loop) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l.cancel, l.done = cancel, make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		failures := 0
+
+		for {
+			t := i.clock().NewTimer(l.interval)
+
+			select {
+			case <-t.C():
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+
+			err := safely(func() error { return l.fn(ctx) })
+
+			if err == nil || ctx.Err() != nil {
+				failures = 0
+				continue
+			}
+
+			if failures++; failures == LoopFailures {
+				err = phaseError(ServePhase, l.name, fmt.Errorf("failed %d times in a row: %w", failures, err))
+				i.emit(Event{Kind: ErrorEvent, Phase: ServePhase, Name: l.name, Err: err})
+			}
+		}
+	}()
+}
+
+// stopLoops stops the loops of reg run by the Instance, waiting for them
+// until ctx is done, and returns how many were stopped and how many were
+// still running
+func (i *Instance) stopLoops(ctx context.Context, r *Registry) (stopped, running int) {
+	r.mu.Lock()
+
+	var loops []*loop
+
+	if r.loopRunner == i {
+		loops = append(loops, r.loops...)
+	}
+
+	r.mu.Unlock()
+
+	for _, l := range loops {
+		l.cancel()
+	}
+
+	for _, l := range loops {
+		select {
+		case <-l.done:
+			stopped++
+		case <-ctx.Done():
+			running++
+		}
+	}
+
+	if running > 0 {
+		i.emit(Event{Kind: LoopsEvent, Phase: LoopsPhase, Count: running})
+	}
+
+	return stopped, running
+}
@@ -0,0 +1,88 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoop(t *testing.T) {
+	refreshErr := errors.New("refresh failed")
+
+	stuck, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	r := &Registry{}
+
+	r.Loop("refresh", time.Millisecond, func(ctx context.Context) error {
+		return refreshErr
+	})
+
+	events := make(chan Event, 100)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(r),
+		WithShutdownTimeout(100*time.Millisecond), WithEventHandler(func(e Event) {
+			if e.Kind == ErrorEvent || e.Kind == LoopsEvent {
+				events <- e
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	select {
+	case e := <-events:
+		if got, want := e.String(), "Error: serve (refresh): failed 3 times in a row: refresh failed"; got != want {
+			t.Fatalf("e.String() = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the failing loop was not logged")
+	}
+
+	// Added once the Instance runs the loops, and ignoring ctx
+	r.Loop("renew", time.Millisecond, func(ctx context.Context) error {
+		select {
+		case stuck <- struct{}{}:
+		default:
+		}
+
+		<-release
+		return nil
+	})
+
+	<-stuck
+
+	i.Shutdown()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := i.Report().LoopsRunning, 1; got != want {
+		t.Fatalf("i.Report().LoopsRunning = %d, want %d", got, want)
+	}
+
+	var logged []string
+
+	for len(events) > 0 {
+		if e := <-events; e.Kind == LoopsEvent {
+			logged = append(logged, e.String())
+		}
+	}
+
+	if got, want := strings.Join(logged, "\n"), "Abandoned 1 loops that did not stop before deadline"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	if err := r.Loop("late", time.Second, func(context.Context) error { return nil }); err != ErrRegistryClosed {
+		t.Fatalf("r.Loop() = %v once shut down, want %v", err, ErrRegistryClosed)
+	}
+
+	if got, want := len(r.loops), 0; got != want {
+		t.Fatalf("len(r.loops) = %d once shut down, want %d", got, want)
+	}
+}
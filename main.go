@@ -0,0 +1,159 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Exit codes used by Main
+var (
+	// SetupExitCode is used when the setup fails,
+	// or the address in the environment is invalid
+	SetupExitCode = 2
+
+	// FailedExitCode is used when serving, or shutting down, fails
+	FailedExitCode = 1
+)
+
+// Exit codes telling failed shutdowns apart, see WithStrictShutdown
+var (
+	// DrainTimeoutExitCode is used when the drain of a server hit its
+	// deadline, or was cut short by the ForceClose stage
+	DrainTimeoutExitCode = 4
+
+	// HandlerExitCode is used when the Shutdown method of a handler failed
+	HandlerExitCode = 5
+
+	// HookExitCode is used when a hook, such as a Shutdowner in the
+	// Registry, a drainer or the deregistration, failed
+	HookExitCode = 6
+)
+
+// WithStrictShutdown makes a shutdown that failed in any phase exit the
+// process with a code telling the failure apart, see ExitCode, from Main and
+// ListenAndServeBoth, instead of with FailedExitCode, from Main, or 0. Run
+// returns the error either way, pass it to ExitCode to exit the same way.
+func WithStrictShutdown() Option {
+	return func(c *config) {
+		c.strict = true
+	}
+}
+
+// ExitCode returns the exit code used by WithStrictShutdown for err,
+// returned by Run: 0 if it is nil, DrainTimeoutExitCode if a drain hit its
+// deadline, HandlerExitCode if the Shutdown method of a handler failed,
+// HookExitCode if a hook failed, checked in that order, and FailedExitCode
+// for any other error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var drain, handler, hook bool
+
+	eachPhaseError(err, func(pe *PhaseError) {
+		switch pe.Phase {
+		case DrainPhase:
+			drain = drain || errors.Is(pe.Err, context.DeadlineExceeded) || errors.Is(pe.Err, ErrForceClosed)
+		case HandlerPhase:
+			handler = true
+		case DeregisterPhase, PreparePhase, DrainersPhase, LoopsPhase, CleanupPhase:
+			hook = true
+		}
+	})
+
+	switch {
+	case drain:
+		return DrainTimeoutExitCode
+	case handler:
+		return HandlerExitCode
+	case hook:
+		return HookExitCode
+	}
+
+	return FailedExitCode
+}
+
+// eachPhaseError calls fn with every PhaseError in the tree of err
+func eachPhaseError(err error, fn func(pe *PhaseError)) {
+	switch e := err.(type) {
+	case *PhaseError:
+		fn(e)
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			eachPhaseError(err, fn)
+		}
+	case interface{ Unwrap() error }:
+		eachPhaseError(e.Unwrap(), fn)
+	}
+}
+
+// Main runs a service, and is meant to be all there is to main. It calls
+// setup, with a context that is done once the service has shut down, and
+// serves the handler it returns on the address returned by AddrFromEnv until
+// told to shut down. Once the handler, see Shutdowner, and the DefaultRegistry
+// have shut down, it exits the process with 0, or FailedExitCode if serving,
+// or shutting down, failed, the code returned by ExitCode if
+// WithStrictShutdown is used. If setup fails, the error is logged and the
+// process exits with SetupExitCode, without serving.
+//
+// Progress is logged to stdout and errors to stderr,
+// unless the options say otherwise.
+//
+//	func main() {
+//		graceful.Main(func(ctx context.Context) (http.Handler, error) {
+//			db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+//			if err != nil {
+//				return nil, err
+//			}
+//			graceful.OnShutdownDone("db", func(context.Context) error { return db.Close() })
+//
+//			return newServer(db), nil
+//		})
+//	}
+func Main(setup func(ctx context.Context) (http.Handler, error), opts ...Option) {
+	exit(runMain(context.Background(), setup, opts...))
+}
+
+// runMain runs Main until it would exit, returning the exit code
+func runMain(ctx context.Context, setup func(ctx context.Context) (http.Handler, error), opts ...Option) int {
+	hs := &http.Server{}
+
+	i := New(hs, append([]Option{WithLoggers(log.New(os.Stdout, "", 0), log.New(os.Stderr, "", 0))}, opts...)...)
+	i.useEnvAddr(hs)
+
+	setUp := false
+
+	// Done once Run has returned, not as soon as the shutdown begins
+	setupCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i.starters = append(i.starters, func(context.Context) error {
+		var h http.Handler
+
+		if err := safely(func() (err error) { h, err = setup(setupCtx); return err }); err != nil {
+			return phaseError(SetupPhase, "", err)
+		}
+
+		hs.Handler, setUp = h, true
+
+		return nil
+	})
+
+	err := i.Run(ctx)
+
+	switch {
+	case err == nil:
+		return 0
+	case !setUp:
+		i.emit(Event{Kind: ErrorEvent, Phase: SetupPhase, Err: err})
+		return SetupExitCode
+	case i.cfg.strict:
+		return ExitCode(err)
+	default:
+		return FailedExitCode
+	}
+}
@@ -0,0 +1,124 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestRunMain(t *testing.T) {
+	setupErr := errors.New("database unreachable")
+
+	for _, tc := range []struct {
+		name     string
+		port     string
+		setupErr error
+		stopErr  error
+		code     int
+		errs     string
+	}{
+		{"ok", "0", nil, nil, 0, ""},
+		{"setup failed", "0", setupErr, nil, SetupExitCode, "Error: setup: database unreachable\n"},
+		{"invalid port", "http", nil, nil, SetupExitCode, "Error: serve: graceful: invalid PORT \"http\": must be a number between 0 and 65535\n"},
+		{"shutdown failed", "0", nil, errors.New("flush failed"), FailedExitCode, "Error: handler shutdown: flush failed\n"},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PORT", tc.port)
+
+			var (
+				errs     bytes.Buffer
+				setupCtx context.Context
+				stopped  bool
+				live     bool
+			)
+
+			code := runMain(context.Background(), func(ctx context.Context) (http.Handler, error) {
+				setupCtx = ctx
+
+				return shutdownFunc(func(context.Context) error {
+					stopped, live = true, setupCtx.Err() == nil
+					return tc.stopErr
+				}), tc.setupErr
+			}, shutdownOnListening(), WithRegistry(&Registry{}), WithLoggers(log.New(&bytes.Buffer{}, "", 0), log.New(&errs, "", 0)))
+
+			if code != tc.code || errs.String() != tc.errs {
+				t.Fatalf("runMain() = %d, logging %q, want %d, logging %q", code, errs.String(), tc.code, tc.errs)
+			}
+
+			if got, want := stopped, tc.code != SetupExitCode; got != want {
+				t.Fatalf("handler shut down = %t, want %t", got, want)
+			}
+
+			if stopped && !live {
+				t.Fatalf("the setup context was done before the handler shut down")
+			}
+
+			if setupCtx != nil && setupCtx.Err() == nil {
+				t.Fatalf("the setup context is not done once Main has returned")
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"nil", nil, 0},
+		{"serve", phaseError(ServePhase, "", errors.New("address in use")), FailedExitCode},
+		{"drain timeout", phaseError(DrainPhase, "api", context.DeadlineExceeded), DrainTimeoutExitCode},
+		{"force closed", phaseError(DrainPhase, "", ErrForceClosed), DrainTimeoutExitCode},
+		{"handler", phaseError(HandlerPhase, "", errors.New("flush failed")), HandlerExitCode},
+		{"hook", phaseError(CleanupPhase, "db", errors.New("close failed")), HookExitCode},
+		{"handler and hook", joinErrors(
+			phaseError(CleanupPhase, "db", errors.New("close failed")),
+			phaseError(HandlerPhase, "", errors.New("flush failed")),
+		), HandlerExitCode},
+	} {
+		if got := ExitCode(tc.err); got != tc.code {
+			t.Errorf("ExitCode(%v) = %d for %s, want %d", tc.err, got, tc.name, tc.code)
+		}
+	}
+}
+
+func TestWithStrictShutdown(t *testing.T) {
+	t.Setenv("PORT", "0")
+
+	reg := &Registry{}
+	reg.Register("db", shutdownFunc(func(context.Context) error { return errors.New("close failed") }))
+
+	code := runMain(context.Background(), func(ctx context.Context) (http.Handler, error) {
+		return http.NotFoundHandler(), nil
+	}, WithStrictShutdown(), shutdownOnListening(), WithRegistry(reg),
+		WithLoggers(log.New(&bytes.Buffer{}, "", 0), log.New(&bytes.Buffer{}, "", 0)))
+
+	if code != HookExitCode {
+		t.Fatalf("runMain() = %d, want %d", code, HookExitCode)
+	}
+
+	t.Run("listen and serve both", func(t *testing.T) {
+		codes := useFakeExit(t)
+
+		handler := shutdownFunc(func(context.Context) error { return errors.New("flush failed") })
+
+		ListenAndServeBoth("127.0.0.1:0", "127.0.0.1:0", "testdata/server.crt", "testdata/server.key", handler,
+			WithStrictShutdown(), shutdownOnListening(), WithRegistry(&Registry{}),
+			WithLoggers(log.New(&bytes.Buffer{}, "", 0), log.New(&bytes.Buffer{}, "", 0)))
+
+		select {
+		case code := <-codes:
+			if code != HandlerExitCode {
+				t.Fatalf("exited with %d, want %d", code, HandlerExitCode)
+			}
+		default:
+			t.Fatalf("ListenAndServeBoth() did not exit")
+		}
+	})
+}
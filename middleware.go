@@ -0,0 +1,280 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// shutdownChanKey is the context key of the channel returned by ShutdownChan
+var shutdownChanKey = &contextKey{"shutdown chan"}
+
+// ShutdownChan returns a channel that is closed once the Instance begins
+// shutting down, so that long-running work, such as streaming responses,
+// can end early instead of holding up the drain
+func (i *Instance) ShutdownChan() <-chan struct{} {
+	i.drainMu.Lock()
+	defer i.drainMu.Unlock()
+
+	return i.draining
+}
+
+// Context returns a context that is canceled once the Instance begins
+// shutting down, on a signal, Shutdown or the context passed to Run being
+// done, for work started on behalf of the servers. Once Run has returned,
+// a new context is returned for the next run.
+func (i *Instance) Context() context.Context {
+	i.drainMu.Lock()
+	defer i.drainMu.Unlock()
+
+	return i.drainCtx
+}
+
+// shuttingDown reports whether the Instance has begun shutting down
+func (i *Instance) shuttingDown() bool {
+	select {
+	case <-i.ShutdownChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// beginDrain closes the channel returned by ShutdownChan, and cancels the
+// context returned by Context, flipping readiness and starting to reject
+// requests too unless those are scheduled by WithDrainStages
+func (i *Instance) beginDrain() {
+	i.drainMu.Lock()
+	defer i.drainMu.Unlock()
+
+	if !i.drained {
+		i.drained = true
+		close(i.draining)
+		i.cancelDrain()
+
+		if !i.scheduled(FlipReadiness) {
+			closeGate(i.unready)
+		}
+
+		if !i.scheduled(RejectRequests) {
+			closeGate(i.rejecting)
+		}
+	}
+}
+
+// flipReadiness makes HealthHandler answer 503 Service Unavailable
+func (i *Instance) flipReadiness() {
+	i.drainMu.Lock()
+	closeGate(i.unready)
+	i.drainMu.Unlock()
+}
+
+// startRejecting makes Middleware answer with the response set by
+// WithDrainResponse
+func (i *Instance) startRejecting() {
+	i.drainMu.Lock()
+	closeGate(i.rejecting)
+	i.drainMu.Unlock()
+}
+
+// gate returns ch, read under drainMu
+func (i *Instance) gate(ch *chan struct{}) <-chan struct{} {
+	i.drainMu.Lock()
+	defer i.drainMu.Unlock()
+
+	return *ch
+}
+
+// closeGate closes ch unless it is already closed
+func closeGate(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// MiddlewareOption configures the handler returned by Middleware
+type MiddlewareOption func(*middleware)
+
+type middleware struct {
+	status     int
+	retryAfter time.Duration
+	body       func(w http.ResponseWriter, r *http.Request)
+	responder  func(w http.ResponseWriter, r *http.Request, st Stats)
+	excluded   map[string]bool
+}
+
+// WithDrainResponse makes the handler answer requests that start once the
+// shutdown has begun, or the RejectRequests stage set by WithDrainStages has
+// been reached, with status, http.StatusServiceUnavailable if zero, and a
+// Retry-After header of retryAfter, unless zero, instead of calling h.
+// Requests that started before then are not affected.
+func WithDrainResponse(status int, retryAfter time.Duration) MiddlewareOption {
+	return func(m *middleware) {
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+
+		m.status = status
+		m.retryAfter = retryAfter
+	}
+}
+
+// WithDrainBody sets the function that writes the body of the responses
+// set by WithDrainResponse (defaults to writing the status text)
+func WithDrainBody(fn func(w http.ResponseWriter, r *http.Request)) MiddlewareOption {
+	return func(m *middleware) {
+		m.body = fn
+	}
+}
+
+// WithDrainResponder makes the handler answer the requests that start once
+// the shutdown has begun, like WithDrainResponse, by calling fn with the
+// Stats of the shutdown, whose Remaining can be used to compute a Retry-After
+// header, instead of writing the response set by WithDrainResponse. If fn
+// panics, the panic is logged as an error, and a 503 Service Unavailable is
+// written unless fn had already written the header.
+func WithDrainResponder(fn func(w http.ResponseWriter, r *http.Request, st Stats)) MiddlewareOption {
+	return func(m *middleware) {
+		if m.status == 0 {
+			m.status = http.StatusServiceUnavailable
+		}
+
+		m.responder = fn
+	}
+}
+
+// WithExcludedPaths makes the handler call h for requests for paths,
+// such as health checks, also while shutting down
+func WithExcludedPaths(paths ...string) MiddlewareOption {
+	return func(m *middleware) {
+		for _, path := range paths {
+			m.excluded[path] = true
+		}
+	}
+}
+
+// Middleware returns a handler that calls h with the channel returned by
+// ShutdownChan in the request context, see ShutdownChanFromContext, or
+// answers the requests arriving while shutting down if WithDrainResponse
+// is used
+func (i *Instance) Middleware(h http.Handler, opts ...MiddlewareOption) http.Handler {
+	m := &middleware{excluded: map[string]bool{}}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shutdown := i.ShutdownChan()
+
+		if m.status != 0 && !m.excluded[r.URL.Path] && !i.protects(r.URL.Path) {
+			select {
+			case <-i.gate(&i.rejecting):
+				i.rejected.Add(1)
+				i.reject(m, w, r)
+				return
+			default:
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), shutdownChanKey, shutdown)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// reject writes the response set by WithDrainResponse, or calls the
+// responder set by WithDrainResponder, closing the connection so that the
+// client retries on another one
+func (i *Instance) reject(m *middleware, w http.ResponseWriter, r *http.Request) {
+	if m.responder != nil {
+		i.respond(m, w, r)
+		return
+	}
+
+	if m.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((m.retryAfter+time.Second-1)/time.Second)))
+	}
+
+	w.Header().Set("Connection", "close")
+
+	if m.body == nil {
+		http.Error(w, http.StatusText(m.status), m.status)
+		return
+	}
+
+	w.WriteHeader(m.status)
+	m.body(w, r)
+}
+
+// respond calls the responder set by WithDrainResponder, recovering
+// if it panics
+func (i *Instance) respond(m *middleware, w http.ResponseWriter, r *http.Request) {
+	st, _ := i.stats.snapshot()
+	rw := &headerWriter{ResponseWriter: w}
+
+	w.Header().Set("Connection", "close")
+
+	err := safely(func() error {
+		m.responder(rw, r, st)
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	phase := st.Phase
+	if phase == "" {
+		phase = DrainPhase
+	}
+
+	i.emit(Event{Kind: ErrorEvent, Phase: phase, Err: phaseError(phase, "", err)})
+
+	if !rw.wroteHeader {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+}
+
+// headerWriter records whether the header has been written
+type headerWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the ResponseWriter, for http.ResponseController
+func (w *headerWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// ShutdownChanFromContext returns the channel put in the request context by
+// Middleware, or the base context of an *http.Server run by an Instance,
+// which is closed once the Instance begins shutting down.
+// It returns nil, which is never ready to receive from, if there is none.
+//
+//	for {
+//		select {
+//		case ev := <-events:
+//			fmt.Fprintf(w, "data: %s\n\n", ev)
+//			flusher.Flush()
+//		case <-graceful.ShutdownChanFromContext(r.Context()):
+//			fmt.Fprint(w, "event: shutdown\nretry: 2000\ndata:\n\n")
+//			return
+//		}
+//	}
+func ShutdownChanFromContext(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(shutdownChanKey).(<-chan struct{})
+
+	return ch
+}
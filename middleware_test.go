@@ -0,0 +1,281 @@
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	addrs := make(chan string, 1)
+
+	hs := &http.Server{Addr: "127.0.0.1:0"}
+
+	i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+		if e.Kind == ListeningEvent {
+			addrs <- e.Addr
+		}
+	}))
+
+	// An SSE handler that streams until the Instance begins shutting down
+	hs.Handler = i.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for n := 0; ; n++ {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(w, "data: %d\n\n", n)
+				w.(http.Flusher).Flush()
+			case <-ShutdownChanFromContext(r.Context()):
+				fmt.Fprint(w, "event: shutdown\nretry: 2000\ndata:\n\n")
+				return
+			}
+		}
+	}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	resp, err := http.Get("http://" + <-addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), "data: ") {
+		t.Fatalf("first line = %q, want an event", lines.Text())
+	}
+
+	i.Shutdown()
+
+	var last string
+
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "event: ") {
+			last = lines.Text()
+		}
+	}
+
+	if got, want := last, "event: shutdown"; got != want {
+		t.Fatalf("last event = %q, want %q", got, want)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the drain did not finish once the stream ended")
+	}
+
+	if ch := ShutdownChanFromContext(context.Background()); ch != nil {
+		t.Fatalf("ShutdownChanFromContext() = %v, want nil", ch)
+	}
+}
+
+func TestMiddlewareDrainResponse(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+
+	for _, tc := range []struct {
+		name       string
+		opts       []MiddlewareOption
+		path       string
+		status     int
+		retryAfter string
+		body       string
+	}{
+		{"default", []MiddlewareOption{WithDrainResponse(0, 1500*time.Millisecond)}, "/", 503, "2", "Service Unavailable\n"},
+		{"too many requests", []MiddlewareOption{WithDrainResponse(http.StatusTooManyRequests, 0), WithDrainBody(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "shutting down, retry in 2s")
+		})}, "/", 429, "", "shutting down, retry in 2s"},
+		{"excluded", []MiddlewareOption{WithDrainResponse(0, time.Second), WithExcludedPaths("/healthz")}, "/healthz", 200, "", "ok"},
+		{"disabled", nil, "/", 200, "", "ok"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i := newInstance(&http.Server{}, nil)
+			i.beginDrain()
+
+			rec := httptest.NewRecorder()
+
+			i.Middleware(ok, tc.opts...).ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+
+			if rec.Code != tc.status || rec.Header().Get("Retry-After") != tc.retryAfter || rec.Body.String() != tc.body {
+				t.Fatalf("response = %d, Retry-After %q, %q, want %d, %q, %q",
+					rec.Code, rec.Header().Get("Retry-After"), rec.Body.String(), tc.status, tc.retryAfter, tc.body)
+			}
+
+			if got, want := i.rejected.Load() > 0, tc.status != http.StatusOK; got != want {
+				t.Fatalf("rejected = %t after a %d response, want %t", got, tc.status, want)
+			}
+		})
+	}
+
+	t.Run("in flight", func(t *testing.T) {
+		i := newInstance(&http.Server{}, nil)
+
+		h := i.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i.beginDrain()
+			fmt.Fprint(w, "ok")
+		}), WithDrainResponse(0, time.Second))
+
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("rec.Code = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestMiddlewareDrainResponder(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+
+	problem := func(w http.ResponseWriter, r *http.Request, st Stats) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(st.Remaining.Round(time.Second)/time.Second)))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"title":"shutting down","phase":%q}`, st.Phase)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		responder  func(w http.ResponseWriter, r *http.Request, st Stats)
+		status     int
+		retryAfter string
+		body       string
+		panicked   bool
+	}{
+		{"problem", problem, 503, "10", `{"title":"shutting down","phase":"drain"}`, false},
+		{"panics", func(w http.ResponseWriter, r *http.Request, st Stats) {
+			panic("no problem document")
+		}, 503, "", "Service Unavailable\n", true},
+		{"panics once written", func(w http.ResponseWriter, r *http.Request, st Stats) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			panic("half written")
+		}, 429, "", "", true},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			clk := newFakeClock()
+
+			var panicked bool
+
+			i := newInstance(&http.Server{}, nil, WithEventHandler(func(e Event) {
+				var pe *PanicError
+				panicked = panicked || e.Kind == ErrorEvent && errors.As(e.Err, &pe)
+			}), WithClock(clk))
+
+			ctx, cancel := withTimeout(context.Background(), clk, 10*time.Second)
+			defer cancel()
+
+			i.stats.begin(ctx, "")
+			i.enterPhase(DrainPhase)
+
+			h := i.Middleware(ok, WithDrainResponder(tc.responder))
+
+			// Requests are passed on until the shutdown begins
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("rec.Code = %d before the shutdown, want %d", rec.Code, http.StatusOK)
+			}
+
+			i.beginDrain()
+
+			rec = httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+			if rec.Code != tc.status || rec.Header().Get("Retry-After") != tc.retryAfter || rec.Body.String() != tc.body {
+				t.Fatalf("response = %d, Retry-After %q, %q, want %d, %q, %q",
+					rec.Code, rec.Header().Get("Retry-After"), rec.Body.String(), tc.status, tc.retryAfter, tc.body)
+			}
+
+			if panicked != tc.panicked {
+				t.Fatalf("panic logged = %t, want %t", panicked, tc.panicked)
+			}
+		})
+	}
+}
+
+func TestInstanceContext(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		shutdown func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc)
+	}{
+		{"signal", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { signals <- os.Interrupt }},
+		{"shutdown", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { i.Shutdown() }},
+		{"run context", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { cancel() }},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			listening := make(chan struct{}, 1)
+			signals := make(chan os.Signal, 1)
+			reg := &Registry{}
+
+			i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithRegistry(reg), WithNetwork("tcp4"),
+				WithEventHandler(func(e Event) {
+					if e.Kind == ListeningEvent {
+						listening <- struct{}{}
+					}
+				}))
+
+			run := i.Context()
+
+			// The context is canceled before the registry is shut down
+			var canceled error
+
+			reg.Register("check", shutdownFunc(func(ctx context.Context) error {
+				canceled = run.Err()
+				return nil
+			}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errs := make(chan error, 1)
+			go func() { errs <- i.Run(ctx) }()
+
+			<-listening
+
+			if run.Err() != nil {
+				t.Fatalf("i.Context().Err() = %v while serving, want nil", run.Err())
+			}
+
+			tc.shutdown(i, signals, cancel)
+
+			if err := <-errs; err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			if canceled != context.Canceled {
+				t.Fatalf("i.Context().Err() = %v while shutting down, want %v", canceled, context.Canceled)
+			}
+
+			if next := i.Context(); next == run || next.Err() != nil {
+				t.Fatalf("i.Context() = %v once Run has returned, want a new context", next)
+			}
+		})
+	}
+}
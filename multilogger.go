@@ -0,0 +1,50 @@
+package graceful
+
+import "fmt"
+
+// MultiLogger returns a Logger that logs every message to each of the
+// loggers, in order, one at a time. A logger that panics is skipped,
+// and the message still logged to the rest, but a logger that blocks
+// holds up the others, and the shutdown, so wrap slow loggers in a
+// buffer of their own. Fatal logs the message to each logger but the
+// last using Printf, and then calls Fatal on the last one.
+func MultiLogger(loggers ...Logger) Logger {
+	var ls multiLogger
+
+	for _, l := range loggers {
+		if l != nil {
+			ls = append(ls, l)
+		}
+	}
+
+	return ls
+}
+
+type multiLogger []Logger
+
+func (ml multiLogger) Printf(format string, v ...interface{}) {
+	for _, l := range ml {
+		printf(l, format, v...)
+	}
+}
+
+func (ml multiLogger) Fatal(v ...interface{}) {
+	if len(ml) == 0 {
+		return
+	}
+
+	msg := fmt.Sprint(v...)
+
+	for _, l := range ml[:len(ml)-1] {
+		printf(l, "%s\n", msg)
+	}
+
+	ml[len(ml)-1].Fatal(v...)
+}
+
+// printf calls l.Printf, recovering from any panic
+func printf(l Logger, format string, v ...interface{}) {
+	defer func() { recover() }()
+
+	l.Printf(format, v...)
+}
@@ -0,0 +1,76 @@
+package graceful
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMultiLogger(t *testing.T) {
+	var order []string
+
+	first := &recordingLogger{name: "first", order: &order}
+	last := &recordingLogger{name: "last", order: &order}
+
+	ml := MultiLogger(first, nil, panickingLogger{}, last)
+
+	ml.Printf("Listening on %s\n", "127.0.0.1:2017")
+	ml.Fatal("failed")
+
+	if got, want := strings.Join(order, ","), "first,last,first,last"; got != want {
+		t.Fatalf("loggers called in the order %s, want %s", got, want)
+	}
+
+	if got, want := first.lines, []string{"Listening on 127.0.0.1:2017\n", "failed\n"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("first logger got %q, want %q", got, want)
+	}
+
+	if got, want := last.lines, []string{"Listening on 127.0.0.1:2017\n"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("last logger got %q, want %q", got, want)
+	}
+
+	if got, want := last.fatal, "failed"; got != want {
+		t.Fatalf("last.Fatal called with %q, want %q", got, want)
+	}
+
+	// Must not panic
+	MultiLogger().Fatal("failed")
+}
+
+func TestLogListenAndServeLoggers(t *testing.T) {
+	defer func(l Logger) { logger = l }(logger)
+
+	var stdout, ring bytes.Buffer
+
+	logListenAndServe(&http.Server{Addr: "127.0.0.1:0"}, []Logger{log.New(&stdout, "", 0), log.New(&ring, "", 0)}, shutdownOnListening())
+
+	if stdout.String() == "" || stdout.String() != ring.String() {
+		t.Fatalf("logged %q and %q, want the same messages to both loggers", stdout.String(), ring.String())
+	}
+}
+
+type recordingLogger struct {
+	name  string
+	order *[]string
+	lines []string
+	fatal string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	*l.order = append(*l.order, l.name)
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Fatal(v ...interface{}) {
+	*l.order = append(*l.order, l.name)
+	l.fatal = fmt.Sprint(v...)
+}
+
+type panickingLogger struct{}
+
+func (panickingLogger) Printf(format string, v ...interface{}) { panic("broken sink") }
+
+func (panickingLogger) Fatal(v ...interface{}) { panic("broken sink") }
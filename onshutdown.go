@@ -0,0 +1,97 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+var (
+	onShutdownMu sync.Mutex
+	onShutdown   = map[*http.Server]*callbacks{}
+)
+
+// RegisterOnShutdown registers fn using hs.RegisterOnShutdown, and makes the
+// Instance running hs wait for fn to return, until the deadline of the drain,
+// once hs.Shutdown has returned, which does not wait for it
+func RegisterOnShutdown(hs *http.Server, fn func()) {
+	onShutdownMu.Lock()
+	cb := onShutdown[hs]
+	if cb == nil {
+		cb = &callbacks{done: make(chan struct{})}
+		onShutdown[hs] = cb
+	}
+	onShutdownMu.Unlock()
+
+	cb.add(1)
+
+	hs.RegisterOnShutdown(func() {
+		defer cb.add(-1)
+
+		// A panic would crash the process, as fn runs in its own goroutine
+		safely(func() error { fn(); return nil })
+	})
+}
+
+// callbacks counts the callbacks registered by RegisterOnShutdown
+// that have not returned
+type callbacks struct {
+	mu      sync.Mutex
+	pending int
+
+	// done is closed, and replaced, whenever pending drops to zero
+	done chan struct{}
+}
+
+func (cb *callbacks) add(n int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.pending += n
+
+	if cb.pending == 0 {
+		close(cb.done)
+		cb.done = make(chan struct{})
+	}
+}
+
+// wait waits for the callbacks to return, or ctx to be done,
+// returning how many of them had not returned
+func (cb *callbacks) wait(ctx context.Context) int {
+	cb.mu.Lock()
+	pending, done := cb.pending, cb.done
+	cb.mu.Unlock()
+
+	if pending == 0 {
+		return 0
+	}
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.pending
+}
+
+// waitOnShutdown waits for the callbacks registered for hs by
+// RegisterOnShutdown to return, or ctx to be done, counting those
+// that had not returned
+func (i *Instance) waitOnShutdown(ctx context.Context, m *member, hs *http.Server) {
+	onShutdownMu.Lock()
+	cb := onShutdown[hs]
+	onShutdownMu.Unlock()
+
+	if cb == nil {
+		return
+	}
+
+	if n := cb.wait(ctx); n > 0 {
+		i.onShutdownRunning.Add(int64(n))
+		i.emit(Event{Kind: OnShutdownEvent, Phase: DrainPhase, Server: m.name, Count: n})
+	}
+}
@@ -0,0 +1,93 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegisterOnShutdown(t *testing.T) {
+	hs := &http.Server{Addr: "127.0.0.1:0"}
+
+	var notified atomic.Bool
+
+	RegisterOnShutdown(hs, func() {
+		time.Sleep(50 * time.Millisecond)
+		notified.Store(true)
+	})
+
+	i := New(hs, WithRegistry(&Registry{}), shutdownOnListening())
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if !notified.Load() {
+		t.Fatalf("i.Run() returned before the RegisterOnShutdown callback")
+	}
+
+	if got := i.Report().OnShutdownRunning; got != 0 {
+		t.Fatalf("i.Report().OnShutdownRunning = %d, want 0", got)
+	}
+}
+
+func TestRegisterOnShutdownDeadline(t *testing.T) {
+	clk := newFakeClock()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	hs := &http.Server{Addr: "127.0.0.1:0"}
+
+	for n := 0; n < 2; n++ {
+		RegisterOnShutdown(hs, func() { <-release })
+	}
+
+	RegisterOnShutdown(hs, func() {})
+
+	var events []Event
+
+	listening := make(chan struct{})
+
+	i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithEventHandler(func(e Event) {
+		events = append(events, e)
+
+		if e.Kind == ListeningEvent {
+			close(listening)
+		}
+	}), WithClock(clk))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	<-listening
+
+	i.Shutdown()
+
+	clk.WaitForTimers(1)
+	clk.Advance(Timeout)
+
+	// The callbacks are abandoned, without failing the drain
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := i.Report().OnShutdownRunning, 2; got != want {
+		t.Fatalf("i.Report().OnShutdownRunning = %d, want %d", got, want)
+	}
+
+	for _, e := range events {
+		if e.Kind == OnShutdownEvent {
+			if got, want := e.String(), "Abandoned 2 RegisterOnShutdown callbacks that did not return before deadline"; got != want {
+				t.Fatalf("e.String() = %q, want %q", got, want)
+			}
+
+			return
+		}
+	}
+
+	t.Fatalf("no %q event was emitted", OnShutdownEvent)
+}
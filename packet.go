@@ -0,0 +1,140 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// WithPacketConn makes the Instance listen for packets on addr, such as
+// for HTTP/3 or a UDP responder, alongside its servers, and serve them using
+// serve, called in a goroutine. Once the servers have drained, stop, unless
+// nil, is called with the deadline of the shutdown, after which the
+// net.PacketConn is closed. An error returned by serve before then is
+// handled like one from a server failing, see WithPartialFailure.
+func WithPacketConn(network, addr string, serve func(net.PacketConn) error, stop func(ctx context.Context) error) Option {
+	return func(c *config) {
+		c.packetConns = append(c.packetConns, &packetServer{network: network, addr: addr, serve: serve, stop: stop})
+	}
+}
+
+// packetServer is a net.PacketConn served by the function set by
+// WithPacketConn, shut down by its stop function
+type packetServer struct {
+	network string
+	addr    string
+	serve   func(net.PacketConn) error
+	stop    func(ctx context.Context) error
+
+	mu     sync.Mutex
+	pc     net.PacketConn
+	closed bool
+}
+
+// name returns the name of the member serving p
+func (p *packetServer) name() string {
+	return p.network + " " + p.addr
+}
+
+// Shutdown calls the stop function, then closes the net.PacketConn
+func (p *packetServer) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	pc := p.pc
+	p.closed = true
+	p.mu.Unlock()
+
+	if pc == nil {
+		return nil
+	}
+
+	var err error
+
+	if p.stop != nil {
+		err = p.stop(ctx)
+	}
+
+	if cerr := pc.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// packetMembers returns the members serving the net.PacketConns
+// set by WithPacketConn
+func (i *Instance) packetMembers() []*member {
+	var ms []*member
+
+	for _, p := range i.cfg.packetConns {
+		p := p
+
+		ms = append(ms, &member{name: p.name(), server: p, packet: true, serve: func(ctx context.Context) error {
+			return i.servePacket(ctx, p)
+		}})
+	}
+
+	return ms
+}
+
+// servePacket listens on the address of p, using the ListenConfig set by
+// WithListenConfig, and serves the net.PacketConn until it is shut down
+func (i *Instance) servePacket(ctx context.Context, p *packetServer) error {
+	lc := i.cfg.listenConfig
+	if lc == nil {
+		lc = &net.ListenConfig{}
+	}
+
+	pc, err := lc.ListenPacket(ctx, p.network, p.addr)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+
+	// The shutdown began while binding
+	if ctx.Err() != nil {
+		p.mu.Unlock()
+		pc.Close()
+
+		return http.ErrServerClosed
+	}
+
+	p.pc, p.closed = pc, false
+	p.mu.Unlock()
+
+	i.emit(Event{Kind: ListeningPacketEvent, Phase: ServePhase, Server: p.name(),
+		Addr: pc.LocalAddr().String(), Network: p.network})
+
+	err = p.serve(pc)
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+
+	switch {
+	case closed:
+		return http.ErrServerClosed
+	case err == nil:
+		err = fmt.Errorf("graceful: serving %s returned before the shutdown", p.name())
+	}
+
+	pc.Close()
+
+	return err
+}
+
+// splitPackets returns the members of ms serving net.PacketConns apart
+// from the others
+func splitPackets(ms []*member) (servers, packets []*member) {
+	for _, m := range ms {
+		if m.packet {
+			packets = append(packets, m)
+		} else {
+			servers = append(servers, m)
+		}
+	}
+
+	return servers, packets
+}
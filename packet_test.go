@@ -0,0 +1,122 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestWithPacketConn(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+
+	note := func(s string) {
+		mu.Lock()
+		order = append(order, s)
+		mu.Unlock()
+	}
+
+	// An echo responder
+	serve := func(pc net.PacketConn) error {
+		buf := make([]byte, 512)
+
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return err
+			}
+
+			pc.WriteTo(buf[:n], addr)
+		}
+	}
+
+	var deadline bool
+
+	stop := func(ctx context.Context) error {
+		_, deadline = ctx.Deadline()
+		note("stop")
+
+		return nil
+	}
+
+	listening := make(chan string, 1)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithPacketConn("udp4", "127.0.0.1:0", serve, stop), WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ListeningPacketEvent:
+				if got, want := e.String(), "Listening on udp4://"+e.Addr; got != want {
+					t.Errorf("e.String() = %q, want %q", got, want)
+				}
+
+				listening <- e.Addr
+			case FinishedHTTPEvent:
+				note("drained")
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	c, err := net.Dial("udp4", <-listening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 512)
+
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "ping" {
+		t.Fatalf("echoed %q, want %q", buf[:n], "ping")
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if len(order) != 2 || order[0] != "drained" || order[1] != "stop" {
+		t.Fatalf("order = %q, want the packet conn stopped once the server has drained", order)
+	}
+
+	if !deadline {
+		t.Fatalf("stop was called without the deadline of the shutdown")
+	}
+}
+
+func TestWithPacketConnError(t *testing.T) {
+	errDiscovery := errors.New("discovery failed")
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithPacketConn("udp4", "127.0.0.1:0", func(pc net.PacketConn) error {
+			return errDiscovery
+		}, nil))
+
+	err := i.Run(context.Background())
+
+	var pe *PhaseError
+
+	if !errors.As(err, &pe) || pe.Phase != ServePhase || !errors.Is(err, errDiscovery) {
+		t.Fatalf("i.Run() = %v, want a serve PhaseError wrapping %v", err, errDiscovery)
+	}
+
+	if got, want := pe.Name, "udp4 127.0.0.1:0"; got != want {
+		t.Fatalf("pe.Name = %q, want %q", got, want)
+	}
+}
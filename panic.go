@@ -0,0 +1,38 @@
+package graceful
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error a hook, Shutdowner or event handler that panicked
+// is taken to have returned, so that the rest of the shutdown still runs
+type PanicError struct {
+	// Value is the value passed to panic
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the value passed to panic, if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+
+	return err
+}
+
+// safely calls fn, returning a *PanicError if it panics
+func safely(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,94 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPanickingHooks(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := &Registry{}
+
+	r.Register("cache", shutdownFunc(func(ctx context.Context) error {
+		panic("cache gone")
+	}))
+
+	closed := false
+
+	r.Register("db", shutdownFunc(func(ctx context.Context) error {
+		closed = true
+		return nil
+	}))
+
+	handler := shutdownFunc(func(ctx context.Context) error {
+		panic(io.ErrClosedPipe)
+	})
+
+	handled := 0
+
+	i := newInstance(&http.Server{Handler: handler}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r),
+		WithEventHandler(func(e Event) {
+			if e.Kind == ShutdownEvent {
+				panic("handler broken")
+			}
+		}),
+		WithEventHandler(func(e Event) {
+			handled++
+		}))
+
+	err := i.shutdown()
+
+	if !closed {
+		t.Fatalf("db was not shut down after cache panicked")
+	}
+
+	var pe *PanicError
+	if !errors.As(err, &pe) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("i.shutdown() = %v, want the panics as errors", err)
+	}
+
+	if !bytes.Contains(pe.Stack, []byte("panic_test.go")) {
+		t.Fatalf("pe.Stack = %s, want the stack of the panic", pe.Stack)
+	}
+
+	if rep := i.Report(); rep == nil || rep.Cleanup[0].Err == nil || !strings.Contains(rep.Cleanup[0].Err.Error(), "panic: cache gone") {
+		t.Fatalf("i.Report() = %+v, want the panic of cache reported", rep)
+	}
+
+	for _, want := range []string{"Error: event handler: panic: handler broken", "Error: cleanup (cache): panic: cache gone"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("log = %q, want %q", buf.String(), want)
+		}
+	}
+
+	// Every event still reaches the handlers after the panicking one
+	if handled == 0 {
+		t.Fatalf("the event handler after the panicking one was not called")
+	}
+}
+
+func TestPanickingDrainer(t *testing.T) {
+	r := &Registry{}
+
+	r.RegisterDrainer("jobs", panickingDrainer{})
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r))
+
+	var pe *PanicError
+	if err := i.shutdown(); !errors.As(err, &pe) {
+		t.Fatalf("i.shutdown() = %v, want a *PanicError", err)
+	}
+}
+
+type panickingDrainer struct{}
+
+func (panickingDrainer) StopIntake() { panic("intake stuck") }
+
+func (panickingDrainer) Drain(ctx context.Context) (int, error) { return 0, nil }
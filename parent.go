@@ -0,0 +1,100 @@
+package graceful
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// ParentPollInterval is how often WithParentDeath checks the parent process
+// ID, unless given an interval
+var ParentPollInterval = time.Second
+
+// getppid returns the parent process ID, replaced in tests
+var getppid = os.Getppid
+
+// parentDeath is set by WithParentDeath
+type parentDeath struct {
+	sig      os.Signal
+	interval time.Duration
+}
+
+// WithParentDeath makes the Instance shut down, with a ParentDeathReason,
+// once the process that started it has exited, so that a worker does not
+// keep serving once its controller is gone. On Linux, the kernel sends sig,
+// such as syscall.SIGUSR2, to the process once its parent exits, see
+// PR_SET_PDEATHSIG, which should not be one of the shutdown signals.
+// Elsewhere, or if sig is nil, the parent process ID is checked every
+// interval, ParentPollInterval if zero, for the change that comes with being
+// adopted. On Windows, where the ID does not change, the exit is not noticed.
+func WithParentDeath(sig os.Signal, interval time.Duration) Option {
+	return func(c *config) {
+		c.parentDeath = &parentDeath{sig: sig, interval: interval}
+	}
+}
+
+// watchParent shuts down once the parent process has exited, until ctx is
+// done, which Run waits for
+func (i *Instance) watchParent(ctx context.Context, pd *parentDeath) {
+	ppid := getppid()
+
+	var (
+		died <-chan os.Signal
+		stop = func() {}
+	)
+
+	if pd.sig != nil && setParentDeathSignal(pd.sig) {
+		died, stop = i.signalSource().Notify(pd.sig)
+	}
+
+	interval := pd.interval
+	if interval <= 0 {
+		interval = ParentPollInterval
+	}
+
+	i.goBackground(ctx, func(ctx context.Context) {
+		defer stop()
+
+		// The parent may have exited before the kernel was asked
+		if died != nil && getppid() != ppid {
+			i.triggerShutdown(Reason{Kind: ParentDeathReason})
+			return
+		}
+
+		for {
+			var poll Timer
+
+			if died == nil {
+				poll = i.clock().NewTimer(interval)
+			}
+
+			select {
+			case <-died:
+			case <-timerC(poll):
+				if getppid() == ppid {
+					continue
+				}
+			case <-ctx.Done():
+				if poll != nil {
+					poll.Stop()
+				}
+
+				return
+			}
+
+			i.triggerShutdown(Reason{Kind: ParentDeathReason})
+
+			return
+		}
+	})
+}
+
+// timerC returns the channel of t, or nil, which is never ready,
+// if t is nil
+func timerC(t Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+
+	return t.C()
+}
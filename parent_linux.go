@@ -0,0 +1,19 @@
+package graceful
+
+import (
+	"os"
+	"syscall"
+)
+
+// setParentDeathSignal asks the kernel to send sig to the process once its
+// parent exits, returning false if it could not, replaced in tests
+var setParentDeathSignal = func(sig os.Signal) bool {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return false
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(s), 0)
+
+	return errno == 0
+}
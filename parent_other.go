@@ -0,0 +1,11 @@
+//go:build !linux
+
+package graceful
+
+import "os"
+
+// setParentDeathSignal returns false, as only Linux can send a signal once
+// the parent exits, replaced in tests
+var setParentDeathSignal = func(sig os.Signal) bool {
+	return false
+}
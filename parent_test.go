@@ -0,0 +1,89 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/TV4/graceful/internal/signaltest"
+)
+
+func TestWithParentDeath(t *testing.T) {
+	var ppid atomic.Int64
+
+	ppid.Store(4711)
+
+	defer func(fn func() int) { getppid = fn }(getppid)
+	getppid = func() int { return int(ppid.Load()) }
+
+	t.Run("polling", func(t *testing.T) {
+		clk := newFakeClock()
+
+		defer func(fn func(os.Signal) bool) { setParentDeathSignal = fn }(setParentDeathSignal)
+		setParentDeathSignal = func(sig os.Signal) bool { return false }
+
+		ppid.Store(4711)
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+			WithParentDeath(syscall.SIGHUP, 5*time.Second), WithClock(clk))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		// The parent is still there, so the next check is waited for
+		clk.WaitForTimers(1)
+		clk.Advance(5 * time.Second)
+		clk.WaitForTimers(1)
+
+		ppid.Store(1)
+		clk.Advance(5 * time.Second)
+
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the Instance did not shut down once the parent had exited")
+		}
+
+		if got, want := i.Report().Reason.Kind, ParentDeathReason; got != want {
+			t.Fatalf("i.Report().Reason.Kind = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		var asked os.Signal
+
+		defer func(fn func(os.Signal) bool) { setParentDeathSignal = fn }(setParentDeathSignal)
+		setParentDeathSignal = func(sig os.Signal) bool { asked = sig; return true }
+
+		ppid.Store(4711)
+
+		sigs := signaltest.New()
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignalSource(sigs), WithRegistry(&Registry{}),
+			WithParentDeath(syscall.SIGHUP, 0))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		sigs.Send(syscall.SIGHUP)
+
+		if err := <-errs; err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		if asked != syscall.SIGHUP {
+			t.Fatalf("asked for %v once the parent exits, want %v", asked, syscall.SIGHUP)
+		}
+
+		if got, want := i.Report().Reason.String(), "parent process exit"; got != want {
+			t.Fatalf("i.Report().Reason = %q, want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package graceful
+
+import (
+	"net"
+	"sync"
+)
+
+// PauseMode is what is done with the connections arriving while the
+// Instance is paused, see Pause
+type PauseMode int
+
+const (
+	// PauseQueue leaves the connections waiting, in the backlog of the
+	// listener, until Resume is called
+	PauseQueue PauseMode = iota
+
+	// PauseRefuse closes the connections as soon as they are accepted
+	PauseRefuse
+)
+
+// WithPauseMode makes the Instance create the listeners of its *http.Server
+// servers, so that accepting connections can be paused, see Pause, and sets
+// what is done with the connections arriving while paused (defaults to
+// PauseQueue)
+func WithPauseMode(mode PauseMode) Option {
+	return func(c *config) {
+		c.pauseMode = &mode
+	}
+}
+
+// Pause stops accepting connections on the listeners created by the
+// Instance, see WithPauseMode, until Resume is called, while the connections
+// already accepted keep being served, such as for a brief migration. Shutting
+// down while paused closes the listeners as usual.
+func (i *Instance) Pause() {
+	i.pauseMu.Lock()
+
+	if i.resumed != nil {
+		i.pauseMu.Unlock()
+		return
+	}
+
+	i.resumed, i.pausedAt = make(chan struct{}), i.clock().Now()
+	i.refused.Store(0)
+	i.pauseMu.Unlock()
+
+	i.emit(Event{Kind: PausedEvent, Phase: ServePhase})
+}
+
+// Resume accepts connections again once paused by Pause
+func (i *Instance) Resume() {
+	i.pauseMu.Lock()
+
+	if i.resumed == nil {
+		i.pauseMu.Unlock()
+		return
+	}
+
+	close(i.resumed)
+	i.resumed = nil
+	paused := i.clock().Now().Sub(i.pausedAt)
+	i.pauseMu.Unlock()
+
+	i.emit(Event{Kind: ResumedEvent, Phase: ServePhase, Duration: paused, Count: int(i.refused.Load())})
+}
+
+// Paused reports whether accepting connections has been paused by Pause
+func (i *Instance) Paused() bool {
+	return i.pauseGate() != nil
+}
+
+// pauseGate returns a channel that is closed once resumed,
+// or nil if not paused
+func (i *Instance) pauseGate() chan struct{} {
+	i.pauseMu.Lock()
+	defer i.pauseMu.Unlock()
+
+	return i.resumed
+}
+
+// pausable wraps ln so that accepting on it can be paused
+func (i *Instance) pausable(ln net.Listener) net.Listener {
+	return &pausableListener{Listener: ln, i: i, closed: make(chan struct{})}
+}
+
+// pausableListener holds, or closes, the connections it accepts while the
+// Instance is paused, see PauseMode
+type pausableListener struct {
+	net.Listener
+
+	i      *Instance
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *pausableListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		resumed := l.i.pauseGate()
+		if resumed == nil {
+			return c, nil
+		}
+
+		if mode := l.i.cfg.pauseMode; mode != nil && *mode == PauseRefuse {
+			c.Close()
+			l.i.refused.Add(1)
+			continue
+		}
+
+		// The others wait in the backlog meanwhile
+		select {
+		case <-resumed:
+			return c, nil
+		case <-l.closed:
+			c.Close()
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+func (l *pausableListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+
+	return l.Listener.Close()
+}
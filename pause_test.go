@@ -0,0 +1,140 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	// serve runs an Instance until the test ends, returning its URL
+	serve := func(t *testing.T, mode PauseMode, events chan<- Event) (*Instance, string) {
+		addrs := make(chan string, 1)
+
+		hs := &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "ok")
+		})}
+
+		i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithPauseMode(mode),
+			WithEventHandler(func(e Event) {
+				switch e.Kind {
+				case ListeningEvent:
+					addrs <- e.Addr
+				case PausedEvent, ResumedEvent:
+					events <- e
+				}
+			}))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		t.Cleanup(func() {
+			i.Shutdown()
+
+			select {
+			case err := <-errs:
+				if err != nil {
+					t.Errorf("i.Run() = %v, want nil", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("i.Run() did not return once shut down while paused")
+			}
+		})
+
+		return i, "http://" + <-addrs
+	}
+
+	get := func(client *http.Client, url string) error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		_, err = io.ReadAll(resp.Body)
+
+		return err
+	}
+
+	t.Run("queue", func(t *testing.T) {
+		events := make(chan Event, 2)
+		i, url := serve(t, PauseQueue, events)
+
+		kept := &http.Client{}
+		if err := get(kept, url); err != nil {
+			t.Fatal(err)
+		}
+
+		i.Pause()
+
+		if !i.Paused() {
+			t.Fatalf("i.Paused() = false, want true")
+		}
+
+		// The connection that is already open keeps being served
+		if err := get(kept, url); err != nil {
+			t.Fatalf("get() = %v on an open connection while paused, want nil", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- get(&http.Client{Transport: &http.Transport{}}, url) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("get() = %v on a new connection while paused, want it to wait", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		i.Resume()
+
+		if err := <-done; err != nil {
+			t.Fatalf("get() = %v once resumed, want nil", err)
+		}
+
+		if e := <-events; e.String() != "Paused accepting connections" {
+			t.Fatalf("e.String() = %q, want the pause", e.String())
+		}
+
+		if e := <-events; e.Kind != ResumedEvent || e.Duration < 100*time.Millisecond {
+			t.Fatalf("e = %+v, want the resume after at least 100ms", e)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		events := make(chan Event, 2)
+		i, url := serve(t, PauseRefuse, events)
+
+		i.Pause()
+
+		if err := get(&http.Client{Transport: &http.Transport{}}, url); err == nil {
+			t.Fatalf("get() = nil while paused, want an error")
+		}
+
+		i.Resume()
+
+		if err := get(&http.Client{Transport: &http.Transport{}}, url); err != nil {
+			t.Fatalf("get() = %v once resumed, want nil", err)
+		}
+
+		<-events
+
+		if e := <-events; e.Count != 1 {
+			t.Fatalf("e.Count = %d, want 1 refused connection", e.Count)
+		}
+	})
+
+	t.Run("shutdown while paused", func(t *testing.T) {
+		i, url := serve(t, PauseQueue, make(chan Event, 2))
+
+		i.Pause()
+
+		// A connection waiting to be accepted when the shutdown begins
+		go get(&http.Client{Transport: &http.Transport{}}, url)
+
+		time.Sleep(50 * time.Millisecond)
+	})
+}
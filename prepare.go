@@ -0,0 +1,46 @@
+package graceful
+
+import "context"
+
+// PreparedShutdowner is implemented by Shutdowners that need to prepare,
+// such as by no longer taking on new work, before the servers drain.
+// PrepareShutdown is called before the servers stop accepting connections,
+// and Shutdown once they have drained.
+type PreparedShutdowner interface {
+	Shutdowner
+	PrepareShutdown(ctx context.Context) error
+}
+
+// prepare calls PrepareShutdown on the handlers of ms, and the Shutdowners
+// in reg, that are PreparedShutdowners, one at a time and in the
+// order they are shut down, returning how many were called and their
+// errors joined
+func (i *Instance) prepare(ctx context.Context, ms []*member, reg *Registry) (int, error) {
+	var prepared []*member
+
+	for _, m := range i.handlers(ms, false) {
+		if _, ok := m.server.(PreparedShutdowner); ok {
+			prepared = append(prepared, m)
+		}
+	}
+
+	for _, c := range reg.snapshot() {
+		if _, ok := c.s.(PreparedShutdowner); ok {
+			prepared = append(prepared, &member{name: c.name, server: c.s})
+		}
+	}
+
+	var errs []error
+
+	for _, m := range prepared {
+		ps := m.server.(PreparedShutdowner)
+
+		if err := i.call(ctx, PreparePhase, shutdownerFunc(ps.PrepareShutdown)); err != nil {
+			err = phaseError(PreparePhase, m.name, err)
+			i.emit(Event{Kind: ErrorEvent, Phase: PreparePhase, Name: m.name, Err: err})
+			errs = append(errs, err)
+		}
+	}
+
+	return len(prepared), joinErrors(errs...)
+}
@@ -0,0 +1,98 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type preparedShutdowner struct {
+	name    string
+	mu      *sync.Mutex
+	calls   *[]string
+	prepare func(ctx context.Context) error
+}
+
+func (ps preparedShutdowner) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (ps preparedShutdowner) PrepareShutdown(ctx context.Context) error {
+	ps.mu.Lock()
+	*ps.calls = append(*ps.calls, "prepare "+ps.name)
+	ps.mu.Unlock()
+
+	return ps.prepare(ctx)
+}
+
+func (ps preparedShutdowner) Shutdown(ctx context.Context) error {
+	ps.mu.Lock()
+	*ps.calls = append(*ps.calls, "shutdown "+ps.name)
+	ps.mu.Unlock()
+
+	return nil
+}
+
+func TestPreparedShutdowner(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+		addr  string
+	)
+
+	// The servers are still accepting connections while preparing
+	accepting := func(ctx context.Context) error {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		return c.Close()
+	}
+
+	r := &Registry{}
+	r.Register("queue", preparedShutdowner{"queue", &mu, &calls, accepting})
+	r.Register("db", shutdownerFunc(func(ctx context.Context) error { return nil }))
+
+	failed := errors.New("flag not flipped")
+
+	handler := preparedShutdowner{"handler", &mu, &calls, func(ctx context.Context) error {
+		return failed
+	}}
+
+	listening := make(chan string, 1)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: handler}, WithSignals(make(chan os.Signal)), WithRegistry(r),
+		WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				listening <- e.Addr
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr = <-listening
+
+	i.Shutdown()
+
+	err := <-errs
+
+	var pe *PhaseError
+	if !errors.Is(err, failed) || !errors.As(err, &pe) || pe.Phase != PreparePhase || strings.Contains(err.Error(), "queue") {
+		t.Fatalf("i.Run() = %v, want only the %q error of the handler", err, PreparePhase)
+	}
+
+	// Shut down also if preparing failed
+	if got, want := fmt.Sprint(calls), "[prepare handler prepare queue shutdown handler shutdown queue]"; got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+
+	if i.Report().Prepare.Err == nil {
+		t.Fatalf("i.Report().Prepare.Err = nil, want the error")
+	}
+}
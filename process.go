@@ -0,0 +1,173 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ProcessTimeout is the time a child process registered by RegisterProcess
+// is given to exit once asked to, before it is killed
+var ProcessTimeout = 5 * time.Second
+
+// processPollInterval is how often a child process asked to exit
+// is checked for having exited
+const processPollInterval = 10 * time.Millisecond
+
+// processes are the child processes registered with a Registry,
+// stopped concurrently as one of its Shutdowners
+type processes struct {
+	mu    sync.Mutex
+	procs []*process
+}
+
+type process struct {
+	name string
+	p    *os.Process
+}
+
+// RegisterProcess adds cmd to the DefaultRegistry, see Registry.RegisterProcess
+func RegisterProcess(cmd *exec.Cmd) error {
+	return DefaultRegistry.RegisterProcess(cmd)
+}
+
+// RegisterProcess adds the child process started by cmd to the registry, to
+// be stopped during the cleanup, concurrently with the other child processes,
+// in the place of the first one registered. It is sent SIGTERM, and killed if
+// it has not exited within ProcessTimeout, or is killed right away where there
+// is no SIGTERM, such as on Windows. A child process that has already exited
+// is skipped. Except on Linux, it is only known to have exited once waited for,
+// so cmd.Wait has to be called, as from a goroutine, for it not to be killed
+// once ProcessTimeout has passed.
+//
+// It returns ErrProcessNotStarted if cmd has not been started, and
+// ErrRegistryClosed once an Instance has begun shutting down the registry.
+func (r *Registry) RegisterProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrProcessNotStarted
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRegistryClosed
+	}
+
+	if r.processes == nil {
+		r.processes = &processes{}
+		r.components = append(r.components, &component{name: "processes", s: r.processes, weight: 1})
+	}
+
+	r.processes.add(&process{
+		name: fmt.Sprintf("%s (pid %d)", filepath.Base(cmd.Path), cmd.Process.Pid),
+		p:    cmd.Process,
+	})
+
+	return nil
+}
+
+// add adds p, forgetting the processes that have exited since they were added
+func (ps *processes) add(p *process) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	running := ps.procs[:0]
+
+	for _, proc := range ps.procs {
+		if !exited(proc.p) {
+			running = append(running, proc)
+		}
+	}
+
+	ps.procs = append(running, p)
+}
+
+// Shutdown stops the processes concurrently, returning the errors
+// of those that could not be stopped joined
+func (ps *processes) Shutdown(ctx context.Context) error {
+	ps.mu.Lock()
+	procs := append([]*process(nil), ps.procs...)
+	ps.mu.Unlock()
+
+	errs := make([]error, len(procs))
+
+	var wg sync.WaitGroup
+
+	for n, proc := range procs {
+		wg.Add(1)
+
+		go func(n int, proc *process) {
+			defer wg.Done()
+
+			errs[n] = proc.stop(ctx)
+		}(n, proc)
+	}
+
+	wg.Wait()
+
+	return joinErrors(errs...)
+}
+
+// stop asks the process to exit, killing it if it has not exited
+// within ProcessTimeout, or once ctx is done
+func (proc *process) stop(ctx context.Context) error {
+	i, _ := ctx.Value(statsContextKey).(*Instance)
+
+	emit := func(signal string, d time.Duration) {
+		if i != nil {
+			i.emit(Event{Kind: ProcessEvent, Phase: CleanupPhase, Name: proc.name, Source: signal, Duration: d})
+		}
+	}
+
+	clk := contextClock(ctx)
+	start := clk.Now()
+
+	if exited(proc.p) {
+		emit("", 0)
+		return nil
+	}
+
+	if err := terminate(proc.p); errors.Is(err, os.ErrProcessDone) {
+		emit("", 0)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", proc.name, err)
+	}
+
+	if terminateKills {
+		emit("SIGKILL", clk.Now().Sub(start))
+		return nil
+	}
+
+	timeout := clk.NewTimer(ProcessTimeout)
+	defer timeout.Stop()
+
+	for !exited(proc.p) {
+		poll := clk.NewTimer(processPollInterval)
+
+		select {
+		case <-poll.C():
+			continue
+		case <-timeout.C():
+		case <-ctx.Done():
+		}
+
+		poll.Stop()
+
+		if err := proc.p.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("%s: %w", proc.name, err)
+		}
+
+		emit("SIGKILL", clk.Now().Sub(start))
+		return nil
+	}
+
+	emit("SIGTERM", clk.Now().Sub(start))
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package graceful
+
+import "os"
+
+// terminateKills reports whether terminate kills the process,
+// as there is no SIGTERM to ask it to exit
+const terminateKills = true
+
+// terminate kills p, returning os.ErrProcessDone if it has already exited
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+// exited reports whether p has exited, which is only known by killing it
+func exited(p *os.Process) bool {
+	return false
+}
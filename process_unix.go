@@ -0,0 +1,24 @@
+//go:build unix
+
+package graceful
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// terminateKills reports whether terminate kills the process
+const terminateKills = false
+
+// terminate sends SIGTERM to p, returning os.ErrProcessDone
+// if it has already exited
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// exited reports whether p has exited, and been waited for, or on Linux
+// whether it has exited at all
+func exited(p *os.Process) bool {
+	return errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone) || exitedUnwaited(p)
+}
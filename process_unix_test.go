@@ -0,0 +1,92 @@
+//go:build unix
+
+package graceful
+
+import (
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterProcess(t *testing.T) {
+	defer func(timeout time.Duration) { ProcessTimeout = timeout }(ProcessTimeout)
+	ProcessTimeout = 100 * time.Millisecond
+
+	start := func(script string) *exec.Cmd {
+		cmd := exec.Command("sh", "-c", script)
+
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		go cmd.Wait()
+
+		return cmd
+	}
+
+	r := &Registry{}
+
+	if err := r.RegisterProcess(exec.Command("true")); err != ErrProcessNotStarted {
+		t.Fatalf("r.RegisterProcess() = %v before starting, want %v", err, ErrProcessNotStarted)
+	}
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	terminated := start(`trap "exit 0" TERM; while :; do sleep 0.01; done`)
+	killed := start(`trap "" TERM; while :; do sleep 0.01; done`)
+
+	// The exited process is only kept as the last one registered
+	for _, cmd := range []*exec.Cmd{exited, terminated, killed, exited} {
+		if err := r.RegisterProcess(cmd); err != nil {
+			t.Fatalf("r.RegisterProcess() = %v, want nil", err)
+		}
+	}
+
+	if got, want := len(r.processes.procs), 3; got != want {
+		t.Fatalf("len(r.processes.procs) = %d, want %d", got, want)
+	}
+
+	// Give the shells time to set their traps
+	time.Sleep(50 * time.Millisecond)
+
+	outcomes := map[int]string{}
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r), WithEventHandler(func(e Event) {
+		if e.Kind != ProcessEvent {
+			return
+		}
+
+		for _, cmd := range []*exec.Cmd{exited, terminated, killed} {
+			if strings.HasSuffix(e.Name, "(pid "+strconv.Itoa(cmd.Process.Pid)+")") {
+				outcomes[cmd.Process.Pid] = e.String()
+			}
+		}
+	}))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	for _, tc := range []struct {
+		cmd  *exec.Cmd
+		want string
+	}{
+		{exited, "Skipped true"},
+		{terminated, "Stopped sh (pid " + strconv.Itoa(terminated.Process.Pid) + ") with SIGTERM"},
+		{killed, "Stopped sh (pid " + strconv.Itoa(killed.Process.Pid) + ") with SIGKILL"},
+	} {
+		if got := outcomes[tc.cmd.Process.Pid]; !strings.HasPrefix(got, tc.want) {
+			t.Fatalf("outcome = %q, want %q", got, tc.want)
+		}
+	}
+
+	if r.processes != nil || len(r.components) != 0 {
+		t.Fatalf("r.processes = %v, r.components = %v once shut down, want them taken", r.processes, r.components)
+	}
+}
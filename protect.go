@@ -0,0 +1,239 @@
+package graceful
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// HealthHandler returns a handler answering 200 OK until the Instance
+// begins shutting down, or reaches the FlipReadiness stage set by
+// WithDrainStages, and 503 Service Unavailable, with the reason, from then
+// on. Serve it on a path set by WithProtectedPaths to keep answering health
+// checks during the drain.
+func (i *Instance) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-i.gate(&i.unready):
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok\n"))
+		}
+	})
+}
+
+// kept is an *http.Server whose listeners are kept open while shutting
+// down, to serve the paths set by WithProtectedPaths
+type kept struct {
+	hs    *http.Server
+	lns   []*sharedListener
+	serve func(s *http.Server, ln net.Listener) error
+
+	protector *http.Server
+}
+
+// keep wraps the listeners of hs, if WithProtectedPaths is used,
+// so that they can be handed over to a protector once the drain begins
+func (i *Instance) keep(hs *http.Server, lns []net.Listener, serve func(s *http.Server, ln net.Listener) error) []net.Listener {
+	if len(i.cfg.protected) == 0 {
+		return lns
+	}
+
+	k := &kept{hs: hs, serve: serve}
+	views := make([]net.Listener, len(lns))
+
+	for n, ln := range lns {
+		k.lns = append(k.lns, newSharedListener(ln))
+		views[n] = k.lns[n].view()
+	}
+
+	i.keptMu.Lock()
+	if i.kept == nil {
+		i.kept = map[*http.Server]*kept{}
+	}
+	i.kept[hs] = k
+	i.keptMu.Unlock()
+
+	return views
+}
+
+// served closes the listeners kept for hs if serving it failed,
+// as they are not handed over to a protector, and returns err
+func (i *Instance) served(hs *http.Server, err error) error {
+	if err == http.ErrServerClosed {
+		return err
+	}
+
+	i.keptMu.Lock()
+	k := i.kept[hs]
+	delete(i.kept, hs)
+	i.keptMu.Unlock()
+
+	if k != nil {
+		for _, ln := range k.lns {
+			ln.Close()
+		}
+	}
+
+	return err
+}
+
+// protect starts serving the protected paths of hs on its listeners,
+// before it stops accepting connections
+func (i *Instance) protect(hs *http.Server) {
+	i.keptMu.Lock()
+	k := i.kept[hs]
+	i.keptMu.Unlock()
+
+	if k == nil {
+		return
+	}
+
+	k.protector = &http.Server{Handler: i.protectedHandler(hs.Handler), TLSConfig: hs.TLSConfig, ErrorLog: hs.ErrorLog}
+	k.protector.SetKeepAlivesEnabled(false)
+
+	for _, ln := range k.lns {
+		go k.serve(k.protector, ln.view())
+	}
+}
+
+// unprotect closes the listeners kept open by protect,
+// once the shutdown has finished
+func (i *Instance) unprotect() {
+	i.keptMu.Lock()
+	ks := i.kept
+	i.kept = nil
+	i.keptMu.Unlock()
+
+	for _, k := range ks {
+		if k.protector != nil {
+			k.protector.Close()
+		}
+
+		for _, ln := range k.lns {
+			ln.Close()
+		}
+	}
+}
+
+// protectedHandler serves the protected paths using h,
+// and answers every other request with 503 Service Unavailable
+func (i *Instance) protectedHandler(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !i.protects(r.URL.Path) {
+			i.rejected.Add(1)
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// protects reports whether path was set by WithProtectedPaths
+func (i *Instance) protects(path string) bool {
+	for _, p := range i.cfg.protected {
+		if p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sharedListener accepts connections on a listener, handing them
+// to whichever of its views is accepting
+type sharedListener struct {
+	ln    net.Listener
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+
+	// failed is closed once accepting fails with err
+	failed chan struct{}
+	err    error
+}
+
+func newSharedListener(ln net.Listener) *sharedListener {
+	s := &sharedListener{
+		ln:     ln,
+		conns:  make(chan net.Conn),
+		done:   make(chan struct{}),
+		failed: make(chan struct{}),
+	}
+
+	go s.accept()
+
+	return s
+}
+
+func (s *sharedListener) accept() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			s.err = err
+			close(s.failed)
+			return
+		}
+
+		select {
+		case s.conns <- c:
+		case <-s.done:
+			c.Close()
+			return
+		}
+	}
+}
+
+// view returns a listener accepting the connections of s until it is closed,
+// without closing s
+func (s *sharedListener) view() net.Listener {
+	return &listenerView{s: s, closed: make(chan struct{})}
+}
+
+// Close closes the underlying listener
+func (s *sharedListener) Close() error {
+	var err error
+
+	s.once.Do(func() {
+		close(s.done)
+		err = s.ln.Close()
+	})
+
+	return err
+}
+
+type listenerView struct {
+	s      *sharedListener
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (v *listenerView) Accept() (net.Conn, error) {
+	select {
+	case <-v.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case c := <-v.s.conns:
+		return c, nil
+	case <-v.s.failed:
+		return nil, v.s.err
+	case <-v.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (v *listenerView) Close() error {
+	v.once.Do(func() { close(v.closed) })
+
+	return nil
+}
+
+func (v *listenerView) Addr() net.Addr { return v.s.ln.Addr() }
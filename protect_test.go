@@ -0,0 +1,126 @@
+package graceful
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithProtectedPaths(t *testing.T) {
+	addrs := make(chan string, 2)
+
+	g := NewGroup(WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"),
+		WithProtectedPaths("/healthz"), WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				addrs <- e.Server + " " + e.Addr
+			}
+		}))
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	public := http.NewServeMux()
+	public.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "home")
+	})
+	public.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "drained")
+	})
+
+	admin := http.NewServeMux()
+	admin.Handle("/healthz", g.HealthHandler())
+
+	g.Add("public", &http.Server{Addr: "127.0.0.1:0", Handler: g.Middleware(public)})
+	g.Add("admin", &http.Server{Addr: "127.0.0.1:0", Handler: admin})
+
+	errs := make(chan error, 1)
+	go func() { errs <- g.Run(context.Background()) }()
+
+	urls := map[string]string{}
+
+	for n := 0; n < 2; n++ {
+		f := strings.Fields(<-addrs)
+		urls[f[0]] = "http://" + f[1]
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	get := func(url string) (int, string) {
+		t.Helper()
+
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		b, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	if code, body := get(urls["admin"] + "/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz = %d %q before shutdown, want %d", code, body, http.StatusOK)
+	}
+
+	slow := make(chan string, 1)
+
+	go func() {
+		_, body := get(urls["public"] + "/slow")
+		slow <- body
+	}()
+
+	<-started
+
+	g.Shutdown()
+
+	// Wait for the servers to hand their listeners over
+	for n := 0; ; n++ {
+		if code, _ := get(urls["public"] + "/"); code == http.StatusServiceUnavailable {
+			break
+		}
+
+		if n == 100 {
+			t.Fatalf("public server did not start rejecting requests")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, url := range []string{urls["admin"] + "/healthz", urls["public"] + "/healthz"} {
+		code, body := get(url)
+
+		if url == urls["admin"]+"/healthz" && (code != http.StatusServiceUnavailable || body != "shutting down") {
+			t.Fatalf("%s = %d %q while draining, want %d %q", url, code, body, http.StatusServiceUnavailable, "shutting down")
+		}
+
+		// The public server has no health handler, so the request
+		// reaches the mux, instead of being rejected
+		if url == urls["public"]+"/healthz" && body != "home" {
+			t.Fatalf("%s = %d %q while draining, want the mux to answer", url, code, body)
+		}
+	}
+
+	close(release)
+
+	if got, want := <-slow, "drained"; got != want {
+		t.Fatalf("in-flight response = %q, want %q", got, want)
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("g.Run() = %v, want nil", err)
+	}
+
+	for name, url := range urls {
+		if c, err := net.Dial("tcp", strings.TrimPrefix(url, "http://")); err == nil {
+			c.Close()
+			t.Fatalf("%s listener still open after shutdown", name)
+		}
+	}
+}
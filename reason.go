@@ -0,0 +1,161 @@
+package graceful
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReasonKind is the kind of cause that triggered a shutdown
+type ReasonKind string
+
+// Reason kinds
+const (
+	// SignalReason is a shutdown signal being received
+	SignalReason ReasonKind = "signal"
+
+	// TriggerReason is Shutdown being called
+	TriggerReason ReasonKind = "trigger"
+
+	// ServeErrorReason is a server failing
+	ServeErrorReason ReasonKind = "serve_error"
+
+	// ContextReason is the context passed to Run being done
+	ContextReason ReasonKind = "context"
+
+	// ParentDeathReason is the parent process exiting, see WithParentDeath
+	ParentDeathReason ReasonKind = "parent_death"
+)
+
+// Reason is what triggered a shutdown
+type Reason struct {
+	Kind ReasonKind
+
+	// Signal is the signal received, for SignalReason, and Err the error of
+	// the server, for ServeErrorReason, or the cause of the context being
+	// done, for ContextReason
+	Signal os.Signal
+	Err    error
+
+	// At is when it was recorded
+	At time.Time
+}
+
+// Detail returns the name of the signal, or the error, of the reason
+func (r Reason) Detail() string {
+	switch {
+	case r.Signal != nil:
+		return r.Signal.String()
+	case r.Err != nil:
+		return r.Err.Error()
+	}
+
+	return ""
+}
+
+// String describes the reason, such as "signal terminated"
+func (r Reason) String() string {
+	switch r.Kind {
+	case SignalReason:
+		return "signal " + r.Detail()
+	case TriggerReason:
+		return "Shutdown call"
+	case ServeErrorReason:
+		return "serve error: " + r.Detail()
+	case ContextReason:
+		return "context done: " + r.Detail()
+	case ParentDeathReason:
+		return "parent process exit"
+	}
+
+	return string(r.Kind)
+}
+
+var (
+	lastReasonMu sync.Mutex
+	lastReason   Reason
+)
+
+// ShutdownReason returns what triggered the latest shutdown of an Instance,
+// or false if none has been triggered
+func ShutdownReason() (Reason, bool) {
+	lastReasonMu.Lock()
+	defer lastReasonMu.Unlock()
+
+	return lastReason, lastReason.Kind != ""
+}
+
+// recordReason records r as what triggered the shutdown, unless another
+// cause was recorded first, in which case r is added to the additional
+// triggers, unless one of its kind already was
+func (i *Instance) recordReason(r Reason) {
+	r.At = i.clock().Now()
+
+	i.reasonMu.Lock()
+	defer i.reasonMu.Unlock()
+
+	if i.reason.Kind == "" {
+		i.reason = r
+
+		lastReasonMu.Lock()
+		lastReason = r
+		lastReasonMu.Unlock()
+
+		return
+	}
+
+	if i.reason.Kind == r.Kind {
+		return
+	}
+
+	for _, a := range i.additional {
+		if a.Kind == r.Kind {
+			return
+		}
+	}
+
+	i.additional = append(i.additional, r)
+}
+
+// shutdownReason returns what triggered the shutdown,
+// and the causes recorded after it
+func (i *Instance) shutdownReason() (Reason, []Reason) {
+	i.reasonMu.Lock()
+	defer i.reasonMu.Unlock()
+
+	return i.reason, append([]Reason(nil), i.additional...)
+}
+
+// stoppedBy records the signal received, and ctx being done, as reasons
+// for the shutdown, Shutdown records itself when it is called
+func (i *Instance) stoppedBy(ctx context.Context) {
+	if i.signal != nil {
+		i.recordReason(Reason{Kind: SignalReason, Signal: i.signal})
+	}
+
+	if ctx.Err() != nil {
+		i.recordReason(Reason{Kind: ContextReason, Err: context.Cause(ctx)})
+	}
+}
+
+// noteContext records ctx being done while shutting down as an additional
+// trigger, until the returned function is called
+func (i *Instance) noteContext(ctx context.Context) func() {
+	done, stopped := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			i.recordReason(Reason{Kind: ContextReason, Err: context.Cause(ctx)})
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,103 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestShutdownReason(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		shutdown   func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc)
+		reason     string
+		additional []ReasonKind
+	}{
+		{"signal", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { signals <- syscall.SIGTERM },
+			"signal terminated", []ReasonKind{TriggerReason}},
+		{"shutdown", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { i.Shutdown() },
+			"Shutdown call", nil},
+		{"run context", func(i *Instance, signals chan<- os.Signal, cancel context.CancelFunc) { cancel() },
+			"context done: context canceled", []ReasonKind{TriggerReason}},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			listening := make(chan struct{}, 1)
+			signals := make(chan os.Signal, 1)
+			reg := &Registry{}
+
+			var logged string
+
+			i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithRegistry(reg),
+				WithEventHandler(func(e Event) {
+					switch e.Kind {
+					case ListeningEvent:
+						listening <- struct{}{}
+					case ShutdownEvent:
+						logged = e.String()
+					}
+				}))
+
+			// Shutting down again while shutting down is an additional trigger
+			reg.Register("again", shutdownFunc(func(ctx context.Context) error {
+				i.Shutdown()
+				return nil
+			}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errs := make(chan error, 1)
+			go func() { errs <- i.Run(ctx) }()
+
+			<-listening
+
+			tc.shutdown(i, signals, cancel)
+
+			if err := <-errs; err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+
+			r := i.Report()
+
+			if got := r.Reason.String(); got != tc.reason {
+				t.Fatalf("r.Reason = %q, want %q", got, tc.reason)
+			}
+
+			if want := "Server shutdown with timeout: 15s, on " + tc.reason + ", 0 connections open"; logged != want {
+				t.Fatalf("logged %q, want %q", logged, want)
+			}
+
+			var additional []ReasonKind
+
+			for _, a := range r.AdditionalTriggers {
+				additional = append(additional, a.Kind)
+			}
+
+			if len(additional) != len(tc.additional) || len(additional) > 0 && additional[0] != tc.additional[0] {
+				t.Fatalf("r.AdditionalTriggers = %v, want %v", additional, tc.additional)
+			}
+
+			if reason, ok := ShutdownReason(); !ok || reason.String() != tc.reason {
+				t.Fatalf("ShutdownReason() = %q, %t, want %q", reason, ok, tc.reason)
+			}
+		})
+	}
+
+	t.Run("serve error", func(t *testing.T) {
+		g := NewGroup(WithRegistry(&Registry{}))
+
+		g.Add("ok", &http.Server{Addr: "127.0.0.1:0"})
+		g.Add("bad", &http.Server{Addr: "invalid:address:0"})
+
+		err := g.Run(context.Background())
+
+		if r := g.Report(); r.Reason.Kind != ServeErrorReason || !errors.Is(r.Reason.Err, err) {
+			t.Fatalf("r.Reason = %v, want the serve error %v", r.Reason, err)
+		}
+	})
+}
@@ -0,0 +1,436 @@
+package graceful
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry holds named Shutdowners, such as database pools and queue
+// consumers, that are shut down in the order they were registered once
+// the servers and their handlers have shut down, see HookTier
+type Registry struct {
+	mu         sync.Mutex
+	components []*component
+	drainers   []*drainer
+	processes  *processes
+	loops      []*loop
+
+	// loopRunner is the Instance running the loops, once one has started
+	loopRunner *Instance
+
+	// closed is set once an Instance begins shutting down the registry,
+	// see take
+	closed bool
+}
+
+type component struct {
+	name   string
+	s      Shutdowner
+	weight int
+
+	// tier is set by HookTier, if tiered
+	tier   int
+	tiered bool
+
+	// timeout limits the time given to s, if set
+	timeout time.Duration
+
+	// policy is set by HookErrorPolicy, if hasPolicy
+	policy    ErrorPolicy
+	hasPolicy bool
+}
+
+// HookOption configures a Shutdowner added to a Registry
+type HookOption func(*component)
+
+// HookWeight sets the share of the remaining time given to the Shutdowner
+// by WeightedBudget, relative to the weights of those after it (default 1)
+func HookWeight(weight int) HookOption {
+	return func(c *component) {
+		if weight > 0 {
+			c.weight = weight
+		}
+	}
+}
+
+// HookTier puts the Shutdowner in tier. The Shutdowners are shut down one
+// tier at a time, in ascending order, and those in the same tier
+// concurrently. A Shutdowner without a tier is in tier 0, but is shut down
+// on its own, in the order it was registered.
+func HookTier(tier int) HookOption {
+	return func(c *component) {
+		c.tier = tier
+		c.tiered = true
+	}
+}
+
+// HookTimeout limits the time given to the Shutdowner to d, if it would be
+// given more, leaving the time it does not take to those after it
+func HookTimeout(d time.Duration) HookOption {
+	return func(c *component) {
+		c.timeout = d
+	}
+}
+
+// HookErrorPolicy sets what happens to the rest of the Shutdowners in the
+// Registry if the Shutdowner fails, overriding WithErrorPolicy
+func HookErrorPolicy(p ErrorPolicy) HookOption {
+	return func(c *component) {
+		c.policy = p
+		c.hasPolicy = true
+	}
+}
+
+// DefaultRegistry is the Registry shut down by every Instance,
+// unless WithRegistry is used. Shared by several Instances, it is shut
+// down by the first of them to shut down, the others finding it empty.
+var DefaultRegistry = &Registry{}
+
+// Register adds s to the DefaultRegistry
+func Register(name string, s Shutdowner, opts ...HookOption) error {
+	return DefaultRegistry.Register(name, s, opts...)
+}
+
+// Register adds s to the registry, to be shut down after those already added,
+// returning ErrRegistryClosed once an Instance has begun shutting it down, as
+// it is shut down once.
+func (r *Registry) Register(name string, s Shutdowner, opts ...HookOption) error {
+	c := &component{name: name, s: s, weight: 1}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRegistryClosed
+	}
+
+	r.components = append(r.components, c)
+
+	return nil
+}
+
+// take detaches what has been registered, for i to shut down, so that
+// it is shut down once, leaving the loops run by another Instance in
+// place. The registry refuses registrations from then on.
+func (r *Registry) take(i *Instance) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+
+	t := &Registry{components: r.components, drainers: r.drainers, processes: r.processes}
+	r.components, r.drainers, r.processes = nil, nil, nil
+
+	if r.loopRunner == nil || r.loopRunner == i {
+		t.loops, t.loopRunner = r.loops, r.loopRunner
+		r.loops, r.loopRunner = nil, nil
+	}
+
+	return t
+}
+
+// OnShutdownDone adds fn to the DefaultRegistry, named name
+//
+//	graceful.OnShutdownDone("billing-flush", billing.Flush, graceful.HookTimeout(2*time.Second))
+func OnShutdownDone(name string, fn func(ctx context.Context) error, opts ...HookOption) error {
+	return DefaultRegistry.Register(name, shutdownerFunc(fn), opts...)
+}
+
+// IdleCloser is implemented by *http.Client and *http.Transport
+type IdleCloser interface {
+	CloseIdleConnections()
+}
+
+// RegisterTransport adds t to the DefaultRegistry, see Registry.RegisterTransport
+func RegisterTransport(name string, t IdleCloser, opts ...HookOption) error {
+	return DefaultRegistry.RegisterTransport(name, t, opts...)
+}
+
+// RegisterTransport adds t, such as an *http.Transport shared by clients
+// of upstream services, to the registry, to have its idle connections
+// closed once the servers and their handlers have shut down
+func (r *Registry) RegisterTransport(name string, t IdleCloser, opts ...HookOption) error {
+	return r.Register(name, shutdownerFunc(func(ctx context.Context) error {
+		t.CloseIdleConnections()
+		return nil
+	}), opts...)
+}
+
+func (r *Registry) snapshot() []*component {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*component(nil), r.components...)
+}
+
+// BudgetPolicy decides how much of the remaining shutdown time each
+// Shutdowner in a Registry is given
+type BudgetPolicy int
+
+// Budget policies
+const (
+	// SharedBudget gives every Shutdowner all of the remaining time
+	SharedBudget BudgetPolicy = iota
+
+	// EqualBudget splits the remaining time equally between the Shutdowners
+	// not yet shut down, so that time left over by one goes to the rest
+	EqualBudget
+
+	// WeightedBudget splits the remaining time between the Shutdowners
+	// not yet shut down in proportion to their HookWeight
+	WeightedBudget
+)
+
+// allocate returns the time given to the first n of cs, shut down
+// concurrently, out of remaining, with cs being the components
+// not yet shut down
+func (p BudgetPolicy) allocate(remaining time.Duration, n int, cs []*component) time.Duration {
+	switch p {
+	case EqualBudget:
+		return remaining * time.Duration(n) / time.Duration(len(cs))
+	case WeightedBudget:
+		share, total := 0, 0
+
+		for k, c := range cs {
+			if k < n {
+				share += c.weight
+			}
+
+			total += c.weight
+		}
+
+		return remaining * time.Duration(share) / time.Duration(total)
+	}
+
+	return remaining
+}
+
+// ErrorPolicy decides whether the Shutdowners in a Registry after one
+// that failed are shut down
+type ErrorPolicy int
+
+// Error policies
+const (
+	// ContinueOnError shuts down the rest of the Shutdowners
+	ContinueOnError ErrorPolicy = iota
+
+	// AbortOnError skips the Shutdowners in the tiers after the one that
+	// failed, for when they must not run unless it succeeded
+	AbortOnError
+)
+
+func (p ErrorPolicy) String() string {
+	if p == AbortOnError {
+		return "abort"
+	}
+
+	return "continue"
+}
+
+// errorPolicy returns the error policy of c
+func (i *Instance) errorPolicy(c *component) ErrorPolicy {
+	if c.hasPolicy {
+		return c.policy
+	}
+
+	return i.cfg.errorPolicy
+}
+
+// tiers returns the components in the order they are shut down, and that
+// order split into the components shut down concurrently, see HookTier
+func tiers(cs []*component) ([]*component, [][]*component) {
+	sorted := append([]*component(nil), cs...)
+
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].tier < sorted[b].tier
+	})
+
+	var stages [][]*component
+
+	for n, c := range sorted {
+		if last := len(stages) - 1; n > 0 && c.tiered && sorted[n-1].tiered && sorted[n-1].tier == c.tier {
+			stages[last] = append(stages[last], c)
+			continue
+		}
+
+		stages = append(stages, []*component{c})
+	}
+
+	return sorted, stages
+}
+
+// registry returns the Registry set by WithRegistry, or the DefaultRegistry
+func (i *Instance) registry() *Registry {
+	if i.cfg.registry != nil {
+		return i.cfg.registry
+	}
+
+	return DefaultRegistry
+}
+
+// cleanup shuts down the components of reg one tier at a time,
+// continuing after errors unless their ErrorPolicy is AbortOnError,
+// passing the timing of each tier to timed, and returns their reports
+// and errors joined
+func (i *Instance) cleanup(ctx context.Context, reg *Registry, timed func(PhaseTiming)) ([]ComponentReport, error) {
+	sorted, stages := tiers(reg.snapshot())
+
+	if len(stages) == 0 {
+		timed(PhaseTiming{Phase: CleanupPhase, Skipped: true})
+		return nil, nil
+	}
+
+	var (
+		reports []ComponentReport
+		errs    []error
+		offset  int
+	)
+
+	for n, stage := range stages {
+		start := i.clock().Now()
+
+		left, ok := Remaining(ctx)
+		if !ok {
+			left = i.shutdownTimeout()
+		}
+
+		allocated := i.cfg.budget.allocate(left, len(stage), sorted[offset:])
+		offset += len(stage)
+
+		stageReports := make([]ComponentReport, len(stage))
+
+		var wg sync.WaitGroup
+
+		for n, c := range stage {
+			wg.Add(1)
+
+			go func(n int, c *component) {
+				defer wg.Done()
+
+				stageReports[n] = i.shutdownComponent(ctx, c, allocated)
+			}(n, c)
+		}
+
+		wg.Wait()
+
+		reports = append(reports, stageReports...)
+
+		var stageErrs []error
+		for _, cr := range stageReports {
+			stageErrs = append(stageErrs, cr.Err)
+		}
+
+		timed(stageTiming(stage, i.newPhaseReport(start, joinErrors(stageErrs...)), false))
+
+		var aborted *component
+
+		for k, cr := range stageReports {
+			if cr.Err == nil {
+				continue
+			}
+
+			errs = append(errs, cr.Err)
+
+			if aborted == nil && i.errorPolicy(stage[k]) == AbortOnError {
+				aborted = stage[k]
+			}
+		}
+
+		if aborted != nil {
+			reports = append(reports, i.skip(aborted, stages[n+1:])...)
+
+			for _, skipped := range stages[n+1:] {
+				timed(stageTiming(skipped, PhaseReport{}, true))
+			}
+
+			break
+		}
+	}
+
+	return reports, joinErrors(errs...)
+}
+
+// stageTiming returns the timing p of the cleanup of stage, which is either
+// components of the same tier or a single component without one
+func stageTiming(stage []*component, p PhaseReport, skipped bool) PhaseTiming {
+	t := PhaseTiming{Phase: CleanupPhase, Skipped: skipped, PhaseReport: p}
+
+	if c := stage[0]; c.tiered {
+		tier := c.tier
+		t.Tier = &tier
+	} else {
+		t.Name = c.name
+	}
+
+	return t
+}
+
+// skip reports the components of stages as skipped, after failed failed
+// with the AbortOnError policy
+func (i *Instance) skip(failed *component, stages [][]*component) []ComponentReport {
+	var (
+		reports []ComponentReport
+		names   []string
+	)
+
+	for _, stage := range stages {
+		for _, c := range stage {
+			var tier *int
+
+			if c.tiered {
+				t := c.tier
+				tier = &t
+			}
+
+			reports = append(reports, ComponentReport{Name: c.name, Tier: tier, Skipped: true})
+			names = append(names, c.name)
+		}
+	}
+
+	i.emit(Event{Kind: AbortedEvent, Phase: CleanupPhase, Name: failed.name, Skipped: names})
+
+	return reports
+}
+
+// shutdownComponent shuts down c, giving it allocated of the time left
+func (i *Instance) shutdownComponent(ctx context.Context, c *component, allocated time.Duration) ComponentReport {
+	var tier *int
+
+	if c.tiered {
+		t := c.tier
+		tier = &t
+	}
+
+	if c.timeout > 0 && c.timeout < allocated {
+		allocated = c.timeout
+	}
+
+	cctx, cancel := withTimeout(ctx, i.clock(), allocated)
+	defer cancel()
+
+	start := i.clock().Now()
+
+	err := phaseError(CleanupPhase, c.name, i.call(cctx, CleanupPhase, c.s))
+
+	if err != nil {
+		i.emit(Event{Kind: ErrorEvent, Phase: CleanupPhase, Name: c.name, Tier: tier, Err: err})
+	}
+
+	finished := i.clock().Now()
+
+	i.emit(Event{Kind: ComponentEvent, Phase: CleanupPhase, Name: c.name, Tier: tier,
+		Timeout: allocated, Duration: finished.Sub(start), Err: err})
+
+	return ComponentReport{Name: c.name, Tier: tier, Timeout: allocated,
+		Started: start, Finished: finished, Duration: finished.Sub(start), Err: err}
+}
@@ -0,0 +1,447 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetPolicyAllocate(t *testing.T) {
+	cs := []*component{{weight: 1}, {weight: 2}, {weight: 1}}
+
+	for _, tc := range []struct {
+		policy BudgetPolicy
+		want   time.Duration
+	}{
+		{SharedBudget, 12 * time.Second},
+		{EqualBudget, 4 * time.Second},
+		{WeightedBudget, 3 * time.Second},
+	} {
+		if got := tc.policy.allocate(12*time.Second, 1, cs); got != tc.want {
+			t.Fatalf("allocate(%d) = %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+
+	// A tier of the first two is given their shares together
+	for _, tc := range []struct {
+		policy BudgetPolicy
+		want   time.Duration
+	}{
+		{SharedBudget, 12 * time.Second},
+		{EqualBudget, 8 * time.Second},
+		{WeightedBudget, 9 * time.Second},
+	} {
+		if got := tc.policy.allocate(12*time.Second, 2, cs); got != tc.want {
+			t.Fatalf("allocate(%d) of two = %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("shared", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var buf bytes.Buffer
+
+		r := &Registry{}
+
+		var order []string
+
+		r.Register("first", shutdownFunc(func(ctx context.Context) error {
+			order = append(order, "first")
+			clk.Advance(time.Second)
+			return nil
+		}))
+
+		r.Register("second", shutdownFunc(func(ctx context.Context) error {
+			order = append(order, "second")
+			return nil
+		}))
+
+		i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r), WithClock(clk))
+
+		if err := i.shutdown(); err != nil {
+			t.Fatalf("i.shutdown() = %v, want nil", err)
+		}
+
+		if got, want := fmt.Sprint(order), "[first second]"; got != want {
+			t.Fatalf("order = %s, want %s", got, want)
+		}
+
+		want := fmt.Sprintf(ShutdownFormat+FinishedHTTP+ComponentFormat+ComponentFormat+FinishedDurationFormat,
+			Timeout, "first", time.Second, 15*time.Second, "second", time.Duration(0), 14*time.Second, 14*time.Second)
+
+		if got := buf.String(); got != want {
+			t.Fatalf("buf.String() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		clk := newFakeClock()
+
+		var events []Event
+
+		r := &Registry{}
+
+		r.Register("slow", shutdownFunc(func(ctx context.Context) error {
+			left, _ := Remaining(ctx)
+			clk.Advance(left)
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+
+		closed := false
+
+		r.Register("db", shutdownFunc(func(ctx context.Context) error {
+			closed = true
+			return nil
+		}))
+
+		i := newInstance(&http.Server{}, nil, WithRegistry(r), WithBudgetPolicy(EqualBudget), WithEventHandler(func(e Event) {
+			if e.Kind == ComponentEvent {
+				events = append(events, e)
+			}
+		}), WithClock(clk))
+
+		if got, want := i.shutdown(), context.DeadlineExceeded; !errors.Is(got, want) {
+			t.Fatalf("i.shutdown() = %v, want %v", got, want)
+		}
+
+		if !closed {
+			t.Fatalf("db was starved by slow component")
+		}
+
+		for n, want := range []time.Duration{7500 * time.Millisecond, 7500 * time.Millisecond} {
+			if got := events[n].Timeout; got != want {
+				t.Fatalf("events[%d].Timeout = %v, want %v", n, got, want)
+			}
+		}
+	})
+}
+
+type idleCloser struct {
+	closed int
+}
+
+func (ic *idleCloser) CloseIdleConnections() { ic.closed++ }
+
+func TestRegistryRegisterTransport(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := &Registry{}
+	ic := &idleCloser{}
+
+	r.RegisterTransport("upstream", ic)
+
+	// The transports used by clients, and clients themselves, are IdleClosers
+	r.RegisterTransport("client", &http.Client{Transport: &http.Transport{}})
+
+	i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if got, want := ic.closed, 1; got != want {
+		t.Fatalf("ic.closed = %d, want %d", got, want)
+	}
+
+	for _, name := range []string{"upstream", "client"} {
+		if !strings.Contains(buf.String(), "Shut down "+name+" in ") {
+			t.Fatalf("log = %q, want the shutdown of %s logged", buf.String(), name)
+		}
+	}
+}
+
+func TestRegistryTiers(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		mu    sync.Mutex
+		order []string
+	)
+
+	r := &Registry{}
+
+	// The consumers are shut down together, each waiting for the other
+	both := make(chan struct{}, 2)
+
+	consumer := func(name string) Shutdowner {
+		return shutdownFunc(func(ctx context.Context) error {
+			both <- struct{}{}
+
+			for len(both) < 2 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Millisecond):
+				}
+			}
+
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	done := func(name string) Shutdowner {
+		return shutdownFunc(func(ctx context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	r.Register("db", done("db"), HookTier(2))
+	r.Register("orders", consumer("orders"), HookTier(1))
+	r.Register("lb", done("lb"), HookTier(0))
+	r.Register("payments", consumer("payments"), HookTier(1))
+
+	i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if got := fmt.Sprint(order); got != "[lb orders payments db]" && got != "[lb payments orders db]" {
+		t.Fatalf("order = %s, want lb, then the consumers, then db", got)
+	}
+
+	if !strings.Contains(buf.String(), "Shut down payments (tier 1) in ") {
+		t.Fatalf("log = %q, want the tier logged", buf.String())
+	}
+
+	rep := i.Report()
+
+	if len(rep.Cleanup) != 4 || rep.Cleanup[1].Name != "orders" || rep.Cleanup[1].Tier == nil || *rep.Cleanup[1].Tier != 1 {
+		t.Fatalf("rep.Cleanup = %+v, want the tiers in the order they were shut down", rep.Cleanup)
+	}
+
+}
+
+func TestRegistryClosed(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []string
+		late  error
+	)
+
+	r := &Registry{}
+
+	register := func(name string) error {
+		return r.Register(name, shutdownFunc(func(ctx context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+
+			// Registering while shutting down
+			late = r.Register("late", shutdownFunc(func(context.Context) error { return nil }))
+
+			return nil
+		}))
+	}
+
+	register("first")
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if late != ErrRegistryClosed {
+		t.Fatalf("r.Register() = %v while shutting down, want %v", late, ErrRegistryClosed)
+	}
+
+	if err := register("second"); err != ErrRegistryClosed {
+		t.Fatalf("r.Register() = %v once shut down, want %v", err, ErrRegistryClosed)
+	}
+
+	i = newInstance(&http.Server{}, nil, WithRegistry(r))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if got := fmt.Sprint(order); got != "[first]" {
+		t.Fatalf("order = %s, want the Shutdowner shut down once", got)
+	}
+}
+
+func TestDefaultRegistryShared(t *testing.T) {
+	defer func(r *Registry) { DefaultRegistry = r }(DefaultRegistry)
+	DefaultRegistry = &Registry{}
+
+	shutDown := map[string]int{}
+
+	for _, name := range []string{"db", "cache"} {
+		name := name
+
+		Register(name, shutdownFunc(func(context.Context) error {
+			shutDown[name]++
+			return nil
+		}))
+	}
+
+	// Neither uses WithRegistry, sharing the DefaultRegistry
+	public, admin := newInstance(&http.Server{}, nil), newInstance(&http.Server{}, nil)
+
+	if err := public.shutdown(); err != nil {
+		t.Fatalf("public.shutdown() = %v, want nil", err)
+	}
+
+	if got := fmt.Sprint(shutDown); got != "map[cache:1 db:1]" {
+		t.Fatalf("shut down %s by the first Instance, want every Shutdowner", got)
+	}
+
+	if err := Register("late", shutdownFunc(func(context.Context) error { return nil })); err != ErrRegistryClosed {
+		t.Fatalf("Register() = %v once shut down, want %v", err, ErrRegistryClosed)
+	}
+
+	if err := admin.shutdown(); err != nil {
+		t.Fatalf("admin.shutdown() = %v, want nil", err)
+	}
+
+	if got := fmt.Sprint(shutDown); got != "map[cache:1 db:1]" {
+		t.Fatalf("shut down %s by both Instances, want each Shutdowner once", got)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	clk := newFakeClock()
+
+	var events []Event
+
+	r := &Registry{}
+
+	r.Register("billing-flush", shutdownFunc(func(ctx context.Context) error {
+		clk.Advance(2 * time.Second)
+		<-ctx.Done()
+		return ctx.Err()
+	}), HookTimeout(2*time.Second))
+
+	var left time.Duration
+
+	r.Register("db", shutdownFunc(func(ctx context.Context) error {
+		left, _ = Remaining(ctx)
+		return nil
+	}))
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r), WithEventHandler(func(e Event) {
+		if e.Kind == ComponentEvent {
+			events = append(events, e)
+		}
+	}), WithClock(clk))
+
+	if got, want := i.shutdown(), context.DeadlineExceeded; !errors.Is(got, want) {
+		t.Fatalf("i.shutdown() = %v, want %v", got, want)
+	}
+
+	if len(events) != 2 || events[0].Timeout != 2*time.Second || events[0].Err == nil {
+		t.Fatalf("events = %+v, want billing-flush given 2s, and failing", events)
+	}
+
+	// The rest of the budget is left for db
+	if got, want := left, Timeout-2*time.Second; got != want {
+		t.Fatalf("Remaining() = %v for db, want %v", got, want)
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	failed := errors.New("still registered")
+
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		hook    []HookOption
+		skipped bool
+	}{
+		{"continue", nil, nil, false},
+		{"abort", []Option{WithErrorPolicy(AbortOnError)}, nil, true},
+		{"hook abort", nil, []HookOption{HookErrorPolicy(AbortOnError)}, true},
+		{"hook continue", []Option{WithErrorPolicy(AbortOnError)}, []HookOption{HookErrorPolicy(ContinueOnError)}, false},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			r := &Registry{}
+
+			r.Register("lb", shutdownFunc(func(ctx context.Context) error {
+				return failed
+			}), tc.hook...)
+
+			wiped := false
+
+			r.Register("wipe", shutdownFunc(func(ctx context.Context) error {
+				wiped = true
+				return nil
+			}))
+
+			i := newInstance(&http.Server{}, nil, append(tc.opts, WithLogger(log.New(&buf, "", 0)), WithRegistry(r))...)
+
+			if err := i.shutdown(); !errors.Is(err, failed) {
+				t.Fatalf("i.shutdown() = %v, want %v", err, failed)
+			}
+
+			cleanup := i.Report().Cleanup
+
+			if wiped == tc.skipped || len(cleanup) != 2 || cleanup[1].Skipped != tc.skipped {
+				t.Fatalf("wiped = %t, cleanup = %+v, want wipe skipped = %t", wiped, cleanup, tc.skipped)
+			}
+
+			if got := strings.Contains(buf.String(), "Aborting the cleanup after lb failed, skipping wipe\n"); got != tc.skipped {
+				t.Fatalf("log = %q, want the abort logged = %t", buf.String(), tc.skipped)
+			}
+		})
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := &Registry{}
+
+	errs := map[string]error{}
+
+	for _, name := range []string{"cache", "db", "queue", "mail", "search", "billing", "metrics"} {
+		var err error
+
+		if name == "db" || name == "mail" || name == "billing" {
+			err = errors.New(name + " failed")
+		}
+
+		errs[name] = err
+
+		r.Register(name, shutdownFunc(func(ctx context.Context) error { return err }))
+	}
+
+	i := newInstance(&http.Server{}, nil, WithLogger(log.New(&buf, "", 0)), WithRegistry(r))
+
+	err := i.shutdown()
+
+	for _, name := range []string{"db", "mail", "billing"} {
+		if !errors.Is(err, errs[name]) {
+			t.Fatalf("i.shutdown() = %v, want it to match %v", err, errs[name])
+		}
+
+		if !strings.Contains(err.Error(), "cleanup ("+name+"): "+name+" failed") {
+			t.Fatalf("i.shutdown() = %q, want the error of %s named", err, name)
+		}
+	}
+
+	if want := "3 of 7 cleanup steps failed: db, mail, billing\n"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("log = %q, want %q", buf.String(), want)
+	}
+}
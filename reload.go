@@ -0,0 +1,164 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigReloadInterval is how often the file watched by WithConfigReload is
+// checked for changes, and ConfigReloadDebounce how long it must then stay
+// unchanged before the handler is rebuilt, so that an editor writing it
+// several times in a row causes a single rebuild
+var (
+	ConfigReloadInterval = time.Second
+	ConfigReloadDebounce = 500 * time.Millisecond
+)
+
+// WithConfigReload makes the Instance serve the handler returned by build on
+// its *http.Server servers, calling build again whenever the file at path
+// changes, or the process receives syscall.SIGHUP where there is one. The
+// new handler replaces the old one for the requests that follow, while a
+// build that fails, or panics, is logged and the old handler kept. A build
+// that fails on startup is returned as an error from Run. The file stops
+// being watched once the shutdown begins, and the handler being served is
+// shut down like any other handler.
+func WithConfigReload(path string, build func() (http.Handler, error)) Option {
+	return func(c *config) {
+		c.configReload = &configReloader{path: path, build: build}
+	}
+}
+
+// configReloader rebuilds a handler when its config file changes
+type configReloader struct {
+	path  string
+	build func() (http.Handler, error)
+
+	h     atomic.Pointer[http.Handler]
+	stamp configStamp
+}
+
+// configStamp changes whenever the config file changes
+type configStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func (cr *configReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cr.handler().ServeHTTP(w, r)
+}
+
+// handler returns the handler being served
+func (cr *configReloader) handler() http.Handler {
+	return *cr.h.Load()
+}
+
+// startConfigReload builds the first handler, making the servers serve it,
+// and watches the config file until ctx is done
+func (i *Instance) startConfigReload(ctx context.Context) error {
+	cr := i.cfg.configReload
+
+	cr.stamp, _ = cr.stat()
+
+	if err := cr.load(); err != nil {
+		return phaseError(ServePhase, "", err)
+	}
+
+	for _, m := range i.members {
+		if hs, ok := m.server.(*http.Server); ok {
+			hs.Handler = cr
+		}
+	}
+
+	var (
+		hup  <-chan os.Signal
+		stop = func() {}
+	)
+
+	if len(reloadSignals) > 0 {
+		hup, stop = i.signalSource().Notify(reloadSignals...)
+	}
+
+	i.goBackground(ctx, func(ctx context.Context) {
+		defer stop()
+
+		cr.watch(ctx, i.clock(), hup, i.emit)
+	})
+
+	return nil
+}
+
+// load builds a handler, replacing the current one
+func (cr *configReloader) load() error {
+	var h http.Handler
+
+	err := safely(func() (err error) {
+		h, err = cr.build()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("building the handler from %s: %w", cr.path, err)
+	}
+
+	cr.h.Store(&h)
+
+	return nil
+}
+
+func (cr *configReloader) stat() (configStamp, error) {
+	fi, err := os.Stat(cr.path)
+	if err != nil {
+		return configStamp{}, err
+	}
+
+	return configStamp{mod: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// watch rebuilds the handler when the file changes, checked on clk, once it
+// has stayed unchanged for ConfigReloadDebounce, or right away when a signal
+// is received on hup, until ctx is done
+func (cr *configReloader) watch(ctx context.Context, clk Clock, hup <-chan os.Signal, emit func(Event)) {
+	for {
+		var source string
+
+		wait := ConfigReloadInterval
+		changed := false
+
+	poll:
+		for {
+			t := clk.NewTimer(wait)
+
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case sig := <-hup:
+				t.Stop()
+				source = sig.String()
+				break poll
+			case <-t.C():
+			}
+
+			stamp, err := cr.stat()
+
+			switch {
+			case err != nil:
+			case stamp != cr.stamp:
+				// Wait for the writes to settle
+				cr.stamp, changed, wait = stamp, true, ConfigReloadDebounce
+			case changed:
+				break poll
+			}
+		}
+
+		if err := cr.load(); err != nil {
+			emit(Event{Kind: ErrorEvent, Phase: ServePhase, Path: cr.path, Source: source, Err: phaseError(ServePhase, "", err)})
+			continue
+		}
+
+		emit(Event{Kind: ConfigReloadedEvent, Phase: ServePhase, Path: cr.path, Source: source})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package graceful
+
+import "os"
+
+// reloadSignals are none, as there is no SIGHUP to rebuild the handler on
+var reloadSignals []os.Signal
@@ -0,0 +1,186 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConfigReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	write := func(s string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("v1")
+
+	builds := 0
+
+	cr := &configReloader{path: path, build: func() (http.Handler, error) {
+		builds++
+
+		b, err := os.ReadFile(path)
+		if err != nil || string(b) == "invalid" {
+			return nil, errors.New("invalid config")
+		}
+
+		if string(b) == "panic" {
+			panic("unparsable config")
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, string(b))
+		}), nil
+	}}
+
+	cr.stamp, _ = cr.stat()
+
+	if err := cr.load(); err != nil {
+		t.Fatalf("cr.load() = %v, want nil", err)
+	}
+
+	served := func() string {
+		rec := httptest.NewRecorder()
+		cr.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		return rec.Body.String()
+	}
+
+	clk := newFakeClock()
+
+	events := make(chan Event, 10)
+	hup := make(chan os.Signal, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		cr.watch(ctx, clk, hup, func(e Event) { events <- e })
+		close(done)
+	}()
+
+	advance := func(d time.Duration) {
+		clk.WaitForTimers(1)
+		clk.Advance(d)
+	}
+
+	await := func() Event {
+		t.Helper()
+
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatalf("no event")
+			return Event{}
+		}
+	}
+
+	t.Run("debounced", func(t *testing.T) {
+		write("v2")
+		advance(ConfigReloadInterval)
+
+		// Written again before it settled
+		write("v2, again")
+		advance(ConfigReloadDebounce)
+		advance(ConfigReloadDebounce)
+
+		if e := await(); e.Kind != ConfigReloadedEvent || e.String() != "Rebuilt the handler from "+path {
+			t.Fatalf("e = %q, want %q", e.String(), "Rebuilt the handler from "+path)
+		}
+
+		if got, want := builds, 2; got != want {
+			t.Fatalf("builds = %d, want %d", got, want)
+		}
+
+		if got, want := served(), "v2, again"; got != want {
+			t.Fatalf("served %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		write("invalid")
+		advance(ConfigReloadInterval)
+		advance(ConfigReloadDebounce)
+
+		if e := await(); e.Kind != ErrorEvent || e.Err == nil {
+			t.Fatalf("e = %+v, want an error event", e)
+		}
+
+		if got, want := served(), "v2, again"; got != want {
+			t.Fatalf("served %q, want the old handler's %q", got, want)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		write("panic")
+		advance(ConfigReloadInterval)
+		advance(ConfigReloadDebounce)
+
+		var pe *PanicError
+		if e := await(); e.Kind != ErrorEvent || !errors.As(e.Err, &pe) {
+			t.Fatalf("e = %+v, want an error event for the panic", e)
+		}
+
+		if got, want := served(), "v2, again"; got != want {
+			t.Fatalf("served %q, want the old handler's %q", got, want)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		write("v3")
+
+		hup <- syscall.SIGHUP
+
+		if e := await(); e.Kind != ConfigReloadedEvent || e.Source != syscall.SIGHUP.String() {
+			t.Fatalf("e = %+v, want a reload on %s", e, syscall.SIGHUP)
+		}
+
+		if got, want := served(), "v3"; got != want {
+			t.Fatalf("served %q, want %q", got, want)
+		}
+	})
+
+	cancel()
+
+	<-done
+}
+
+func TestConfigReloadHandlerShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	if err := os.WriteFile(path, []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var shutDown bool
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithRegistry(&Registry{}), shutdownOnListening(),
+		WithConfigReload(path, func() (http.Handler, error) {
+			return shutdownFunc(func(ctx context.Context) error {
+				shutDown = true
+				return nil
+			}), nil
+		}))
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if !shutDown {
+		t.Fatalf("the handler built was not shut down")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package graceful
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals make WithConfigReload rebuild the handler
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,412 @@
+package graceful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Report describes a finished shutdown. The times are all read from the
+// clock of the Instance, see WithClock, and carry the monotonic clock reading that the durations
+// are measured with, as long as it is the real clock.
+type Report struct {
+	// Signaled is when the shutdown was triggered, and Signal the name of
+	// the signal that triggered it, or empty if it was not triggered by one
+	Signaled time.Time
+	Signal   string
+
+	// Timeout is the timeout the shutdown had, once clamped by
+	// WithMaxShutdownBudget
+	Timeout time.Duration
+
+	// Reason is what triggered the shutdown, the first of the causes
+	// recorded, and AdditionalTriggers those recorded after it, such as
+	// Shutdown being called once a signal had been received
+	Reason             Reason
+	AdditionalTriggers []Reason
+
+	// Started is when the drain started, after deregistering
+	// and preparing
+	Started time.Time
+
+	// InFlight is the number of connections that had a request
+	// in progress when the drain started
+	InFlight int
+
+	// Conns is the number of connections in each state when the drain started
+	Conns ConnStates
+
+	// Rejected is the number of requests answered by Middleware, or refused
+	// on the listeners kept open by WithProtectedPaths, while shutting down.
+	// ForceClosed is the number of connections closed once the drain hit its
+	// deadline, and HijackedCut the number of hijacked connections, such as
+	// websockets, that were still open and closed along with them.
+	Rejected    int
+	ForceClosed int
+	HijackedCut int
+
+	// ForceClosedRequests is the number of requests that were in progress
+	// on the connections that were force closed, as counted by
+	// WithSlowRequests if used, or else the number of active connections
+	ForceClosedRequests int
+
+	// AbortedRequests are the IDs of the requests still running on the
+	// connections that were force closed, see WithRequestIDExtractor,
+	// up to MaxAbortedRequestIDs of them
+	AbortedRequests []string
+
+	// OnShutdownRunning is the number of callbacks registered by
+	// RegisterOnShutdown that had not returned by the deadline
+	OnShutdownRunning int
+
+	// HijacksClosed is the number of connections in a registry returned by
+	// HijackRegistry that were done while waited for after the drain, and
+	// HijacksForceClosed the number of them closed at the deadline
+	HijacksClosed      int
+	HijacksForceClosed int
+
+	// Swept is the number of idle connections closed by WithIdleSweep
+	Swept int
+
+	// ExtensionRequested is the time the Shutdowners asked for the deadline
+	// to be extended by, see RequestExtension, and ExtensionGranted the part
+	// of it that was granted
+	ExtensionRequested time.Duration
+	ExtensionGranted   time.Duration
+
+	Deregister PhaseReport
+	Prepare    PhaseReport
+	Drain      PhaseReport
+	Handler    PhaseReport
+	Drainers   []DrainerReport
+	Cleanup    []ComponentReport
+
+	// Remaining is the work left in the Drainers
+	Remaining int
+
+	// LoopsRunning is the number of loops added by Loop
+	// that had not stopped by the deadline
+	LoopsRunning int
+
+	// Phases are the timings of the phases of the shutdown, in the order
+	// they ran, with the cleanup timed one tier at a time. They are also
+	// passed to the event handlers as PhaseEvents as each phase finishes.
+	Phases []PhaseTiming
+
+	// Listeners are the drains of the servers added to a Group, with the
+	// stage they were drained in as their Tier if drained in several,
+	// in the order they finished
+	Listeners []ComponentReport
+
+	// Schedule are the stages set by WithDrainStages that were reached,
+	// in the order they were
+	Schedule []StageReport
+
+	// Finished is when the shutdown finished, just before Run returns,
+	// and Total the time from Signaled until then
+	Finished time.Time
+	Total    time.Duration
+
+	// Err is the error the shutdown returned, a *ShutdownError if it failed
+	Err error
+}
+
+// PhaseReport is the timing and error of one phase of a shutdown
+type PhaseReport struct {
+	Started  time.Time
+	Finished time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// PhaseTiming is the timing of a phase of a shutdown. The cleanup is timed
+// one tier at a time, with Tier set to the tier set by HookTier, or Name to
+// the name of the component if it has no tier.
+type PhaseTiming struct {
+	Phase Phase
+	Tier  *int
+	Name  string
+
+	// Skipped is set, and the timing left zero, if the phase did not run
+	Skipped bool
+
+	PhaseReport
+}
+
+// newPhaseReport returns the report of a phase started at start,
+// that finished now
+func (i *Instance) newPhaseReport(start time.Time, err error) PhaseReport {
+	finished := i.clock().Now()
+
+	return PhaseReport{Started: start, Finished: finished, Duration: finished.Sub(start), Err: err}
+}
+
+// ComponentReport is the time given to, and taken by,
+// one of the Shutdowners in a Registry
+type ComponentReport struct {
+	Name string
+
+	// Tier is the tier set by HookTier, if any
+	Tier *int
+
+	// Skipped is set if the component was not shut down, as one before it
+	// failed with the AbortOnError policy
+	Skipped bool
+
+	Started  time.Time
+	Finished time.Time
+	Timeout  time.Duration
+	Duration time.Duration
+	Err      error
+}
+
+// TimedOut reports whether any part of the shutdown hit its deadline
+func (r *Report) TimedOut() bool {
+	return errors.Is(r.Err, context.DeadlineExceeded)
+}
+
+// Wait is the time from Signaled until the drain started
+func (r *Report) Wait() time.Duration {
+	return r.Started.Sub(r.Signaled)
+}
+
+// MarshalJSON encodes the report with the snake_case keys in the json tags
+// below, durations in milliseconds and times in RFC 3339 format, with nanoseconds
+func (r *Report) MarshalJSON() ([]byte, error) {
+	type phase struct {
+		Started    time.Time `json:"started"`
+		Finished   time.Time `json:"finished"`
+		DurationMS int64     `json:"duration_ms"`
+		Error      string    `json:"error,omitempty"`
+	}
+
+	type component struct {
+		Name       string    `json:"name"`
+		Tier       *int      `json:"tier,omitempty"`
+		Skipped    bool      `json:"skipped,omitempty"`
+		Started    time.Time `json:"started"`
+		Finished   time.Time `json:"finished"`
+		TimeoutMS  int64     `json:"timeout_ms"`
+		DurationMS int64     `json:"duration_ms"`
+		Error      string    `json:"error,omitempty"`
+	}
+
+	type drainer struct {
+		component
+		Remaining int `json:"remaining"`
+	}
+
+	type timing struct {
+		Phase      Phase      `json:"phase"`
+		Tier       *int       `json:"tier,omitempty"`
+		Name       string     `json:"name,omitempty"`
+		Skipped    bool       `json:"skipped,omitempty"`
+		Started    *time.Time `json:"started,omitempty"`
+		Finished   *time.Time `json:"finished,omitempty"`
+		DurationMS *int64     `json:"duration_ms,omitempty"`
+		Error      string     `json:"error,omitempty"`
+	}
+
+	type stage struct {
+		Server  string    `json:"server,omitempty"`
+		Action  string    `json:"action"`
+		AfterMS int64     `json:"after_ms"`
+		At      time.Time `json:"at"`
+	}
+
+	newPhase := func(p PhaseReport) phase {
+		return phase{Started: p.Started, Finished: p.Finished, DurationMS: p.Duration.Milliseconds(), Error: errorString(p.Err)}
+	}
+
+	type reason struct {
+		Reason string `json:"reason"`
+		Detail string `json:"detail,omitempty"`
+	}
+
+	type conns struct {
+		New      int `json:"new"`
+		Active   int `json:"active"`
+		Idle     int `json:"idle"`
+		Hijacked int `json:"hijacked"`
+	}
+
+	v := struct {
+		Signaled    time.Time   `json:"signaled"`
+		Signal      string      `json:"signal,omitempty"`
+		TimeoutMS   int64       `json:"timeout_ms"`
+		Reason      ReasonKind  `json:"reason,omitempty"`
+		Detail      string      `json:"reason_detail,omitempty"`
+		Additional  []reason    `json:"additional_triggers,omitempty"`
+		InFlight    int         `json:"in_flight"`
+		Conns       conns       `json:"conns"`
+		Rejected    int         `json:"rejected"`
+		ForceClosed int         `json:"force_closed"`
+		HijackedCut int         `json:"hijacked_cut"`
+		FCRequests  int         `json:"force_closed_requests"`
+		Aborted     []string    `json:"aborted_requests"`
+		OnShutdown  int         `json:"on_shutdown_running"`
+		Hijacks     int         `json:"hijacks_closed"`
+		HijacksCut  int         `json:"hijacks_force_closed"`
+		Swept       int         `json:"swept"`
+		ExtReqMS    int64       `json:"extension_requested_ms,omitempty"`
+		ExtMS       int64       `json:"extension_granted_ms,omitempty"`
+		WaitMS      int64       `json:"wait_ms"`
+		Deregister  phase       `json:"deregister"`
+		Prepare     phase       `json:"prepare"`
+		Drain       phase       `json:"drain"`
+		Handler     phase       `json:"handler"`
+		Drainers    []drainer   `json:"drainers"`
+		Remaining   int         `json:"remaining"`
+		Loops       int         `json:"loops_running"`
+		Cleanup     []component `json:"cleanup"`
+		Listeners   []component `json:"listeners"`
+		Schedule    []stage     `json:"schedule"`
+		Phases      []timing    `json:"phases"`
+		Finished    time.Time   `json:"finished"`
+		TotalMS     int64       `json:"total_ms"`
+		Error       string      `json:"error,omitempty"`
+	}{
+		Signaled:    r.Signaled,
+		Signal:      r.Signal,
+		TimeoutMS:   r.Timeout.Milliseconds(),
+		Reason:      r.Reason.Kind,
+		Detail:      r.Reason.Detail(),
+		InFlight:    r.InFlight,
+		Conns:       conns(r.Conns),
+		Rejected:    r.Rejected,
+		ForceClosed: r.ForceClosed,
+		HijackedCut: r.HijackedCut,
+		FCRequests:  r.ForceClosedRequests,
+		Aborted:     append([]string{}, r.AbortedRequests...),
+		OnShutdown:  r.OnShutdownRunning,
+		Hijacks:     r.HijacksClosed,
+		HijacksCut:  r.HijacksForceClosed,
+		Swept:       r.Swept,
+		ExtReqMS:    r.ExtensionRequested.Milliseconds(),
+		ExtMS:       r.ExtensionGranted.Milliseconds(),
+		WaitMS:      r.Wait().Milliseconds(),
+		Deregister:  newPhase(r.Deregister),
+		Prepare:     newPhase(r.Prepare),
+		Drain:       newPhase(r.Drain),
+		Handler:     newPhase(r.Handler),
+		Drainers:    []drainer{},
+		Remaining:   r.Remaining,
+		Loops:       r.LoopsRunning,
+		Cleanup:     []component{},
+		Listeners:   []component{},
+		Schedule:    []stage{},
+		Phases:      []timing{},
+		Finished:    r.Finished,
+		TotalMS:     r.Total.Milliseconds(),
+		Error:       errorString(r.Err),
+	}
+
+	newComponent := func(c ComponentReport) component {
+		return component{
+			Name:       c.Name,
+			Tier:       c.Tier,
+			Skipped:    c.Skipped,
+			Started:    c.Started,
+			Finished:   c.Finished,
+			TimeoutMS:  c.Timeout.Milliseconds(),
+			DurationMS: c.Duration.Milliseconds(),
+			Error:      errorString(c.Err),
+		}
+	}
+
+	for _, a := range r.AdditionalTriggers {
+		v.Additional = append(v.Additional, reason{string(a.Kind), a.Detail()})
+	}
+
+	for _, d := range r.Drainers {
+		v.Drainers = append(v.Drainers, drainer{newComponent(d.ComponentReport), d.Remaining})
+	}
+
+	for _, c := range r.Cleanup {
+		v.Cleanup = append(v.Cleanup, newComponent(c))
+	}
+
+	for _, l := range r.Listeners {
+		v.Listeners = append(v.Listeners, newComponent(l))
+	}
+
+	for _, s := range r.Schedule {
+		v.Schedule = append(v.Schedule, stage{Server: s.Server, Action: s.Action.String(), AfterMS: s.After.Milliseconds(), At: s.At})
+	}
+
+	for _, t := range r.Phases {
+		pt := timing{Phase: t.Phase, Tier: t.Tier, Name: t.Name, Skipped: t.Skipped, Error: errorString(t.Err)}
+
+		if !t.Skipped {
+			started, finished, ms := t.Started, t.Finished, t.Duration.Milliseconds()
+			pt.Started, pt.Finished, pt.DurationMS = &started, &finished, &ms
+		}
+
+		v.Phases = append(v.Phases, pt)
+	}
+
+	return json.Marshal(v)
+}
+
+// timePhase adds t to the phases of r, and passes it to the event handlers
+func (i *Instance) timePhase(r *Report, t PhaseTiming) {
+	if t.Skipped {
+		t.PhaseReport = PhaseReport{}
+	}
+
+	r.Phases = append(r.Phases, t)
+
+	i.emit(Event{Kind: PhaseEvent, Phase: t.Phase, Tier: t.Tier, Name: t.Name,
+		Duration: t.Duration, Timing: &t, Err: t.Err})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+var (
+	lastReportMu sync.Mutex
+	lastReport   *Report
+)
+
+// LastReport returns the report of the most recently finished shutdown,
+// or nil if no shutdown has finished
+func LastReport() *Report {
+	lastReportMu.Lock()
+	defer lastReportMu.Unlock()
+
+	return lastReport
+}
+
+// Report returns the report of the shutdown of the Instance by the most
+// recent Run, or nil if it has not finished
+func (i *Instance) Report() *Report {
+	i.reportMu.Lock()
+	defer i.reportMu.Unlock()
+
+	return i.report
+}
+
+func (i *Instance) setReport(r *Report) {
+	i.reportMu.Lock()
+	i.report = r
+	i.reportMu.Unlock()
+
+	lastReportMu.Lock()
+	lastReport = r
+	lastReportMu.Unlock()
+}
+
+// clearReport forgets the report of the previous Run, so that a Run
+// failing before it shuts down has none
+func (i *Instance) clearReport() {
+	i.reportMu.Lock()
+	i.report = nil
+	i.reportMu.Unlock()
+}
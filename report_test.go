@@ -0,0 +1,290 @@
+package graceful
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	clk := newFakeClock()
+
+	advance := func(d time.Duration, err error) func(context.Context) error {
+		return func(context.Context) error {
+			clk.Advance(d)
+			return err
+		}
+	}
+
+	flushErr := errors.New("flush failed")
+
+	r := &Registry{}
+	r.Register("db", shutdownFunc(advance(3*time.Second, nil)))
+
+	i := newInstance(&http.Server{Handler: shutdownFunc(advance(2*time.Second, flushErr))}, nil,
+		WithRegistry(r), WithDeregister(advance(time.Second, nil), 5*time.Second), WithClock(clk))
+
+	if err := i.shutdown(); !errors.Is(err, flushErr) {
+		t.Fatalf("i.shutdown() = %v, want %v", err, flushErr)
+	}
+
+	report := i.Report()
+
+	if got := LastReport(); got != report {
+		t.Fatalf("LastReport() = %p, want %p", got, report)
+	}
+
+	if got, want := report.Wait(), time.Second; got != want {
+		t.Fatalf("report.Wait() = %v, want %v", got, want)
+	}
+
+	if got := report.Handler; got.Duration != 2*time.Second || !errors.Is(got.Err, flushErr) {
+		t.Fatalf("report.Handler = %+v, want 2s and %v", got, flushErr)
+	}
+
+	if got, want := report.Handler.Finished.Sub(report.Signaled), 3*time.Second; got != want {
+		t.Fatalf("handler finished %v after the signal, want %v", got, want)
+	}
+
+	if got, want := report.Total, 6*time.Second; got != want {
+		t.Fatalf("report.Total = %v, want %v", got, want)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"signaled":"2017-06-19T16:35:28Z","timeout_ms":15000,"in_flight":0,"conns":{"new":0,"active":0,"idle":0,"hijacked":0},"rejected":0,"force_closed":0,"hijacked_cut":0,"force_closed_requests":0,"aborted_requests":[],"on_shutdown_running":0,"hijacks_closed":0,"hijacks_force_closed":0,"swept":0,"wait_ms":1000,` +
+		`"deregister":{"started":"2017-06-19T16:35:28Z","finished":"2017-06-19T16:35:29Z","duration_ms":1000},` +
+		`"prepare":{"started":"2017-06-19T16:35:29Z","finished":"2017-06-19T16:35:29Z","duration_ms":0},` +
+		`"drain":{"started":"2017-06-19T16:35:29Z","finished":"2017-06-19T16:35:29Z","duration_ms":0},` +
+		`"handler":{"started":"2017-06-19T16:35:29Z","finished":"2017-06-19T16:35:31Z","duration_ms":2000,"error":"handler shutdown: flush failed"},"drainers":[],"remaining":0,"loops_running":0,` +
+		`"cleanup":[{"name":"db","started":"2017-06-19T16:35:31Z","finished":"2017-06-19T16:35:34Z","timeout_ms":12000,"duration_ms":3000}],"listeners":[],"schedule":[],` +
+		`"phases":[{"phase":"deregister","started":"2017-06-19T16:35:28Z","finished":"2017-06-19T16:35:29Z","duration_ms":1000},{"phase":"drain delay","skipped":true},` +
+		`{"phase":"prepare","skipped":true},{"phase":"drain","started":"2017-06-19T16:35:29Z","finished":"2017-06-19T16:35:29Z","duration_ms":0},` +
+		`{"phase":"handler shutdown","started":"2017-06-19T16:35:29Z","finished":"2017-06-19T16:35:31Z","duration_ms":2000,"error":"handler shutdown: flush failed"},` +
+		`{"phase":"drainers","skipped":true},{"phase":"loops","skipped":true},{"phase":"cleanup","name":"db","started":"2017-06-19T16:35:31Z","finished":"2017-06-19T16:35:34Z","duration_ms":3000}],` +
+		`"finished":"2017-06-19T16:35:34Z","total_ms":6000,"error":"handler shutdown: flush failed"}`
+
+	if got := string(b); got != want {
+		t.Fatalf("json.Marshal(report) =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReportSignal(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	signals <- os.Interrupt
+
+	var reported *Report
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithEventHandler(func(e Event) {
+		if e.Kind == ReportEvent {
+			reported = e.Report
+		}
+	}))
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if reported != i.Report() {
+		t.Fatalf("ReportEvent carried %p, want %p", reported, i.Report())
+	}
+
+	if got, want := reported.Signal, os.Interrupt.String(); got != want {
+		t.Fatalf("reported.Signal = %q, want %q", got, want)
+	}
+
+	if reported.TimedOut() {
+		t.Fatalf("reported.TimedOut() = true, want false")
+	}
+}
+
+func TestReportDropped(t *testing.T) {
+	clk := newFakeClock()
+
+	addrs := make(chan string, 1)
+	started, hijacked, release := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			close(hijacked)
+		}
+	})
+
+	var (
+		events   []EventKind
+		messages []string
+	)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: mux}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+			events = append(events, e.Kind)
+			messages = append(messages, e.String())
+
+			if e.Kind == ListeningEvent {
+				addrs <- e.Addr
+			}
+		}), WithClock(clk))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	go http.Get("http://" + addr + "/block")
+
+	ws, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	fmt.Fprint(ws, "GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	<-started
+	<-hijacked
+
+	i.Shutdown()
+
+	clk.WaitForTimers(1)
+	clk.Advance(Timeout)
+
+	if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("i.Run() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if r := i.Report(); r.ForceClosed != 1 || r.HijackedCut != 1 || r.Rejected != 0 || r.ForceClosedRequests != 1 {
+		t.Fatalf("report = %d force-closed, %d hijacked cut, %d rejected and %d requests force-closed, want 1, 1, 0 and 1",
+			r.ForceClosed, r.HijackedCut, r.Rejected, r.ForceClosedRequests)
+	}
+
+	if got, want := events[len(events)-2], DroppedEvent; got != want {
+		t.Fatalf("events[%d] = %q, want %q", len(events)-2, got, want)
+	}
+
+	if got, want := messages[len(messages)-3], "Force-closed 2 connections (1 hijacked) at the deadline"; got != want {
+		t.Fatalf("messages[%d] = %q, want %q", len(messages)-3, got, want)
+	}
+
+	// The hijacked connection has been closed by the server
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := ws.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("hijacked connection is still open")
+	}
+}
+
+func TestReportPhases(t *testing.T) {
+	closeErr := errors.New("close failed")
+
+	r := &Registry{}
+	r.Register("cache", shutdownFunc(func(context.Context) error { return closeErr }), HookTier(0), HookErrorPolicy(AbortOnError))
+	r.Register("db", shutdownFunc(func(context.Context) error { return nil }), HookTier(1))
+
+	var events []PhaseTiming
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r), WithDrainDelay(10*time.Millisecond), WithEventHandler(func(e Event) {
+		if e.Kind == PhaseEvent {
+			events = append(events, *e.Timing)
+		}
+	}))
+
+	if err := i.shutdown(); !errors.Is(err, closeErr) {
+		t.Fatalf("i.shutdown() = %v, want %v", err, closeErr)
+	}
+
+	phases := i.Report().Phases
+
+	var got []string
+
+	for n, p := range phases {
+		name := string(p.Phase)
+		if p.Tier != nil {
+			name += fmt.Sprintf(" %d", *p.Tier)
+		}
+		if p.Skipped {
+			name += " (skipped)"
+		}
+
+		got = append(got, name)
+
+		if p.Skipped && (!p.Started.IsZero() || p.Duration != 0) {
+			t.Fatalf("phases[%d] = %+v, want no timing once skipped", n, p)
+		}
+
+		if n >= len(events) || events[n].Phase != p.Phase || events[n].Duration != p.Duration {
+			t.Fatalf("the PhaseEvents do not match the phases %+v", phases)
+		}
+	}
+
+	want := []string{"deregister (skipped)", "drain delay", "prepare (skipped)", "drain", "handler shutdown (skipped)",
+		"drainers (skipped)", "loops (skipped)", "cleanup 0", "cleanup 1 (skipped)"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("phases = %q, want %q", got, want)
+	}
+
+	if d := phases[1].Duration; d < 10*time.Millisecond {
+		t.Fatalf("drain delay took %v, want at least %v", d, 10*time.Millisecond)
+	}
+
+	if err := phases[7].Err; !errors.Is(err, closeErr) {
+		t.Fatalf("cleanup of tier 0 failed with %v, want %v", err, closeErr)
+	}
+}
+
+func TestReportTimeout(t *testing.T) {
+	clk := newFakeClock()
+
+	prev := Timeout
+	Timeout = 10 * time.Second
+
+	t.Cleanup(func() { Timeout = prev })
+
+	var logged string
+
+	// Changing Timeout once the shutdown has begun changes nothing
+	i := newInstance(&http.Server{}, nil, WithRegistry(&Registry{}), WithEventHandler(func(e Event) {
+		if e.Kind == ShutdownEvent {
+			logged = e.String()
+			Timeout = time.Millisecond
+		}
+	}), WithClock(clk))
+
+	var left time.Duration
+
+	i.registry().Register("check", shutdownFunc(func(ctx context.Context) error {
+		left, _ = Remaining(ctx)
+		return nil
+	}))
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if got, want := logged, "Server shutdown with timeout: 10s"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	if left != 10*time.Second {
+		t.Fatalf("the deadline was %s away, want 10s", left)
+	}
+
+	if got, want := i.Report().Timeout, 10*time.Second; got != want {
+		t.Fatalf("i.Report().Timeout = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowDrainWarning is the fraction of its timeout after which a drain that
+// is still running logs its slowest requests, see WithSlowRequests
+var SlowDrainWarning = 0.8
+
+// MaxAbortedRequestIDs is the most request IDs kept in the Report of a
+// shutdown, see WithRequestIDExtractor
+var MaxAbortedRequestIDs = 100
+
+// loggedRequestIDs is the most request IDs logged at once,
+// and maxRequestIDLength the longest request ID kept
+const (
+	loggedRequestIDs   = 10
+	maxRequestIDLength = 128
+)
+
+// InFlightRequest is a request that was still being served while draining,
+// with its ID if WithRequestIDExtractor is used
+type InFlightRequest struct {
+	Method string
+	Path   string
+	ID     string
+
+	Started time.Time
+	Elapsed time.Duration
+}
+
+func (r InFlightRequest) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Method, r.Path, r.Elapsed.Round(time.Millisecond))
+}
+
+// WithSlowRequests makes the Instance log the n longest running requests of
+// an *http.Server once its drain has used SlowDrainWarning of its timeout,
+// and again if it is still running at the deadline. Their paths are passed
+// through normalize, if set, so that /users/123 can be logged as /users/:id.
+func WithSlowRequests(n int, normalize func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.slowRequests = n
+		c.normalizePath = normalize
+	}
+}
+
+// WithRequestIDExtractor makes the Instance keep the ID that fn returns for
+// every request served, such as from a header, and report and log the IDs of
+// the requests still running when their connections are force closed at the
+// deadline. fn is called as each request starts, and should be cheap.
+//
+//	graceful.WithRequestIDExtractor(func(r *http.Request) string {
+//		return r.Header.Get("X-Request-Id")
+//	})
+func WithRequestIDExtractor(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.requestID = fn
+	}
+}
+
+// requestTracker keeps the start of every request being served
+type requestTracker struct {
+	normalize func(r *http.Request) string
+	id        func(r *http.Request) string
+	clk       Clock
+
+	mu       sync.Mutex
+	inFlight map[*InFlightRequest]bool
+}
+
+// trackRequests wraps the handler of hs to keep the requests it serves
+// in ct, if WithSlowRequests or WithRequestIDExtractor is used
+func (i *Instance) trackRequests(ct *connTracker, hs *http.Server) {
+	if i.cfg.slowRequests <= 0 && i.cfg.requestID == nil {
+		return
+	}
+
+	rt := &requestTracker{normalize: i.cfg.normalizePath, id: i.cfg.requestID, clk: i.clock(), inFlight: map[*InFlightRequest]bool{}}
+
+	next := hs.Handler
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+
+	hs.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &InFlightRequest{Method: r.Method, Path: r.URL.Path, Started: i.clock().Now()}
+
+		if rt.normalize != nil {
+			req.Path = rt.normalize(r)
+		}
+
+		if rt.id != nil {
+			if req.ID = rt.id(r); len(req.ID) > maxRequestIDLength {
+				req.ID = req.ID[:maxRequestIDLength]
+			}
+		}
+
+		rt.mu.Lock()
+		rt.inFlight[req] = true
+		rt.mu.Unlock()
+
+		defer func() {
+			rt.mu.Lock()
+			delete(rt.inFlight, req)
+			rt.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+
+	ct.requests = rt
+}
+
+// slowest returns the n longest running requests, or all of them if n is
+// negative, the longest first, and how many requests are in flight
+func (rt *requestTracker) slowest(n int) ([]InFlightRequest, int) {
+	if rt == nil {
+		return nil, 0
+	}
+
+	now := rt.clk.Now()
+
+	rt.mu.Lock()
+
+	reqs := make([]InFlightRequest, 0, len(rt.inFlight))
+
+	for req := range rt.inFlight {
+		r := *req
+		r.Elapsed = now.Sub(r.Started)
+		reqs = append(reqs, r)
+	}
+
+	rt.mu.Unlock()
+
+	sort.Slice(reqs, func(a, b int) bool { return reqs[a].Elapsed > reqs[b].Elapsed })
+
+	total := len(reqs)
+
+	if n >= 0 && len(reqs) > n {
+		reqs = reqs[:n]
+	}
+
+	return reqs, total
+}
+
+// identified returns the requests in flight that have an ID,
+// the longest running first
+func (rt *requestTracker) identified() []InFlightRequest {
+	reqs, _ := rt.slowest(-1)
+
+	var identified []InFlightRequest
+
+	for _, r := range reqs {
+		if r.ID != "" {
+			identified = append(identified, r)
+		}
+	}
+
+	return identified
+}
+
+// logSlowRequests emits a SlowRequestsEvent with the slowest requests of m,
+// if any are in flight, its drain having run for elapsed of timeout
+func (i *Instance) logSlowRequests(m *member, elapsed, timeout time.Duration) {
+	if m.conns == nil {
+		return
+	}
+
+	reqs, total := m.conns.requests.slowest(i.cfg.slowRequests)
+	if total == 0 {
+		return
+	}
+
+	i.emit(Event{Kind: SlowRequestsEvent, Phase: DrainPhase, Server: m.name,
+		Timeout: timeout, Duration: elapsed, Count: total, Requests: reqs})
+}
+
+// warnSlowRequests calls logSlowRequests once the drain of m, until ctx is
+// done, has used SlowDrainWarning of its timeout, unless the returned
+// function is called first
+func (i *Instance) warnSlowRequests(ctx context.Context, m *member) func() {
+	timeout, ok := Remaining(ctx)
+
+	if !ok || m.conns == nil || m.conns.requests == nil {
+		return func() {}
+	}
+
+	warnAt := time.Duration(float64(timeout) * SlowDrainWarning)
+
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		t := i.clock().NewTimer(warnAt)
+
+		select {
+		case <-t.C():
+			i.logSlowRequests(m, warnAt, timeout)
+		case <-ctx.Done():
+			t.Stop()
+		case <-done:
+			t.Stop()
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// abortRequests adds the IDs of the requests of m still in flight to those
+// kept for the Report, up to MaxAbortedRequestIDs, and logs them, as the
+// connections of m are about to be force closed
+func (i *Instance) abortRequests(m *member) {
+	if m.conns == nil {
+		return
+	}
+
+	reqs := m.conns.requests.identified()
+	if len(reqs) == 0 {
+		return
+	}
+
+	i.abortedMu.Lock()
+	for _, r := range reqs {
+		if len(i.aborted) < MaxAbortedRequestIDs {
+			i.aborted = append(i.aborted, r.ID)
+		}
+	}
+	i.abortedMu.Unlock()
+
+	i.emit(Event{Kind: AbortedRequestsEvent, Phase: DrainPhase, Server: m.name, Count: len(reqs), Requests: reqs})
+}
+
+// resetAborted forgets the IDs kept by abortRequests,
+// as a new shutdown begins
+func (i *Instance) resetAborted() {
+	i.abortedMu.Lock()
+	i.aborted = nil
+	i.abortedMu.Unlock()
+}
+
+// abortedRequests returns the IDs kept by abortRequests
+func (i *Instance) abortedRequests() []string {
+	i.abortedMu.Lock()
+	defer i.abortedMu.Unlock()
+
+	return append([]string(nil), i.aborted...)
+}
+
+// formatRequestIDs formats the IDs of reqs for a log message,
+// listing at most loggedRequestIDs of them
+func formatRequestIDs(reqs []InFlightRequest) string {
+	var ids []string
+
+	for _, r := range reqs {
+		if len(ids) == loggedRequestIDs {
+			return fmt.Sprintf("%s and %d more", strings.Join(ids, ", "), len(reqs)-loggedRequestIDs)
+		}
+
+		ids = append(ids, r.ID)
+	}
+
+	return strings.Join(ids, ", ")
+}
+
+// formatRequests formats reqs for a log message
+func formatRequests(reqs []InFlightRequest) string {
+	s := make([]string, len(reqs))
+
+	for n, r := range reqs {
+		s[n] = r.String()
+	}
+
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,174 @@
+package graceful
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSlowRequests(t *testing.T) {
+	clk := newFakeClock()
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})}
+
+	events := make(chan Event, 2)
+
+	i := newInstance(hs, nil, WithSlowRequests(2, func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			return "/users/:id"
+		}
+
+		return r.URL.Path
+	}), WithEventHandler(func(e Event) {
+		events <- e
+	}), WithClock(clk))
+
+	ct := &connTracker{}
+	ct.track(hs)
+	i.trackRequests(ct, hs)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	// Three requests, started a second apart
+	for _, path := range []string{"/users/123", "/orders", "/healthz"} {
+		go func(path string) {
+			if resp, err := http.Get("http://" + ln.Addr().String() + path); err == nil {
+				resp.Body.Close()
+			}
+		}(path)
+
+		<-started
+		clk.Advance(time.Second)
+	}
+
+	defer close(release)
+
+	ctx, cancel := withTimeout(context.Background(), clk, 10*time.Second)
+	defer cancel()
+
+	m := &member{name: "api", conns: ct}
+
+	stop := i.warnSlowRequests(ctx, m)
+	defer stop()
+
+	clk.WaitForTimers(2)
+	clk.Advance(8 * time.Second)
+
+	want := "Waiting on 3 in-flight requests after 8s of 10s, the slowest: GET /users/:id (11s), GET /orders (10s)"
+
+	select {
+	case e := <-events:
+		if got := e.String(); got != want || e.Server != "api" {
+			t.Fatalf("e.String() = %q for %q, want %q for %q", got, e.Server, want, "api")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the slowest requests were not logged")
+	}
+
+	clk.Advance(2 * time.Second)
+
+	i.logSlowRequests(m, 10*time.Second, 10*time.Second)
+
+	if got, want := (<-events).String(), "Waiting on 3 in-flight requests after 10s of 10s, the slowest: GET /users/:id (13s), GET /orders (12s)"; got != want {
+		t.Fatalf("e.String() = %q at the deadline, want %q", got, want)
+	}
+}
+
+func TestWithRequestIDExtractor(t *testing.T) {
+	prev := MaxAbortedRequestIDs
+	MaxAbortedRequestIDs = 2
+	defer func() { MaxAbortedRequestIDs = prev }()
+
+	addrs := make(chan string, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	hs := &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})}
+
+	var aborted []Event
+
+	i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"),
+		WithShutdownTimeout(100*time.Millisecond), WithRequestIDExtractor(func(r *http.Request) string {
+			return r.Header.Get("X-Request-Id")
+		}), WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ListeningEvent:
+				addrs <- e.Addr
+			case AbortedRequestsEvent:
+				aborted = append(aborted, e)
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	for _, id := range []string{"req-1", "", strings.Repeat("x", 200), "req-4"} {
+		go func(id string) {
+			req, _ := http.NewRequest("GET", "http://"+addr+"/", nil)
+			req.Header.Set("X-Request-Id", id)
+
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}(id)
+
+		<-started
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err == nil {
+		t.Fatalf("i.Run() = nil, want the drain to time out")
+	}
+
+	if len(aborted) != 1 || aborted[0].Count != 3 {
+		t.Fatalf("aborted = %+v, want one event for 3 requests", aborted)
+	}
+
+	for _, id := range i.Report().AbortedRequests {
+		if id != "req-1" && id != "req-4" && id != strings.Repeat("x", maxRequestIDLength) {
+			t.Fatalf("i.Report().AbortedRequests has %q, want the IDs, truncated", id)
+		}
+	}
+
+	if got, want := len(i.Report().AbortedRequests), 2; got != want {
+		t.Fatalf("len(i.Report().AbortedRequests) = %d, want %d", got, want)
+	}
+}
+
+func TestFormatRequestIDs(t *testing.T) {
+	var reqs []InFlightRequest
+
+	for n := 1; n <= 12; n++ {
+		reqs = append(reqs, InFlightRequest{ID: strconv.Itoa(n)})
+	}
+
+	if got, want := formatRequestIDs(reqs), "1, 2, 3, 4, 5, 6, 7, 8, 9, 10 and 2 more"; got != want {
+		t.Fatalf("formatRequestIDs() = %q, want %q", got, want)
+	}
+
+	if got, want := formatRequestIDs(reqs[:2]), "1, 2"; got != want {
+		t.Fatalf("formatRequestIDs() = %q, want %q", got, want)
+	}
+}
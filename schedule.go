@@ -0,0 +1,189 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DrainAction is what is done to a server at a Stage of the drain
+type DrainAction int
+
+// Actions of the drain schedule set by WithDrainStages
+const (
+	// StopAccepting closes the listeners and shuts the server down, which
+	// also stops keeping alive the connections once their request is done
+	StopAccepting DrainAction = iota + 1
+
+	// FlipReadiness makes HealthHandler answer 503 Service Unavailable
+	FlipReadiness
+
+	// DisableKeepAlives closes connections once their request is done
+	DisableKeepAlives
+
+	// RejectRequests makes Middleware answer new requests with the response
+	// set by WithDrainResponse
+	RejectRequests
+
+	// CancelRequests cancels the contexts of the requests in flight
+	CancelRequests
+
+	// ForceClose closes the connections left, ending the drain
+	ForceClose
+)
+
+var drainActionNames = map[DrainAction]string{
+	StopAccepting:     "stop accepting",
+	FlipReadiness:     "flip readiness",
+	DisableKeepAlives: "disable keep-alives",
+	RejectRequests:    "reject requests",
+	CancelRequests:    "cancel requests",
+	ForceClose:        "force close",
+}
+
+func (a DrainAction) String() string {
+	if name, ok := drainActionNames[a]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Stage is an action of the drain schedule set by WithDrainStages,
+// done once the drain has run for After
+type Stage struct {
+	After  time.Duration
+	Action DrainAction
+}
+
+// StageReport is a Stage of the drain of a server that was reached,
+// and when
+type StageReport struct {
+	Server string
+	Stage
+	At time.Time
+}
+
+// WithDrainStages makes the Instance drain every *http.Server on a schedule,
+// measured from the start of its drain, instead of doing every action as soon
+// as the drain starts. StopAccepting is done at the start unless scheduled,
+// and FlipReadiness and RejectRequests as the shutdown begins. The connections
+// left at the deadline are force closed, as without a schedule, and the
+// stages after it are never reached.
+//
+//	graceful.WithDrainStages(
+//		graceful.Stage{After: 0, Action: graceful.FlipReadiness},
+//		graceful.Stage{After: 5 * time.Second, Action: graceful.RejectRequests},
+//		graceful.Stage{After: 5 * time.Second, Action: graceful.StopAccepting},
+//		graceful.Stage{After: 15 * time.Second, Action: graceful.CancelRequests},
+//		graceful.Stage{After: 20 * time.Second, Action: graceful.ForceClose},
+//	)
+func WithDrainStages(stages ...Stage) Option {
+	return func(c *config) {
+		c.drainStages = append([]Stage(nil), stages...)
+
+		sort.SliceStable(c.drainStages, func(a, b int) bool {
+			return c.drainStages[a].After < c.drainStages[b].After
+		})
+	}
+}
+
+// scheduled reports whether action is a stage set by WithDrainStages
+func (i *Instance) scheduled(action DrainAction) bool {
+	for _, s := range i.cfg.drainStages {
+		if s.Action == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runSchedule does the stages set by WithDrainStages to hs, the server of m,
+// until ctx is done or the returned function is called, closing accepting
+// once the server is to stop accepting connections. cut force closes the
+// connections of hs.
+func (i *Instance) runSchedule(ctx context.Context, m *member, hs *http.Server, cut func()) (accepting <-chan struct{}, stop func()) {
+	accept := make(chan struct{})
+
+	stages := i.cfg.drainStages
+
+	if !i.scheduled(StopAccepting) {
+		stages = append([]Stage{{Action: StopAccepting}}, stages...)
+	}
+
+	start := i.clock().Now()
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		for _, s := range stages {
+			if wait := s.After - i.clock().Now().Sub(start); wait > 0 {
+				t := i.clock().NewTimer(wait)
+
+				select {
+				case <-t.C():
+				case <-ctx.Done():
+					t.Stop()
+					return
+				case <-done:
+					t.Stop()
+					return
+				}
+			}
+
+			switch s.Action {
+			case StopAccepting:
+				close(accept)
+			case FlipReadiness:
+				i.flipReadiness()
+			case DisableKeepAlives:
+				hs.SetKeepAlivesEnabled(false)
+			case RejectRequests:
+				i.startRejecting()
+			case CancelRequests:
+				m.conns.cancelRequests()
+			case ForceClose:
+				cut()
+			}
+
+			i.recordStage(StageReport{Server: m.name, Stage: s, At: i.clock().Now()})
+			i.emit(Event{Kind: DrainStageEvent, Phase: DrainPhase, Server: m.name, Name: s.Action.String(), Duration: s.After})
+		}
+	}()
+
+	var once sync.Once
+
+	return accept, func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// recordStage adds r to the stages kept for the Report
+func (i *Instance) recordStage(r StageReport) {
+	i.scheduleMu.Lock()
+	i.schedule = append(i.schedule, r)
+	i.scheduleMu.Unlock()
+}
+
+// resetSchedule forgets the stages kept by recordStage,
+// as a new shutdown begins
+func (i *Instance) resetSchedule() {
+	i.scheduleMu.Lock()
+	i.schedule = nil
+	i.scheduleMu.Unlock()
+}
+
+// executedSchedule returns the stages kept by recordStage
+func (i *Instance) executedSchedule() []StageReport {
+	i.scheduleMu.Lock()
+	defer i.scheduleMu.Unlock()
+
+	return append([]StageReport(nil), i.schedule...)
+}
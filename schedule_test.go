@@ -0,0 +1,140 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithDrainStages(t *testing.T) {
+	addrs := make(chan string, 1)
+	canceled, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{}, 2)
+
+	mux := http.NewServeMux()
+
+	// Returns once its context is canceled
+	mux.HandleFunc("/cancelable", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	// Keeps running until force closed
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+
+	hs := &http.Server{Addr: "127.0.0.1:0", Handler: mux}
+
+	i := New(hs, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"), WithDrainStages(
+		Stage{After: 30 * time.Millisecond, Action: CancelRequests},
+		Stage{After: 0, Action: FlipReadiness},
+		Stage{After: 60 * time.Millisecond, Action: ForceClose},
+	), WithEventHandler(func(e Event) {
+		if e.Kind == ListeningEvent {
+			addrs <- e.Addr
+		}
+	}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	for _, path := range []string{"/cancelable", "/stuck"} {
+		go func(path string) {
+			if resp, err := http.Get("http://" + addr + path); err == nil {
+				resp.Body.Close()
+			}
+		}(path)
+
+		<-started
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; !errors.Is(err, ErrForceClosed) {
+		t.Fatalf("i.Run() = %v, want %v", err, ErrForceClosed)
+	}
+
+	select {
+	case <-canceled:
+	default:
+		t.Fatalf("the context of the request was not canceled")
+	}
+
+	r := i.Report()
+
+	var actions []DrainAction
+
+	for n, s := range r.Schedule {
+		actions = append(actions, s.Action)
+
+		if s.At.Sub(r.Started) < s.After {
+			t.Fatalf("r.Schedule[%d] = %+v, reached %s after the drain started", n, s, s.At.Sub(r.Started))
+		}
+	}
+
+	want := []DrainAction{StopAccepting, FlipReadiness, CancelRequests, ForceClose}
+
+	if len(actions) != len(want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+
+	for n := range want {
+		if actions[n] != want[n] {
+			t.Fatalf("actions = %v, want %v", actions, want)
+		}
+	}
+
+	if got, want := r.ForceClosed, 1; got != want {
+		t.Fatalf("r.ForceClosed = %d, want %d", got, want)
+	}
+}
+
+func TestWithDrainStagesGates(t *testing.T) {
+	i := newInstance(&http.Server{}, nil, WithDrainStages(
+		Stage{After: time.Second, Action: FlipReadiness},
+		Stage{After: 2 * time.Second, Action: RejectRequests},
+	))
+
+	health := i.HealthHandler()
+	h := i.Middleware(http.NotFoundHandler(), WithDrainResponse(0, 0))
+
+	get := func(h http.Handler) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		return rec.Code
+	}
+
+	i.beginDrain()
+
+	if got, want := get(health), http.StatusOK; got != want {
+		t.Fatalf("health = %d before FlipReadiness, want %d", got, want)
+	}
+
+	if got, want := get(h), http.StatusNotFound; got != want {
+		t.Fatalf("Middleware = %d before RejectRequests, want %d", got, want)
+	}
+
+	i.flipReadiness()
+
+	if got, want := get(health), http.StatusServiceUnavailable; got != want {
+		t.Fatalf("health = %d after FlipReadiness, want %d", got, want)
+	}
+
+	i.startRejecting()
+
+	if got, want := get(h), http.StatusServiceUnavailable; got != want {
+		t.Fatalf("Middleware = %d after RejectRequests, want %d", got, want)
+	}
+}
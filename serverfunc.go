@@ -0,0 +1,66 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrServeReturned is returned by the Server from ServerFunc when its serve
+// function returns cleanly without having been told to shut down
+var ErrServeReturned = errors.New("graceful: serve returned before shutdown")
+
+// ServerFunc returns a Server that serves using serve, and shuts down using
+// shutdown, so that any pair of functions can be run by ListenAndServe, New
+// or a Group.
+//
+// Once shutdown has been called, serve returning nil, http.ErrServerClosed or
+// an error matching one of closedErrs counts as a clean stop. Any other error
+// is handled like an error from *http.Server.ListenAndServe, as is a clean
+// stop before shutdown was called, which returns ErrServeReturned.
+func ServerFunc(serve func() error, shutdown func(ctx context.Context) error, closedErrs ...error) Server {
+	return &funcServer{serve: serve, shutdown: shutdown, closedErrs: closedErrs}
+}
+
+type funcServer struct {
+	serve      func() error
+	shutdown   func(ctx context.Context) error
+	closedErrs []error
+	stopping   atomic.Bool
+}
+
+func (s *funcServer) ListenAndServe() error {
+	err := s.serve()
+
+	if !s.closed(err) {
+		return err
+	}
+
+	if !s.stopping.Load() {
+		return ErrServeReturned
+	}
+
+	return http.ErrServerClosed
+}
+
+func (s *funcServer) Shutdown(ctx context.Context) error {
+	s.stopping.Store(true)
+
+	return s.shutdown(ctx)
+}
+
+// closed reports whether err means that serve stopped cleanly
+func (s *funcServer) closed(err error) bool {
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return true
+	}
+
+	for _, closedErr := range s.closedErrs {
+		if errors.Is(err, closedErr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestServerFunc(t *testing.T) {
+	errStopped := errors.New("responder stopped")
+
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"nil", nil},
+		{"ErrServerClosed", http.ErrServerClosed},
+		{"closed error", errStopped},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			serving, stop := make(chan struct{}), make(chan struct{})
+			stopped := false
+
+			s := ServerFunc(func() error {
+				close(serving)
+				<-stop
+				return tc.err
+			}, func(ctx context.Context) error {
+				stopped = true
+				close(stop)
+				return nil
+			}, errStopped)
+
+			i := New(s)
+
+			go func() {
+				<-serving
+				i.Shutdown()
+			}()
+
+			if err := i.Run(context.Background()); err != nil {
+				t.Fatalf("Run() = %v, want nil", err)
+			}
+
+			if !stopped {
+				t.Fatalf("shutdown was not called")
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		failed := errors.New("bind: permission denied")
+
+		s := ServerFunc(func() error {
+			return failed
+		}, func(ctx context.Context) error {
+			return nil
+		})
+
+		if err := New(s).Run(context.Background()); !errors.Is(err, failed) {
+			t.Fatalf("Run() = %v, want %v", err, failed)
+		}
+	})
+
+	t.Run("returned before shutdown", func(t *testing.T) {
+		s := ServerFunc(func() error {
+			return nil
+		}, func(ctx context.Context) error {
+			return nil
+		})
+
+		if err := New(s).Run(context.Background()); !errors.Is(err, ErrServeReturned) {
+			t.Fatalf("Run() = %v, want %v", err, ErrServeReturned)
+		}
+	})
+}
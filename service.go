@@ -0,0 +1,83 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Service is an *http.Server along with the options it is run with,
+// for configuring both in one place
+//
+//	srv := graceful.NewServer(":8080", handler).
+//		WithTimeout(30 * time.Second).
+//		WithDrainDelay(5 * time.Second)
+//
+//	err := srv.Run(ctx)
+type Service struct {
+	// HTTP is the server, which can be tuned before Run is called
+	HTTP *http.Server
+
+	opts []Option
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewServer returns a Service serving h on addr
+func NewServer(addr string, h http.Handler) *Service {
+	return &Service{HTTP: &http.Server{Addr: addr, Handler: h}}
+}
+
+// With adds options to the Service
+func (s *Service) With(opts ...Option) *Service {
+	s.opts = append(s.opts, opts...)
+
+	return s
+}
+
+// WithTimeout sets the shutdown timeout, see WithShutdownTimeout
+func (s *Service) WithTimeout(d time.Duration) *Service {
+	return s.With(WithShutdownTimeout(d))
+}
+
+// WithLogger sets the logger, see WithLogger
+func (s *Service) WithLogger(l Logger) *Service {
+	return s.With(WithLogger(l))
+}
+
+// WithDrainDelay sets the time to keep serving once told to shut down,
+// see WithDrainDelay
+func (s *Service) WithDrainDelay(d time.Duration) *Service {
+	return s.With(WithDrainDelay(d))
+}
+
+// Run serves HTTP until shut down, see Instance.Run
+func (s *Service) Run(ctx context.Context) error {
+	return s.run(ctx, New(s.HTTP, s.opts...))
+}
+
+// RunTLS serves HTTPS until shut down, see Instance.Run
+func (s *Service) RunTLS(ctx context.Context, certFile, keyFile string) error {
+	return s.run(ctx, NewTLS(s.HTTP, certFile, keyFile, s.opts...))
+}
+
+func (s *Service) run(ctx context.Context, i *Instance) error {
+	err := i.Run(ctx)
+
+	s.mu.Lock()
+	s.report = i.Report()
+	s.mu.Unlock()
+
+	return err
+}
+
+// Report returns the report of the last shutdown of the Service,
+// or nil if it has not shut down
+func (s *Service) Report() *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.report
+}
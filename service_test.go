@@ -0,0 +1,65 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService(t *testing.T) {
+	var buf bytes.Buffer
+
+	addrs := make(chan string, 1)
+
+	srv := NewServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "up")
+	})).WithTimeout(30*time.Second).WithLogger(log.New(&buf, "", 0)).WithDrainDelay(100*time.Millisecond).With(
+		WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}), WithNetwork("tcp4"), WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				addrs <- e.Addr
+			}
+		}))
+
+	srv.HTTP.ReadHeaderTimeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Run(ctx) }()
+
+	addr := <-addrs
+
+	cancel()
+
+	// The server keeps serving during the drain delay
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	resp, err := client.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("GET during the drain delay: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("srv.Run() = %v, want nil", err)
+	}
+
+	if !strings.Contains(buf.String(), "Server shutdown with timeout: 30s") {
+		t.Fatalf("log output does not include the timeout:\n%s", buf.String())
+	}
+
+	r := srv.Report()
+	if r == nil {
+		t.Fatalf("srv.Report() = nil, want the report of the shutdown")
+	}
+
+	if r.Wait() < 100*time.Millisecond {
+		t.Fatalf("r.Wait() = %s, want at least the drain delay", r.Wait())
+	}
+}
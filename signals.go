@@ -0,0 +1,97 @@
+package graceful
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalSource relays signals to an Instance, see WithSignalSource
+type SignalSource interface {
+	// Notify returns a channel that sigs are relayed to, until stop is called
+	Notify(sigs ...os.Signal) (ch <-chan os.Signal, stop func())
+}
+
+// osSignals relays the signals received by the process, using os/signal
+type osSignals struct{}
+
+func (osSignals) Notify(sigs ...os.Signal) (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	return ch, func() { signal.Stop(ch) }
+}
+
+// signalSource returns the source set by WithSignalSource, or os/signal
+func (i *Instance) signalSource() SignalSource {
+	if i.cfg.signalSource != nil {
+		return i.cfg.signalSource
+	}
+
+	return osSignals{}
+}
+
+// ContainerSignals are the shutdown signals for running in a container,
+// where only the orchestrator is meant to stop the process: syscall.SIGTERM,
+// so that an os.Interrupt from a debugging session does not drain it
+func ContainerSignals() []os.Signal {
+	return []os.Signal{syscall.SIGTERM}
+}
+
+// DevSignals are the shutdown signals used by default: os.Interrupt,
+// so that Ctrl+C works during development, and syscall.SIGTERM. On Windows,
+// where there is no SIGBREAK, a console Ctrl+Break is received as
+// os.Interrupt too, and drains like Ctrl+C.
+func DevSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
+
+// ignoreSignals emits an IgnoredSignalEvent for each of DevSignals not
+// among the shutdown signals, instead of letting it end the process,
+// until the returned function is called
+func (i *Instance) ignoreSignals(shutdown []os.Signal) func() {
+	var ignored []os.Signal
+
+	for _, sig := range DevSignals() {
+		if !containsSignal(shutdown, sig) {
+			ignored = append(ignored, sig)
+		}
+	}
+
+	if len(ignored) == 0 {
+		return func() {}
+	}
+
+	ch, stop := i.signalSource().Notify(ignored...)
+
+	done, exited := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		for {
+			select {
+			case sig := <-ch:
+				i.emit(Event{Kind: IgnoredSignalEvent, Source: sig.String()})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		stop()
+		close(done)
+		<-exited
+	}
+}
+
+func containsSignal(sigs []os.Signal, sig os.Signal) bool {
+	for _, s := range sigs {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/TV4/graceful/internal/signaltest"
+)
+
+func TestDevSignals(t *testing.T) {
+	// Ctrl+C, and Ctrl+Break on Windows, are received as os.Interrupt
+	for _, sig := range []os.Signal{os.Interrupt, syscall.SIGTERM} {
+		if !containsSignal(DevSignals(), sig) {
+			t.Fatalf("DevSignals() = %v, want it to include %v", DevSignals(), sig)
+		}
+	}
+
+	if got, want := (Reason{Kind: SignalReason, Signal: os.Interrupt}).String(), "signal interrupt"; got != want {
+		t.Fatalf("Reason.String() = %q, want %q", got, want)
+	}
+}
+
+func TestWithStackDumpSignal(t *testing.T) {
+	sigs := signaltest.New()
+	events := make(chan Event, 32)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignalSource(sigs), WithRegistry(&Registry{}),
+		WithStackDumpSignal(syscall.SIGQUIT), WithEventHandler(func(e Event) {
+			events <- e
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	for n := 0; n < 2; n++ {
+		sigs.Send(syscall.SIGQUIT)
+
+		if e := awaitEvent(t, events, StackDumpEvent); !strings.Contains(e.Stacks, "goroutine ") {
+			t.Fatalf("e.Stacks = %q, want the goroutine stacks", e.Stacks)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		t.Fatalf("i.Run() = %v after SIGQUIT, want it to keep serving", err)
+	default:
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+}
+
+func TestWithShutdownSignals(t *testing.T) {
+	sigs := signaltest.New()
+	events := make(chan Event, 32)
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithRegistry(&Registry{}), WithSignalSource(sigs),
+		WithShutdownSignals(ContainerSignals()...), WithEventHandler(func(e Event) {
+			events <- e
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	sigs.Send(os.Interrupt)
+
+	if got, want := awaitEvent(t, events, IgnoredSignalEvent).String(), "Ignored signal interrupt, it is not a shutdown signal"; got != want {
+		t.Fatalf("e.String() = %q, want %q", got, want)
+	}
+
+	if i.shuttingDown() {
+		t.Fatalf("the Instance began shutting down on an ignored signal")
+	}
+
+	sigs.Send(syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the Instance did not shut down on SIGTERM")
+	}
+
+	if got, want := i.Report().Signal, syscall.SIGTERM.String(); got != want {
+		t.Fatalf("i.Report().Signal = %q, want %q", got, want)
+	}
+}
+
+func TestWithSignalSource(t *testing.T) {
+	sigs := signaltest.New()
+
+	// The source replaces the channel set by WithSignals
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithSignalSource(sigs))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	sigs.Send(os.Interrupt)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := i.Report().Signal, os.Interrupt.String(); got != want {
+		t.Fatalf("i.Report().Signal = %q, want %q", got, want)
+	}
+}
+
+// awaitEvent returns the next event of kind received on events
+func awaitEvent(t *testing.T, events <-chan Event, kind EventKind) Event {
+	t.Helper()
+
+	for {
+		select {
+		case e := <-events:
+			if e.Kind == kind {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", kind)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+//go:build go1.21
+
+package graceful
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogValue returns the log message of the event, as msg, and the fields
+// passed to a KeyValueLogger as a group, along with the name, source,
+// shutdowner, path, restart, skipped components and slow requests, if set, the report
+// carried by a ReportEvent and whether the phase of a PhaseEvent was skipped
+//
+//	logger.Info("graceful", "event", e)
+func (e Event) LogValue() slog.Value {
+	kvs := e.keysAndValues()
+
+	attrs := []slog.Attr{slog.String("msg", e.String())}
+
+	for n := 0; n+1 < len(kvs); n += 2 {
+		attrs = append(attrs, slog.Any(kvs[n].(string), kvs[n+1]))
+	}
+
+	for _, kv := range []struct {
+		key   string
+		value string
+	}{
+		{"name", e.Name},
+		{"source", e.Source},
+		{"shutdowner", e.Shutdowner},
+		{"path", e.Path},
+	} {
+		if kv.value != "" {
+			attrs = append(attrs, slog.String(kv.key, kv.value))
+		}
+	}
+
+	if e.Restart != 0 {
+		attrs = append(attrs, slog.Int("restart", e.Restart))
+	}
+
+	if len(e.Skipped) > 0 {
+		attrs = append(attrs, slog.String("skipped", strings.Join(e.Skipped, ",")))
+	}
+
+	if len(e.Requests) > 0 {
+		attrs = append(attrs, slog.String("requests", formatRequests(e.Requests)))
+	}
+
+	if e.Kind == PhaseEvent && e.Timing != nil && e.Timing.Skipped {
+		attrs = append(attrs, slog.Bool("skipped", true))
+	}
+
+	if e.Kind == ReportEvent && e.Report != nil {
+		attrs = append(attrs, slog.Any("report", e.Report))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue returns the fields of the report as a group, with the
+// connections when the drain started and the phases as groups of their own
+func (r *Report) LogValue() slog.Value {
+	var attrs []slog.Attr
+
+	if r.Signal != "" {
+		attrs = append(attrs, slog.String("signal", r.Signal))
+	}
+
+	if r.Reason.Kind != "" {
+		attrs = append(attrs, slog.String("reason", string(r.Reason.Kind)))
+	}
+
+	if d := r.Reason.Detail(); d != "" {
+		attrs = append(attrs, slog.String("reason_detail", d))
+	}
+
+	if len(r.AdditionalTriggers) > 0 {
+		additional := make([]string, len(r.AdditionalTriggers))
+
+		for n, a := range r.AdditionalTriggers {
+			additional[n] = a.String()
+		}
+
+		attrs = append(attrs, slog.String("additional_triggers", strings.Join(additional, ",")))
+	}
+
+	attrs = append(attrs,
+		slog.Duration("timeout", r.Timeout),
+		slog.Int("in_flight", r.InFlight),
+		slog.Group("conns",
+			slog.Int("new", r.Conns.New),
+			slog.Int("active", r.Conns.Active),
+			slog.Int("idle", r.Conns.Idle),
+			slog.Int("hijacked", r.Conns.Hijacked)),
+		slog.Int("rejected", r.Rejected),
+		slog.Int("force_closed", r.ForceClosed),
+		slog.Int("hijacked_cut", r.HijackedCut),
+		slog.Int("force_closed_requests", r.ForceClosedRequests),
+		slog.Int("remaining", r.Remaining),
+		slog.Int("loops_running", r.LoopsRunning),
+		slog.Duration("wait", r.Wait()),
+		slog.Duration("total", r.Total),
+	)
+
+	if len(r.AbortedRequests) > 0 {
+		attrs = append(attrs, slog.String("aborted_requests", strings.Join(r.AbortedRequests, ",")))
+	}
+
+	var phases []any
+
+	for _, t := range r.Phases {
+		key := strings.ReplaceAll(string(t.Phase), " ", "_")
+
+		switch {
+		case t.Tier != nil:
+			key += fmt.Sprintf("_tier_%d", *t.Tier)
+		case t.Name != "":
+			key += "_" + t.Name
+		}
+
+		if t.Skipped {
+			phases = append(phases, slog.Group(key, slog.Bool("skipped", true)))
+			continue
+		}
+
+		phase := []any{slog.Duration("duration", t.Duration)}
+		if t.Err != nil {
+			phase = append(phase, slog.Any("err", t.Err))
+		}
+
+		phases = append(phases, slog.Group(key, phase...))
+	}
+
+	if len(phases) > 0 {
+		attrs = append(attrs, slog.Group("phases", phases...))
+	}
+
+	if r.Err != nil {
+		attrs = append(attrs, slog.Any("err", r.Err))
+	}
+
+	return slog.GroupValue(attrs...)
+}
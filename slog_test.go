@@ -0,0 +1,111 @@
+//go:build go1.21
+
+package graceful
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventLogValue(t *testing.T) {
+	tier := 1
+	err := errors.New("boom")
+
+	for _, tc := range []struct {
+		e    Event
+		want string
+	}{
+		{Event{Kind: ListeningEvent, Server: "api", Addr: "127.0.0.1:8080"},
+			`event.msg="Listening on http://127.0.0.1:8080" event.event=listening event.server=api event.addr=127.0.0.1:8080`},
+		{Event{Kind: ShutdownEvent, Phase: DrainPhase, Timeout: 15 * time.Second},
+			`event.msg="Server shutdown with timeout: 15s" event.event=shutdown event.phase=drain event.timeout=15s`},
+		{Event{Kind: FinishedHTTPEvent, Phase: DrainPhase, Server: "api"},
+			`event.msg="Finished all in-flight HTTP requests" event.event=finished_http event.phase=drain event.server=api`},
+		{Event{Kind: HandlerShutdownEvent, Phase: HandlerPhase, Remaining: 10 * time.Second},
+			`event.msg="Shutting down handler with timeout: 10s" event.event=handler_shutdown event.phase="handler shutdown" event.remaining=10s`},
+		{Event{Kind: AbandonedEvent, Phase: CleanupPhase, Shutdowner: "*sql.DB"},
+			`event.msg="Abandoned *sql.DB that did not return before deadline" event.event=abandoned event.phase=cleanup event.shutdowner=*sql.DB`},
+		{Event{Kind: ErrorEvent, Phase: DrainPhase, Server: "api", Err: err},
+			`event.msg="Error: boom" event.event=error event.phase=drain event.server=api event.err=boom`},
+		{Event{Kind: FinishedEvent, Remaining: 5 * time.Second},
+			`event.msg="Shutdown finished 5s before deadline" event.event=finished event.remaining=5s`},
+		{Event{Kind: DeregisteredEvent, Phase: DeregisterPhase, Duration: time.Second},
+			`event.msg="Deregistered in 1s" event.event=deregistered event.phase=deregister event.duration=1s`},
+		{Event{Kind: ReloadedEvent, Path: "cert.pem"},
+			`event.msg="Reloaded TLS certificate cert.pem" event.event=reloaded event.path=cert.pem`},
+		{Event{Kind: AddrEvent, Addr: ":8080", Source: "PORT"},
+			`event.msg="Using address :8080 from PORT" event.event=addr event.addr=:8080 event.source=PORT`},
+		{Event{Kind: ComponentEvent, Phase: CleanupPhase, Name: "db", Tier: &tier, Timeout: 2 * time.Second, Duration: time.Second},
+			`event.msg="Shut down db (tier 1) in 1s of 2s" event.event=component event.phase=cleanup event.timeout=2s event.duration=1s event.tier=1 event.name=db`},
+		{Event{Kind: RestartEvent, Duration: time.Second, Restart: 2, Err: err},
+			`event.msg="Restarting server in 1s (restart 2) after error: boom" event.event=restart event.duration=1s event.err=boom event.restart=2`},
+		{Event{Kind: ClampedEvent, Phase: DrainPhase, Timeout: 10 * time.Second, Duration: 15 * time.Second},
+			`event.msg="Warning: Clamped shutdown timeout 15s to 10s" event.event=clamped event.phase=drain event.timeout=10s event.duration=15s`},
+		{Event{Kind: WarmedUpEvent, Duration: time.Second},
+			`event.msg="Warmed up in 1s" event.event=warmed_up event.duration=1s`},
+		{Event{Kind: SkippedDrainEvent, Phase: DrainPhase},
+			`event.msg="Shutdown before listening, skipping the drain" event.event=skipped_drain event.phase=drain`},
+		{Event{Kind: HardDeadlineEvent, Timeout: 20 * time.Second, Duration: 21 * time.Second},
+			`event.msg="Hard deadline of 20s exceeded after 21s, exiting" event.event=hard_deadline event.timeout=20s event.duration=21s`},
+		{Event{Kind: EscalatedEvent, Remaining: time.Second},
+			`event.msg="Received another signal, shutdown deadline in 1s" event.event=escalated event.remaining=1s`},
+		{Event{Kind: DroppedEvent, Report: &Report{Rejected: 1, ForceClosed: 2, HijackedCut: 3}},
+			`event.msg="Rejected 1 requests, force-closed 2 connections and cut 3 hijacked connections" event.event=dropped`},
+		{Event{Kind: DrainedEvent, Phase: DrainPhase, Server: "api", Timeout: 2 * time.Second, Duration: time.Second},
+			`event.msg="Drained api in 1s of 2s" event.event=drained event.phase=drain event.server=api event.timeout=2s event.duration=1s`},
+		{Event{Kind: StackDumpEvent, Stacks: "goroutine 1"},
+			`event.msg="Goroutine stacks:\ngoroutine 1" event.event=stack_dump`},
+		{Event{Kind: OnShutdownEvent, Phase: DrainPhase, Server: "api", Count: 2},
+			`event.msg="Abandoned 2 RegisterOnShutdown callbacks that did not return before deadline" event.event=on_shutdown event.phase=drain event.server=api event.count=2`},
+		{Event{Kind: HijacksEvent, Phase: DrainPhase, Report: &Report{HijacksClosed: 1, HijacksForceClosed: 2}},
+			`event.msg="Closed 1 hijacked connections, force-closed 2 at the deadline" event.event=hijacks event.phase=drain`},
+		{Event{Kind: SweptEvent, Phase: DrainPhase, Server: "api", Count: 3},
+			`event.msg="Closed 3 idle connections" event.event=swept event.phase=drain event.server=api event.count=3`},
+		{Event{Kind: DrainerEvent, Phase: DrainersPhase, Name: "jobs", Timeout: 2 * time.Second, Duration: time.Second, Count: 4},
+			`event.msg="Drained jobs in 1s of 2s, 4 remaining" event.event=drainer event.phase=drainers event.timeout=2s event.duration=1s event.count=4 event.name=jobs`},
+		{Event{Kind: AbortedEvent, Phase: CleanupPhase, Name: "db", Skipped: []string{"cache"}},
+			`event.msg="Aborting the cleanup after db failed, skipping cache" event.event=aborted event.phase=cleanup event.name=db event.skipped=cache`},
+		{Event{Kind: CleanupFailedEvent, Phase: CleanupPhase, Report: &Report{Cleanup: []ComponentReport{{Name: "db", Err: err}}}},
+			`event.msg="1 of 1 cleanup steps failed: db" event.event=cleanup_failed event.phase=cleanup`},
+		{Event{Kind: VetoedEvent, Source: "terminated"},
+			`event.msg="Shutdown on terminated vetoed, continuing to serve" event.event=vetoed event.source=terminated`},
+		{Event{Kind: ProcessEvent, Phase: CleanupPhase, Name: "ffmpeg (pid 12)", Source: "SIGTERM", Duration: time.Second},
+			`event.msg="Stopped ffmpeg (pid 12) with SIGTERM in 1s" event.event=process event.phase=cleanup event.duration=1s event.name="ffmpeg (pid 12)" event.source=SIGTERM`},
+		{Event{Kind: LoopsEvent, Phase: LoopsPhase, Count: 1},
+			`event.msg="Abandoned 1 loops that did not stop before deadline" event.event=loops event.phase=loops event.count=1`},
+		{Event{Kind: PhaseEvent, Phase: DelayPhase, Timing: &PhaseTiming{Phase: DelayPhase, Skipped: true}},
+			`event.msg=phase event.event=phase event.phase="drain delay" event.skipped=true`},
+		{Event{Kind: PhaseEvent, Phase: CleanupPhase, Tier: &tier, Duration: time.Second, Timing: &PhaseTiming{Phase: CleanupPhase, Tier: &tier}},
+			`event.msg=phase event.event=phase event.phase=cleanup event.duration=1s event.tier=1`},
+		{Event{Kind: ReportEvent, Report: &Report{Signal: "terminated", InFlight: 2, Conns: ConnStates{Active: 2, Idle: 1}, Total: time.Second,
+			Phases: []PhaseTiming{{Phase: DelayPhase, Skipped: true}, {Phase: HandlerPhase, PhaseReport: PhaseReport{Duration: time.Second, Err: err}},
+				{Phase: CleanupPhase, Name: "db", PhaseReport: PhaseReport{Duration: time.Second}}}, Err: err}, Err: err},
+			`event.msg=report event.event=report event.err=boom event.report.signal=terminated event.report.timeout=0s event.report.in_flight=2 event.report.conns.new=0 event.report.conns.active=2 event.report.conns.idle=1 event.report.conns.hijacked=0 event.report.rejected=0 event.report.force_closed=0 event.report.hijacked_cut=0 event.report.force_closed_requests=0 event.report.remaining=0 event.report.loops_running=0 event.report.wait=0s event.report.total=1s event.report.phases.drain_delay.skipped=true event.report.phases.handler_shutdown.duration=1s event.report.phases.handler_shutdown.err=boom event.report.phases.cleanup_db.duration=1s event.report.err=boom`},
+	} {
+		tc := tc
+
+		t.Run(string(tc.e.Kind), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+						return slog.Attr{}
+					}
+
+					return a
+				},
+			}))
+
+			logger.Info("graceful", "event", tc.e)
+
+			if got := strings.TrimSpace(buf.String()); got != tc.want {
+				t.Fatalf("rendered\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
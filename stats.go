@@ -0,0 +1,131 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Stats describe a shutdown in progress, as passed to a StatsShutdowner
+// and carried by the events emitted while shutting down
+type Stats struct {
+	// Phase is the phase the shutdown is in, and Remaining the time left
+	// until its deadline
+	Phase     Phase
+	Remaining time.Duration
+
+	// Signal is the name of the signal that triggered the shutdown,
+	// or empty if it was not triggered by one
+	Signal string
+
+	// InFlight and Conns are the numbers of connections with a request in
+	// progress, and in each state, when the drain started
+	InFlight int
+	Conns    ConnStates
+
+	// Drained is set once the drain has finished, with DrainErr its error
+	Drained  bool
+	DrainErr error
+}
+
+// TimedOut reports whether the drain hit its deadline
+func (st Stats) TimedOut() bool {
+	return errors.Is(st.DrainErr, context.DeadlineExceeded)
+}
+
+// Stats returns the stats of the shutdown as it finished
+func (r *Report) Stats() Stats {
+	return Stats{
+		Signal:   r.Signal,
+		InFlight: r.InFlight,
+		Conns:    r.Conns,
+		Drained:  true,
+		DrainErr: r.Drain.Err,
+	}
+}
+
+// StatsShutdowner adapts a function taking the Stats of the shutdown
+// to the Shutdowner interface
+//
+//	graceful.Register("audit", graceful.StatsShutdowner(func(ctx context.Context, st graceful.Stats) error {
+//		return audit.Flush(ctx, st.InFlight, st.TimedOut())
+//	}))
+type StatsShutdowner func(ctx context.Context, st Stats) error
+
+// Shutdown calls f with the Stats of the shutdown, see StatsFromContext
+func (f StatsShutdowner) Shutdown(ctx context.Context) error {
+	st, _ := StatsFromContext(ctx)
+
+	return f(ctx, st)
+}
+
+// statsContextKey is the context key of the Instance whose Stats
+// are returned by StatsFromContext
+var statsContextKey = &contextKey{"stats"}
+
+// StatsFromContext returns the Stats of the shutdown that a Shutdowner
+// was called by. The bool is false if ctx is not from a shutdown.
+func StatsFromContext(ctx context.Context) (Stats, bool) {
+	i, ok := ctx.Value(statsContextKey).(*Instance)
+	if !ok {
+		return Stats{}, false
+	}
+
+	return i.stats.snapshot()
+}
+
+// shutdownStats are the Stats of the shutdown in progress, if active
+type shutdownStats struct {
+	mu     sync.Mutex
+	st     Stats
+	ctx    context.Context
+	active bool
+}
+
+// begin makes the stats active, with the time remaining until
+// the deadline of ctx
+func (ss *shutdownStats) begin(ctx context.Context, signal string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.st = Stats{Signal: signal}
+	ss.ctx = ctx
+	ss.active = true
+}
+
+// update calls fn with the stats, if active
+func (ss *shutdownStats) update(fn func(st *Stats)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.active {
+		fn(&ss.st)
+	}
+}
+
+// end makes the stats inactive, once the shutdown has finished
+func (ss *shutdownStats) end() {
+	ss.mu.Lock()
+	ss.active = false
+	ss.mu.Unlock()
+}
+
+func (ss *shutdownStats) snapshot() (Stats, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if !ss.active {
+		return Stats{}, false
+	}
+
+	st := ss.st
+	st.Remaining, _ = Remaining(ss.ctx)
+
+	return st, true
+}
+
+// enterPhase records that the shutdown has entered phase
+func (i *Instance) enterPhase(phase Phase) {
+	i.stats.update(func(st *Stats) { st.Phase = phase })
+}
@@ -0,0 +1,67 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestStatsShutdowner(t *testing.T) {
+	var got Stats
+
+	r := &Registry{}
+
+	r.Register("audit", StatsShutdowner(func(ctx context.Context, st Stats) error {
+		got = st
+		return nil
+	}))
+
+	var component *Stats
+
+	i := newInstance(&http.Server{}, nil, WithRegistry(r), WithEventHandler(func(e Event) {
+		if e.Kind == ComponentEvent {
+			component = e.Stats
+		}
+	}))
+
+	i.signal = testSignal("terminated")
+
+	if err := i.shutdown(); err != nil {
+		t.Fatalf("i.shutdown() = %v, want nil", err)
+	}
+
+	if got.Phase != CleanupPhase || got.Remaining <= 0 || got.Signal != "terminated" || !got.Drained || got.TimedOut() {
+		t.Fatalf("Stats = %+v, want those of a drained shutdown cleaning up", got)
+	}
+
+	if component == nil || component.Phase != CleanupPhase {
+		t.Fatalf("the %q event had Stats %+v, want those of the cleanup", ComponentEvent, component)
+	}
+
+	if st := i.Report().Stats(); st.Signal != "terminated" || !st.Drained {
+		t.Fatalf("i.Report().Stats() = %+v, want the Stats of the finished shutdown", st)
+	}
+
+	if _, ok := StatsFromContext(context.Background()); ok {
+		t.Fatalf("StatsFromContext() = _, true, want false outside of a shutdown")
+	}
+}
+
+func TestStatsTimedOut(t *testing.T) {
+	st := Stats{DrainErr: phaseError(DrainPhase, "", context.DeadlineExceeded)}
+
+	if !st.TimedOut() {
+		t.Fatalf("st.TimedOut() = false, want true")
+	}
+
+	if st := (Stats{DrainErr: errors.New("failed")}); st.TimedOut() {
+		t.Fatalf("st.TimedOut() = true, want false")
+	}
+}
+
+type testSignal string
+
+func (s testSignal) String() string { return string(s) }
+
+func (s testSignal) Signal() {}
@@ -0,0 +1,5 @@
+module github.com/TV4/graceful/statsd
+
+go 1.20
+
+require github.com/TV4/graceful v0.1.0
@@ -0,0 +1,137 @@
+// Package statsd sends metrics about graceful shutdowns to a statsd,
+// or dogstatsd, server over UDP.
+//
+//	sink, err := statsd.New("127.0.0.1:8125")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer sink.Close()
+//
+//	graceful.New(hs, graceful.WithEventHandler(sink.Handle)).Run(ctx)
+//
+// Every shutdown sends the timer graceful.shutdown.duration, the gauges
+// graceful.inflight_at_drain and graceful.conns_at_drain, tagged with the
+// state of the connections, the counters graceful.shutdown.rejected,
+// graceful.shutdown.force_closed, graceful.shutdown.hijacked_cut and
+// graceful.shutdown.force_closed_requests, zero on a clean shutdown, and, if
+// it hit its deadline, the counter graceful.shutdown.timeout_exceeded, tagged
+// with the signal that triggered it. Each phase of the shutdown sends the
+// timer graceful.phase.duration, or the counter graceful.phase.skipped if it
+// did not run, tagged with the phase, such as phase:drain_delay, and the tier,
+// or component, of each cleanup tier.
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	graceful "github.com/TV4/graceful"
+)
+
+// WriteTimeout limits the time spent sending a packet
+var WriteTimeout = 100 * time.Millisecond
+
+// Sink sends metrics about shutdowns to a statsd server
+type Sink struct {
+	conn net.Conn
+	tags []string
+}
+
+// Option configures a Sink
+type Option func(*Sink)
+
+// WithTags adds tags, such as "service:api", to every metric
+// sent by the Sink, using the dogstatsd tag format
+func WithTags(tags ...string) Option {
+	return func(s *Sink) {
+		s.tags = append(s.tags, tags...)
+	}
+}
+
+// New returns a Sink sending metrics to the statsd server at addr
+func New(addr string, opts ...Option) (*Sink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sink{conn: conn}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// Handle sends the metrics of the shutdown reported by e, pass it to
+// graceful.WithEventHandler. Failing to send them never affects the shutdown.
+func (s *Sink) Handle(e graceful.Event) {
+	if e.Kind != graceful.ReportEvent || e.Report == nil {
+		return
+	}
+
+	r := e.Report
+
+	tags := s.tags
+	if r.Signal != "" {
+		tags = append(tags[:len(tags):len(tags)], "signal:"+r.Signal)
+	}
+
+	lines := []string{
+		metric("graceful.shutdown.duration", r.Total.Milliseconds(), "ms", tags),
+		metric("graceful.inflight_at_drain", int64(r.InFlight), "g", tags),
+		metric("graceful.conns_at_drain", int64(r.Conns.New), "g", append(tags[:len(tags):len(tags)], "state:new")),
+		metric("graceful.conns_at_drain", int64(r.Conns.Active), "g", append(tags[:len(tags):len(tags)], "state:active")),
+		metric("graceful.conns_at_drain", int64(r.Conns.Idle), "g", append(tags[:len(tags):len(tags)], "state:idle")),
+		metric("graceful.conns_at_drain", int64(r.Conns.Hijacked), "g", append(tags[:len(tags):len(tags)], "state:hijacked")),
+		metric("graceful.shutdown.rejected", int64(r.Rejected), "c", tags),
+		metric("graceful.shutdown.force_closed", int64(r.ForceClosed), "c", tags),
+		metric("graceful.shutdown.hijacked_cut", int64(r.HijackedCut), "c", tags),
+		metric("graceful.shutdown.force_closed_requests", int64(r.ForceClosedRequests), "c", tags),
+	}
+
+	if r.TimedOut() {
+		lines = append(lines, metric("graceful.shutdown.timeout_exceeded", 1, "c", tags))
+	}
+
+	for _, p := range r.Phases {
+		phaseTags := append(tags[:len(tags):len(tags)], "phase:"+strings.ReplaceAll(string(p.Phase), " ", "_"))
+
+		switch {
+		case p.Tier != nil:
+			phaseTags = append(phaseTags, fmt.Sprintf("tier:%d", *p.Tier))
+		case p.Name != "":
+			phaseTags = append(phaseTags, "component:"+p.Name)
+		}
+
+		if p.Skipped {
+			lines = append(lines, metric("graceful.phase.skipped", 1, "c", phaseTags))
+			continue
+		}
+
+		lines = append(lines, metric("graceful.phase.duration", p.Duration.Milliseconds(), "ms", phaseTags))
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	s.conn.Write([]byte(strings.Join(lines, "\n")))
+}
+
+// Close closes the connection to the statsd server
+func (s *Sink) Close() error {
+	return s.conn.Close()
+}
+
+// metric formats a metric in the statsd line format,
+// with tags in the dogstatsd format
+func metric(name string, value int64, typ string, tags []string) string {
+	line := fmt.Sprintf("%s:%d|%s", name, value, typ)
+
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
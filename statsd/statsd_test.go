@@ -0,0 +1,96 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	graceful "github.com/TV4/graceful"
+)
+
+func TestSinkHandle(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := New(pc.LocalAddr().String(), WithTags("service:api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.Handle(graceful.Event{Kind: graceful.ShutdownEvent})
+
+	tier := 1
+
+	sink.Handle(graceful.Event{Kind: graceful.ReportEvent, Report: &graceful.Report{
+		Signal:   "terminated",
+		InFlight: 3,
+		Conns:    graceful.ConnStates{Active: 3, Idle: 1},
+		Rejected: 2,
+		Total:    1500 * time.Millisecond,
+		Err:      context.DeadlineExceeded,
+		Phases: []graceful.PhaseTiming{
+			{Phase: graceful.DelayPhase, Skipped: true},
+			{Phase: graceful.DrainPhase, PhaseReport: graceful.PhaseReport{Duration: 1200 * time.Millisecond}},
+			{Phase: graceful.CleanupPhase, Tier: &tier, PhaseReport: graceful.PhaseReport{Duration: 250 * time.Millisecond}},
+			{Phase: graceful.CleanupPhase, Name: "db", PhaseReport: graceful.PhaseReport{Duration: 50 * time.Millisecond}},
+		},
+	}})
+
+	buf := make([]byte, 2048)
+
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"graceful.shutdown.duration:1500|ms|#service:api,signal:terminated",
+		"graceful.inflight_at_drain:3|g|#service:api,signal:terminated",
+		"graceful.conns_at_drain:0|g|#service:api,signal:terminated,state:new",
+		"graceful.conns_at_drain:3|g|#service:api,signal:terminated,state:active",
+		"graceful.conns_at_drain:1|g|#service:api,signal:terminated,state:idle",
+		"graceful.conns_at_drain:0|g|#service:api,signal:terminated,state:hijacked",
+		"graceful.shutdown.rejected:2|c|#service:api,signal:terminated",
+		"graceful.shutdown.force_closed:0|c|#service:api,signal:terminated",
+		"graceful.shutdown.hijacked_cut:0|c|#service:api,signal:terminated",
+		"graceful.shutdown.force_closed_requests:0|c|#service:api,signal:terminated",
+		"graceful.shutdown.timeout_exceeded:1|c|#service:api,signal:terminated",
+		"graceful.phase.skipped:1|c|#service:api,signal:terminated,phase:drain_delay",
+		"graceful.phase.duration:1200|ms|#service:api,signal:terminated,phase:drain",
+		"graceful.phase.duration:250|ms|#service:api,signal:terminated,phase:cleanup,tier:1",
+		"graceful.phase.duration:50|ms|#service:api,signal:terminated,phase:cleanup,component:db",
+	}, "\n")
+
+	if got := string(buf[:n]); got != want {
+		t.Fatalf("packet =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSinkHandleWithoutServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	sink, err := New(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// Must neither block nor panic
+	for n := 0; n < 3; n++ {
+		sink.Handle(graceful.Event{Kind: graceful.ReportEvent, Report: &graceful.Report{}})
+	}
+}
@@ -0,0 +1,163 @@
+package graceful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy returns how long to wait before the given restart,
+// counting from 1
+type BackoffPolicy func(restart int) time.Duration
+
+// ExponentialBackoff waits initial before the first restart,
+// doubling the wait for every restart after it, up to max
+func ExponentialBackoff(initial, max time.Duration) BackoffPolicy {
+	return func(restart int) time.Duration {
+		d := initial
+
+		for n := 1; n < restart && d < max; n++ {
+			d *= 2
+		}
+
+		if d > max {
+			return max
+		}
+
+		return d
+	}
+}
+
+// RunSupervised serves the Server returned by newServer until a shutdown
+// signal is received, and then shuts it down
+func RunSupervised(newServer func() Server, backoff BackoffPolicy, opts ...Option) error {
+	opts = append([]Option{WithLogger(logger)}, opts...)
+
+	return NewSupervised(newServer, backoff, opts...).Run(context.Background())
+}
+
+// NewSupervised returns an Instance that serves the Server returned by
+// newServer. A server that fails with an error other than
+// http.ErrServerClosed, or panics in ListenAndServe, is replaced by a new
+// one from newServer once backoff has passed. Only the server running
+// when the shutdown begins is shut down.
+func NewSupervised(newServer func() Server, backoff BackoffPolicy, opts ...Option) *Instance {
+	i := newInstance(nil, nil, opts...)
+
+	sv := &supervisor{newServer: newServer, backoff: backoff}
+
+	m := i.members[0]
+	m.supervisor = sv
+	m.serve = func(ctx context.Context) error {
+		return sv.run(ctx, i)
+	}
+
+	return i
+}
+
+// supervisor restarts the server of a member until it is frozen
+type supervisor struct {
+	newServer func() Server
+	backoff   BackoffPolicy
+
+	mu      sync.Mutex
+	frozen  bool
+	current Server
+	conns   *connTracker
+}
+
+// run serves new servers, one at a time, until ctx is done
+func (sv *supervisor) run(ctx context.Context, i *Instance) error {
+	for restart := 0; ; {
+		s, ok := sv.start(i)
+		if !ok {
+			return http.ErrServerClosed
+		}
+
+		i.announce(&member{server: s})
+
+		err := serveRecovered(func() error { return i.serveHTTP(ctx, "", s) })
+		if err == http.ErrServerClosed || ctx.Err() != nil {
+			return http.ErrServerClosed
+		}
+
+		restart++
+
+		wait := sv.backoff(restart)
+
+		i.emit(Event{Kind: RestartEvent, Phase: ServePhase, Restart: restart, Duration: wait, Err: phaseError(ServePhase, "", err)})
+
+		t := i.clock().NewTimer(wait)
+
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return http.ErrServerClosed
+		}
+	}
+}
+
+// start creates the next server, unless the supervisor is frozen
+func (sv *supervisor) start(i *Instance) (Server, bool) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	if sv.frozen {
+		return nil, false
+	}
+
+	sv.current, sv.conns = sv.newServer(), nil
+
+	if hs, ok := sv.current.(*http.Server); ok {
+		sv.conns = &connTracker{}
+		sv.conns.track(hs)
+		i.bindMiddleware(hs)
+		i.trackRequests(sv.conns, hs)
+		i.useBaseContext(sv.conns, hs)
+		i.useErrorLog(hs, "")
+	}
+
+	return sv.current, true
+}
+
+// freeze stops any further restarts, and returns a copy of m
+// with the server that is currently running
+func (sv *supervisor) freeze(m *member) *member {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	sv.frozen = true
+
+	frozen := *m
+	frozen.server, frozen.conns = nil, sv.conns
+
+	if sv.current != nil {
+		frozen.server = sv.current
+	}
+
+	return &frozen
+}
+
+// reset allows restarts again, once the Instance has been shut down
+func (sv *supervisor) reset() {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	sv.frozen, sv.current, sv.conns = false, nil, nil
+}
+
+// serveRecovered calls serve, returning a panic as an error
+// that includes the stack
+func serveRecovered(serve func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("graceful: panic in ListenAndServe: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return serve()
+}
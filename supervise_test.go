@@ -0,0 +1,120 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 5*time.Second)
+
+	for restart, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	} {
+		if got := backoff(restart); got != want {
+			t.Fatalf("backoff(%d) = %v, want %v", restart, got, want)
+		}
+	}
+}
+
+func TestNewSupervised(t *testing.T) {
+	clk := newFakeClock()
+
+	var (
+		created   int32
+		shutdowns []int32
+		restarts  = make(chan Event, 2)
+	)
+
+	serveErr := errors.New("accept failed")
+
+	newServer := func() Server {
+		n := atomic.AddInt32(&created, 1)
+
+		s := &supervisedServer{n: n, closed: make(chan struct{}), shutdowns: &shutdowns}
+
+		switch n {
+		case 1:
+			s.serve = func() error { panic("boom") }
+		case 2:
+			s.serve = func() error { return serveErr }
+		default:
+			s.serve = func() error {
+				<-s.closed
+				return errors.New("closed")
+			}
+		}
+
+		return s
+	}
+
+	var i *Instance
+
+	i = NewSupervised(newServer, ExponentialBackoff(time.Second, time.Minute), WithEventHandler(func(e Event) {
+		if e.Kind == RestartEvent {
+			restarts <- e
+		}
+	}), WithClock(clk))
+
+	go func() {
+		for n := 1; n <= 2; n++ {
+			e := <-restarts
+
+			if e.Restart != n {
+				t.Errorf("e.Restart = %d, want %d", e.Restart, n)
+			}
+
+			clk.WaitForTimers(1)
+			clk.Advance(e.Duration)
+		}
+
+		for atomic.LoadInt32(&created) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+
+		i.Shutdown()
+	}()
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if got, want := len(shutdowns), 1; got != want || shutdowns[0] != 3 {
+		t.Fatalf("shutdowns = %v, want [3]", shutdowns)
+	}
+}
+
+func TestServeRecovered(t *testing.T) {
+	err := serveRecovered(func() error { panic("boom") })
+
+	if err == nil || !strings.Contains(err.Error(), "panic in ListenAndServe: boom") {
+		t.Fatalf("serveRecovered() = %v, want panic error", err)
+	}
+
+	if !strings.Contains(err.Error(), "goroutine") {
+		t.Fatalf("serveRecovered() error does not include the stack")
+	}
+}
+
+type supervisedServer struct {
+	n         int32
+	serve     func() error
+	closed    chan struct{}
+	shutdowns *[]int32
+}
+
+func (s *supervisedServer) ListenAndServe() error { return s.serve() }
+
+func (s *supervisedServer) Shutdown(ctx context.Context) error {
+	*s.shutdowns = append(*s.shutdowns, s.n)
+	close(s.closed)
+	return nil
+}
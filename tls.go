@@ -0,0 +1,159 @@
+package graceful
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadInterval is how often the certificate files used by
+// ListenAndServeTLSReload are checked for changes
+var ReloadInterval = time.Minute
+
+// ListenAndServeTLSReload is like ListenAndServeTLS, but reloads the
+// certificate whenever certFile or keyFile change on disk
+func ListenAndServeTLSReload(hs *http.Server, certFile, keyFile string) {
+	NewTLSReload(hs, certFile, keyFile, WithLogger(logger), withFatal(), withoutListening()).Run(context.Background())
+}
+
+// NewTLSReload returns an Instance that serves TLS using hs, with the
+// certificate reloaded whenever certFile or keyFile change on disk. A
+// certificate that fails to load on startup is returned as an error from
+// Run, while reload failures are logged and the previous certificate is kept.
+func NewTLSReload(hs *http.Server, certFile, keyFile string, opts ...Option) *Instance {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	i := newInstance(hs, nil, opts...)
+
+	i.members[0].serve = func(ctx context.Context) error {
+		return i.serveHTTPS(ctx, "", hs, "", "")
+	}
+
+	i.starters = append(i.starters, func(ctx context.Context) error {
+		if err := r.load(); err != nil {
+			return err
+		}
+
+		cfg := &tls.Config{}
+		if hs.TLSConfig != nil {
+			cfg = hs.TLSConfig.Clone()
+		}
+
+		cfg.GetCertificate = r.GetCertificate
+		hs.TLSConfig = cfg
+
+		i.goBackground(ctx, func(ctx context.Context) {
+			r.watch(ctx, i.clock(), ReloadInterval, i.emit)
+		})
+
+		return nil
+	})
+
+	return i
+}
+
+// certReloader holds a certificate loaded from disk
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp fileStamp
+}
+
+// fileStamp changes whenever one of the certificate files changes
+type fileStamp struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// GetCertificate returns the most recently loaded certificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// load loads the certificate, replacing the current one
+func (r *certReloader) load() error {
+	stamp, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.stamp = stamp
+	r.mu.Unlock()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+
+	return nil
+}
+
+// changed reports whether the files changed since the last load
+func (r *certReloader) changed() bool {
+	stamp, err := r.stat()
+	if err != nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return stamp != r.stamp
+}
+
+func (r *certReloader) stat() (fileStamp, error) {
+	cfi, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileStamp{}, err
+	}
+
+	kfi, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileStamp{}, err
+	}
+
+	return fileStamp{
+		certMod: cfi.ModTime(), certSize: cfi.Size(),
+		keyMod: kfi.ModTime(), keySize: kfi.Size(),
+	}, nil
+}
+
+// watch reloads the certificate when the files change, checked every
+// interval on clk, until ctx is done
+func (r *certReloader) watch(ctx context.Context, clk Clock, interval time.Duration, emit func(Event)) {
+	for {
+		t := clk.NewTimer(interval)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C():
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		if err := r.load(); err != nil {
+			emit(Event{Kind: ErrorEvent, Phase: ServePhase, Path: r.certFile, Err: phaseError(ServePhase, "", err)})
+			continue
+		}
+
+		emit(Event{Kind: ReloadedEvent, Phase: ServePhase, Path: r.certFile})
+	}
+}
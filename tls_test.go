@@ -0,0 +1,171 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	writeCert(t, certFile, keyFile, "first")
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	if err := r.load(); err != nil {
+		t.Fatalf("r.load() = %v, want nil", err)
+	}
+
+	clk := newFakeClock()
+
+	events := make(chan Event, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		r.watch(ctx, clk, time.Second, func(e Event) { events <- e })
+		close(done)
+	}()
+
+	advance := func() Event {
+		t.Helper()
+
+		for {
+			clk.Advance(time.Second)
+
+			select {
+			case e := <-events:
+				return e
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, "second")
+
+		if e := advance(); e.Kind != ReloadedEvent {
+			t.Fatalf("e.Kind = %q, want %q", e.Kind, ReloadedEvent)
+		}
+
+		if got, want := commonName(t, r), "second"; got != want {
+			t.Fatalf("commonName = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := os.WriteFile(certFile, []byte("invalid"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if e := advance(); e.Kind != ErrorEvent || e.Err == nil {
+			t.Fatalf("e = %+v, want error event", e)
+		}
+
+		if got, want := commonName(t, r), "second"; got != want {
+			t.Fatalf("commonName = %q, want %q", got, want)
+		}
+	})
+
+	cancel()
+
+	<-done
+}
+
+func TestNewTLSReload(t *testing.T) {
+	t.Run("serve", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		i := NewTLSReload(&http.Server{Addr: "127.0.0.1:0"}, "testdata/server.crt", "testdata/server.key", WithJSONLogging(&buf), shutdownOnListening())
+
+		if err := i.Run(context.Background()); err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		checkGoroutineLeaks(t)
+	})
+
+	t.Run("missing certificate", func(t *testing.T) {
+		i := NewTLSReload(&http.Server{Addr: "127.0.0.1:0"}, "testdata/missing.crt", "testdata/missing.key")
+
+		if err := i.Run(context.Background()); err == nil {
+			t.Fatalf("i.Run() = nil, want error")
+		}
+	})
+}
+
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("r.GetCertificate() = %v", err)
+	}
+
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() = %v", err)
+	}
+
+	return c.Subject.CommonName
+}
+
+// writeCert writes a self-signed certificate for cn to certFile and keyFile
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+
+	certPEM, keyPEM := newCert(t, cn)
+
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newCert returns a PEM encoded self-signed certificate and key for cn
+func newCert(t *testing.T, cn string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: cn}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,5 @@
+package graceful
+
+// abstractUnixSockets reports whether unix socket paths starting with @
+// are in the abstract namespace
+const abstractUnixSockets = true
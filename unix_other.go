@@ -0,0 +1,7 @@
+//go:build !linux
+
+package graceful
+
+// abstractUnixSockets reports whether unix socket paths starting with @
+// are in the abstract namespace
+const abstractUnixSockets = false
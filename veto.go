@@ -0,0 +1,57 @@
+package graceful
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WithVeto makes the Instance call fn when it receives a signal, before it
+// begins shutting down, and keep serving if fn returns true within window,
+// such as when a coordinator decides that it should not be drained after
+// all. Nothing changes until fn has returned, or window has passed, and
+// another signal, or a call to Shutdown, shuts down without waiting for it.
+func WithVeto(fn func(ctx context.Context) bool, window time.Duration) Option {
+	return func(c *config) {
+		c.veto = fn
+		c.vetoWindow = window
+	}
+}
+
+// vetoed reports whether the function set by WithVeto vetoed the shutdown
+// triggered by sig
+func (i *Instance) vetoed(ctx context.Context, sig os.Signal, signals <-chan os.Signal, trigger <-chan struct{}) bool {
+	if i.cfg.veto == nil {
+		return false
+	}
+
+	vctx, cancel := withTimeout(ctx, i.clock(), i.cfg.vetoWindow)
+	defer cancel()
+
+	vetoes := make(chan bool, 1)
+
+	go func() {
+		veto := false
+
+		safely(func() error { veto = i.cfg.veto(vctx); return nil })
+
+		vetoes <- veto
+	}()
+
+	select {
+	case veto := <-vetoes:
+		if !veto || vctx.Err() != nil {
+			return false
+		}
+
+		i.emit(Event{Kind: VetoedEvent, Phase: ServePhase, Source: sig.String()})
+
+		return true
+	case sig := <-signals:
+		i.signal = sig
+	case <-trigger:
+	case <-vctx.Done():
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithVeto(t *testing.T) {
+	signals := make(chan os.Signal)
+	addrs := make(chan string, 1)
+	vetoed := make(chan struct{}, 1)
+
+	vetoes := make(chan bool, 2)
+	vetoes <- true
+	vetoes <- false
+
+	i := New(&http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}, WithSignals(signals), WithRegistry(&Registry{}),
+		WithNetwork("tcp4"),
+		WithVeto(func(ctx context.Context) bool { return <-vetoes }, time.Second),
+		WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ListeningEvent:
+				addrs <- e.Addr
+			case VetoedEvent:
+				vetoed <- struct{}{}
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	addr := <-addrs
+
+	signals <- syscall.SIGTERM
+	<-vetoed
+
+	// Still serving, as if nothing happened
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("http.Get() = %v once vetoed, want the server still serving", err)
+	}
+	resp.Body.Close()
+
+	if i.shuttingDown() {
+		t.Fatalf("i.shuttingDown() = true once vetoed, want false")
+	}
+
+	signals <- syscall.SIGTERM
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the second shutdown was not let through")
+	}
+
+	if got, want := i.Report().Signal, syscall.SIGTERM.String(); got != want {
+		t.Fatalf("i.Report().Signal = %q, want %q", got, want)
+	}
+}
+
+func TestWithVetoBypassed(t *testing.T) {
+	signals := make(chan os.Signal)
+	listening := make(chan struct{})
+	asked := make(chan struct{})
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithRegistry(&Registry{}),
+		WithVeto(func(ctx context.Context) bool {
+			close(asked)
+			<-ctx.Done()
+			return true
+		}, time.Minute),
+		WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				close(listening)
+			}
+		}))
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	<-listening
+
+	signals <- syscall.SIGTERM
+	<-asked
+
+	// Another signal shuts down without waiting for the veto
+	signals <- os.Interrupt
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the second signal did not bypass the veto")
+	}
+
+	if got, want := i.Report().Signal, os.Interrupt.String(); got != want {
+		t.Fatalf("i.Report().Signal = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package graceful
+
+import (
+	"context"
+	"sync"
+)
+
+// runResult is the result of the most recent Run, waited for by Wait
+type runResult struct {
+	mu       sync.Mutex
+	done     chan struct{}
+	finished bool
+	report   Report
+	err      error
+}
+
+// start makes Wait wait for the Run that is starting,
+// if the previous one has finished
+func (rr *runResult) start() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.done == nil || rr.finished {
+		rr.done, rr.finished = make(chan struct{}), false
+	}
+}
+
+// finish sets the result of Run, and releases those waiting for it
+func (rr *runResult) finish(r *Report, err error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	rr.report, rr.err = Report{}, err
+	if r != nil {
+		rr.report = *r
+	}
+
+	rr.finished = true
+	close(rr.done)
+}
+
+// wait returns the channel closed once Run has finished
+func (rr *runResult) wait() <-chan struct{} {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.done == nil {
+		rr.done = make(chan struct{})
+	}
+
+	return rr.done
+}
+
+// Wait waits for Run to return, or ctx to be done, returning the report of
+// the shutdown and the error Run returned, or the error of ctx. It can be
+// called concurrently, before Run is, and returns at once if Run has
+// already returned, unless it has been called again since.
+func (i *Instance) Wait(ctx context.Context) (Report, error) {
+	select {
+	case <-i.result.wait():
+	case <-ctx.Done():
+		return Report{}, ctx.Err()
+	}
+
+	i.result.mu.Lock()
+	defer i.result.mu.Unlock()
+
+	return i.result.report, i.result.err
+}
@@ -0,0 +1,102 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	listening := make(chan struct{})
+
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithEventHandler(func(e Event) {
+			if e.Kind == ListeningEvent {
+				close(listening)
+			}
+		}))
+
+	type result struct {
+		r   Report
+		err error
+	}
+
+	var wg sync.WaitGroup
+
+	results := make(chan result, 3)
+
+	wait := func() {
+		defer wg.Done()
+
+		r, err := i.Wait(context.Background())
+		results <- result{r, err}
+	}
+
+	// Waiting before Run
+	wg.Add(1)
+	go wait()
+
+	errs := make(chan error, 1)
+	go func() { errs <- i.Run(context.Background()) }()
+
+	<-listening
+
+	// Waiting while serving
+	wg.Add(1)
+	go wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := i.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("i.Wait() = _, %v while serving, want %v", err, context.DeadlineExceeded)
+	}
+
+	i.Shutdown()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	// Waiting once finished
+	wg.Add(1)
+	go wait()
+
+	wg.Wait()
+	close(results)
+
+	for res := range results {
+		if res.err != nil || res.r.Finished.IsZero() || !res.r.Finished.Equal(i.Report().Finished) {
+			t.Fatalf("i.Wait() = %+v, %v, want the report of the shutdown", res.r, res.err)
+		}
+	}
+}
+
+func TestWaitRunAgain(t *testing.T) {
+	i := New(&http.Server{Addr: "127.0.0.1:0"}, WithRegistry(&Registry{}), shutdownOnListening())
+
+	if err := i.Run(context.Background()); err != nil {
+		t.Fatalf("i.Run() = %v, want nil", err)
+	}
+
+	if r, _ := i.Wait(context.Background()); r.Finished.IsZero() {
+		t.Fatalf("i.Wait() = %+v, want the report of the shutdown", r)
+	}
+
+	// The server has been shut down, failing before the Instance shuts down
+	if err := i.Run(context.Background()); !errors.Is(err, ErrAlreadyShutdown) {
+		t.Fatalf("i.Run() = %v, want %v", err, ErrAlreadyShutdown)
+	}
+
+	if r, err := i.Wait(context.Background()); !r.Finished.IsZero() || !errors.Is(err, ErrAlreadyShutdown) {
+		t.Fatalf("i.Wait() = %+v, %v, want no report and %v", r, err, ErrAlreadyShutdown)
+	}
+
+	if r := i.Report(); r != nil {
+		t.Fatalf("i.Report() = %+v, want nil", r)
+	}
+}
@@ -0,0 +1,75 @@
+package graceful
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WarmupGrace is the time the function set by WithWarmup is given to return
+// once canceled, or once its timeout has passed, before it is abandoned
+var WarmupGrace = 100 * time.Millisecond
+
+// warmup calls the function set by WithWarmup, returning early, with
+// stopped set, if the Instance is told to shut down before it returns,
+// abandoning it if it has not returned within WarmupGrace of being canceled
+func (i *Instance) warmup(ctx context.Context, signals <-chan os.Signal, trigger <-chan struct{}) (stopped bool, err error) {
+	if i.cfg.warmup == nil {
+		return false, nil
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if i.cfg.warmupTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+
+		wctx, cancelTimeout = withTimeout(wctx, i.clock(), i.cfg.warmupTimeout)
+		defer cancelTimeout()
+	}
+
+	start := i.clock().Now()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- safely(func() error { return i.cfg.warmup(wctx) })
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return false, phaseError(WarmupPhase, "", err)
+		}
+
+		i.emit(Event{Kind: WarmedUpEvent, Phase: WarmupPhase, Duration: i.clock().Now().Sub(start)})
+
+		return false, nil
+	case sig := <-signals:
+		i.signal = sig
+	case <-trigger:
+	case <-ctx.Done():
+	case <-wctx.Done():
+		// Its timeout has passed
+	}
+
+	timedOut := ctx.Err() == nil && wctx.Err() != nil
+
+	cancel()
+
+	t := i.clock().NewTimer(WarmupGrace)
+	defer t.Stop()
+
+	select {
+	case err = <-done:
+	case <-t.C():
+		i.emit(Event{Kind: AbandonedEvent, Phase: WarmupPhase, Shutdowner: "warmup"})
+		err = context.DeadlineExceeded
+	}
+
+	if timedOut {
+		return false, phaseError(WarmupPhase, "", err)
+	}
+
+	return true, nil
+}
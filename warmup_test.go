@@ -0,0 +1,134 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithWarmup(t *testing.T) {
+	t.Run("before listening", func(t *testing.T) {
+		var kinds []EventKind
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithWarmup(func(ctx context.Context) error {
+			kinds = append(kinds, "warmup")
+			return nil
+		}, time.Second), WithEventHandler(func(e Event) {
+			kinds = append(kinds, e.Kind)
+		}), shutdownOnListening())
+
+		if err := i.Run(context.Background()); err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		for n, want := range []EventKind{"warmup", WarmedUpEvent, ListeningEvent} {
+			if kinds[n] != want {
+				t.Fatalf("kinds[%d] = %q, want %q", n, kinds[n], want)
+			}
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		// Listening would fail with a different error,
+		// as the address is already in use
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		failed := errors.New("cache unavailable")
+
+		i := New(&http.Server{Addr: ln.Addr().String()}, WithWarmup(func(ctx context.Context) error {
+			return failed
+		}, 0))
+
+		if err := i.Run(context.Background()); !errors.Is(err, failed) {
+			t.Fatalf("i.Run() = %v, want %v", err, failed)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clk := newFakeClock()
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithWarmup(func(ctx context.Context) error {
+			clk.Advance(5 * time.Second)
+			<-ctx.Done()
+			return ctx.Err()
+		}, 5*time.Second), WithClock(clk))
+
+		if err := i.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("i.Run() = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+
+		var events []Event
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithWarmup(func(ctx context.Context) error {
+			signals <- os.Interrupt
+			<-ctx.Done()
+			return ctx.Err()
+		}, 0), WithEventHandler(func(e Event) {
+			events = append(events, e)
+		}))
+
+		if err := i.Run(context.Background()); err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		for _, e := range events {
+			if e.Kind == ListeningEvent || e.Kind == WarmedUpEvent {
+				t.Fatalf("events include %q", e.Kind)
+			}
+		}
+
+		if got, want := events[1].Kind, SkippedDrainEvent; got != want {
+			t.Fatalf("events[1].Kind = %q, want %q", got, want)
+		}
+	})
+	t.Run("ignoring ctx", func(t *testing.T) {
+		clk := newFakeClock()
+
+		signals := make(chan os.Signal, 1)
+		release := make(chan struct{})
+		defer close(release)
+
+		var abandoned bool
+
+		i := New(&http.Server{Addr: "127.0.0.1:0"}, WithSignals(signals), WithWarmup(func(ctx context.Context) error {
+			signals <- os.Interrupt
+			<-release
+			return nil
+		}, 0), WithEventHandler(func(e Event) {
+			if e.Kind == AbandonedEvent && e.Phase == WarmupPhase {
+				abandoned = true
+			}
+		}), WithClock(clk))
+
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		clk.WaitForTimers(1)
+		clk.Advance(WarmupGrace)
+
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("i.Run() = %v, want nil", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("i.Run() waited for a warmup that ignores ctx")
+		}
+
+		if !abandoned {
+			t.Fatalf("the warmup was not logged as abandoned")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package graceful
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// refusing counts the Instances that have begun shutting down, and
+	// not returned from Run, with refusingCh closed while it is not zero
+	refusing   atomic.Int64
+	refusingMu sync.Mutex
+	refusingCh = make(chan struct{})
+)
+
+// AcceptingWork reports whether handlers should accept new work, such as
+// jobs that outlast the request enqueueing them. It is true until an Instance
+// in the process begins shutting down, and again once Run has returned for
+// every such Instance. It turns false before anything else in the shutdown happens:
+// before ShutdownChan is closed, HealthHandler answers 503 Service
+// Unavailable, the drain delay set by WithDrainDelay and the drain of the
+// servers, so that no job is accepted once readiness has flipped.
+//
+//	if !graceful.AcceptingWork() {
+//		w.Header().Set("Retry-After", "5")
+//		http.Error(w, `{"reason":"shutting_down"}`, http.StatusServiceUnavailable)
+//		return
+//	}
+func AcceptingWork() bool {
+	return refusing.Load() == 0
+}
+
+// AcceptingWork reports whether handlers should accept new work, like the
+// AcceptingWork function, until the Instance begins shutting down, and
+// then not until it is run again
+func (i *Instance) AcceptingWork() bool {
+	return !i.refusingWork.Load()
+}
+
+// RefusingWork returns a channel that is closed once AcceptingWork turns
+// false, for components that cache it. Once AcceptingWork is true again,
+// a new channel is returned.
+func RefusingWork() <-chan struct{} {
+	refusingMu.Lock()
+	defer refusingMu.Unlock()
+
+	return refusingCh
+}
+
+// refuseWork makes AcceptingWork return false, unless it already does
+// because of the Instance
+func (i *Instance) refuseWork() {
+	if !i.refusingWork.CompareAndSwap(false, true) || !i.refusal.CompareAndSwap(false, true) {
+		return
+	}
+
+	refusingMu.Lock()
+	defer refusingMu.Unlock()
+
+	if refusing.Add(1) == 1 {
+		close(refusingCh)
+	}
+}
+
+// acceptWork undoes refuseWork, once the Instance is run again
+func (i *Instance) acceptWork() {
+	i.refusingWork.Store(false)
+	i.releaseRefusal()
+}
+
+// releaseRefusal stops the refusal of the Instance from making the
+// AcceptingWork function return false, once Run returns
+func (i *Instance) releaseRefusal() {
+	if !i.refusal.CompareAndSwap(true, false) {
+		return
+	}
+
+	refusingMu.Lock()
+	defer refusingMu.Unlock()
+
+	if refusing.Add(-1) == 0 {
+		refusingCh = make(chan struct{})
+	}
+}
@@ -0,0 +1,83 @@
+package graceful
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestAcceptingWork(t *testing.T) {
+	before := refusing.Load()
+
+	serving := make(chan struct{}, 1)
+
+	var (
+		accepting, instanceAccepting, refused, draining bool
+		health                                          int
+	)
+
+	var i *Instance
+
+	// A server that can be run again, unlike an *http.Server
+	s := ServerFunc(func() error {
+		shutdown := i.ShutdownChan()
+		serving <- struct{}{}
+		<-shutdown
+
+		return http.ErrServerClosed
+	}, func(ctx context.Context) error { return nil })
+
+	i = New(s, WithSignals(make(chan os.Signal)), WithRegistry(&Registry{}),
+		WithEventHandler(func(e Event) {
+			switch e.Kind {
+			case ShutdownEvent:
+				accepting, instanceAccepting = AcceptingWork(), i.AcceptingWork()
+
+				select {
+				case <-RefusingWork():
+					refused = true
+				default:
+				}
+
+				draining = i.shuttingDown()
+
+				rec := httptest.NewRecorder()
+				i.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+				health = rec.Code
+			}
+		}))
+
+	for run := 0; run < 2; run++ {
+		errs := make(chan error, 1)
+		go func() { errs <- i.Run(context.Background()) }()
+
+		<-serving
+
+		if !i.AcceptingWork() || refusing.Load() != before {
+			t.Fatalf("run %d: the Instance is refusing work while serving", run)
+		}
+
+		i.Shutdown()
+
+		if err := <-errs; err != nil {
+			t.Fatalf("i.Run() = %v, want nil", err)
+		}
+
+		if accepting || instanceAccepting || !refused {
+			t.Fatalf("run %d: AcceptingWork() = %t, i.AcceptingWork() = %t, RefusingWork() closed = %t once shutting down",
+				run, accepting, instanceAccepting, refused)
+		}
+
+		if draining || health != http.StatusOK {
+			t.Fatalf("run %d: the drain had begun, health %d, when AcceptingWork turned false", run, health)
+		}
+
+		// Released by the Instance once Run has returned, run again or not
+		if i.AcceptingWork() || refusing.Load() != before {
+			t.Fatalf("run %d: i.AcceptingWork() = %t, refusing %d, want only the Instance refusing work once Run has returned",
+				run, i.AcceptingWork(), refusing.Load()-before)
+		}
+	}
+}